@@ -1,13 +1,20 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
 	"isy-cli/internal/context"
+	"isy-cli/internal/conversation"
+	"isy-cli/internal/hooks"
+	"isy-cli/internal/lineedit"
 	localOpenAI "isy-cli/internal/openai"
 	"isy-cli/internal/openai/schemas/ask"
+	"isy-cli/internal/project"
+	"isy-cli/internal/sessions"
 	"os"
+	"regexp"
+	"strings"
 
 	externalOpenAI "github.com/openai/openai-go"
 
@@ -15,83 +22,205 @@ import (
 )
 
 func AskCommand() *cobra.Command {
-	return &cobra.Command{
-		Use:   "ask",
-		Short: "Start a chat session with OpenAI about your codebase",
-		Long:  "Engage in an interactive chat session to ask OpenAI questions about your codebase.",
+	var profile string
+	var model string
+	var resume string
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "ask [question]",
+		Short: "Ask OpenAI about your codebase, interactively or with a single question",
+		Long: `Engage in an interactive chat session to ask OpenAI questions about your codebase.
+
+With a question as argument, isy answers it and exits. Input piped on stdin is
+appended to the question, e.g.:
+
+  go test ./... 2>&1 | isy ask "why does this fail"
+
+Use --output json to get the structured response and the token usage.
+
+Every session is saved under .isy/sessions. Use --resume to continue the latest
+session, or --resume <id> for a specific one (see "isy sessions").`,
 		Run: func(cmd *cobra.Command, args []string) {
+			// "isy ask --resume <id>": senza "=" l'id arriva come primo argomento
+			if resume == resumeLatest && len(args) > 0 && sessionIDPattern.MatchString(args[0]) {
+				resume = args[0]
+				args = args[1:]
+			}
+			question := strings.TrimSpace(strings.Join(args, " "))
+			oneShot := question != ""
+
+			if err := checkOutput(output); err != nil {
+				fmt.Println("Errore:", err)
+				return
+			}
+			if output == outputJSON && !oneShot {
+				fmt.Println("Errore: --output json richiede una domanda come argomento")
+				return
+			}
+
+			// Senza REPL gli avvisi vanno su stderr, così stdout contiene solo la risposta
+			notices := io.Writer(os.Stdout)
+			fail := func(message string, err error) {
+				fmt.Println(message, err)
+			}
+			if oneShot {
+				notices = os.Stderr
+				fail = func(message string, err error) {
+					exitWithError(output, message, err)
+				}
+
+				input, err := readPipedInput()
+				if err != nil {
+					fail("Errore:", err)
+					return
+				}
+				question = withPipedInput(question, input)
+			}
+
+			// Riprende una sessione salvata oppure ne prepara una nuova
+			var session *sessions.Session
+			var err error
+			switch resume {
+			case "":
+			case resumeLatest:
+				session, err = sessions.Latest()
+			default:
+				session, err = sessions.Load(resume)
+			}
+			if err != nil {
+				fail("Errore durante il caricamento della sessione:", err)
+				return
+			}
+			if session != nil && profile == "" {
+				profile = session.Profile
+			}
+
+			// Carica configurazione e profilo di contesto
+			runner, err := hooks.Load("ask", notices)
+			if err != nil {
+				fail("Errore durante il caricamento della configurazione:", err)
+				return
+			}
+			opts, err := sessionOptions(runner, profile)
+			if err != nil {
+				fail("Errore:", err)
+				return
+			}
+			settings, err := context.ResolveSettings(opts)
+			if err != nil {
+				fail("Errore durante il caricamento della configurazione:", err)
+				return
+			}
+			if err := overrideModel(settings, model); err != nil {
+				fail("Errore:", err)
+				return
+			}
+
 			// Inizializza il contesto
-			contextContent, err := context.BuildContext()
+			contextContent, err := buildSessionContext(settings, opts)
 			if err != nil {
-				fmt.Println("Errore durante la generazione del contesto:", err)
+				fail("Errore durante la generazione del contesto:", err)
 				return
 			}
 
+			// Il contesto viene sempre rigenerato: se il codice è cambiato dall'ultima
+			// volta la sessione ripresa prosegue sul codice attuale
+			contextHash := sessions.ContextHash(contextContent)
+			if session == nil {
+				session, err = sessions.New(localOpenAI.ChatModel(settings.Config), profile)
+				if err != nil {
+					fail("Errore durante la creazione della sessione:", err)
+					return
+				}
+			} else {
+				fmt.Fprintf(notices, "Sessione %s ripresa (%d domande): %s\n", session.ID, session.Turns(), session.Title)
+				if session.ContextHash != contextHash {
+					fmt.Fprintln(notices, "Il codice è cambiato dall'ultima volta: il contesto è stato aggiornato.")
+				}
+			}
+			session.ContextHash = contextHash
+
 			// Carica l'uso dei token all'inizio della sessione
 			initialUsage, err := localOpenAI.LoadTokenUsage()
 			if err != nil {
-				fmt.Println("Errore caricando uso token iniziale:", err)
+				fail("Errore caricando uso token iniziale:", err)
 				return
 			}
 
+			// Nella REPL l'editor serve anche a confermare i comandi chiesti dal modello
+			var editor *lineedit.Editor
+			if !oneShot {
+				editor = lineedit.New(project.StatePath(historyFile))
+			}
+			toolbox := newToolbox(settings, notices, editor)
+
 			// Usa lo schema JSON e il prompt dal pacchetto schemas/ask
-			systemPrompt := ask.SYSTEM_PROMPT
+			systemPrompt := systemPromptWithTools(ask.SYSTEM_PROMPT, toolbox)
 
-			// Inizializza la sessione di chat
-			chat := []externalOpenAI.ChatCompletionMessageParamUnion{
-				externalOpenAI.SystemMessage(systemPrompt),
-				externalOpenAI.UserMessage(contextContent),
+			// Inizializza la conversazione con il riassunto e i turni non compattati
+			conv := newConversation(settings, systemPrompt, contextContent)
+			conv.Summary = session.Summary
+			for _, message := range session.Messages[min(session.Compacted, len(session.Messages)):] {
+				conv.Turns = append(conv.Turns, conversation.Turn{Role: message.Role, Content: message.Content})
 			}
 
-			reader := bufio.NewReader(os.Stdin)
-			fmt.Println("Chat session started. Type your queries. Press Ctrl+D to exit.")
+			repl := &replSession{settings: settings, opts: opts, conv: conv, start: initialUsage, out: notices, tools: toolbox, hooks: runner, symbols: &context.SymbolIndex{}, session: session}
+			for _, message := range session.Messages {
+				repl.log = append(repl.log, conversation.Turn{Role: message.Role, Content: message.Content})
+			}
+
+			if oneShot {
+				response, usage, err := repl.askTurn(question)
+				if err != nil {
+					fail("Errore durante la richiesta a OpenAI:", err)
+					return
+				}
+				if output == outputJSON {
+					writeJSON(askOutput{Session: session.ID, Model: session.Model, Response: response, Usage: usage})
+					return
+				}
+				fmt.Println(response.ContextualResponse)
+				return
+			}
+
+			fmt.Println("Chat session started. Type your queries, /help for commands. Press Ctrl+D to exit.")
 
 			for {
-				fmt.Print("\nYou: ")
-				userInput, err := reader.ReadString('\n')
+				fmt.Println()
+				userInput, err := editor.ReadInput("You: ")
+				if err == lineedit.ErrInterrupted {
+					continue
+				}
 				if err != nil {
 					// EOF detected, exit the session
 					fmt.Println("\nExiting chat session.")
 					break
 				}
-
-				userInput = userInput[:len(userInput)-1] // Rimuovi il newline
-
-				// Aggiungi il messaggio dell'utente alla chat
-				chat = append(chat, externalOpenAI.UserMessage(userInput))
-
-				// Prepara i parametri per la chiamata a OpenAI
-				params := externalOpenAI.ChatCompletionNewParams{
-					Model: externalOpenAI.F(externalOpenAI.ChatModelGPT4o),
-					ResponseFormat: externalOpenAI.F[externalOpenAI.ChatCompletionNewParamsResponseFormatUnion](
-						externalOpenAI.ResponseFormatJSONSchemaParam{
-							Type: externalOpenAI.F(externalOpenAI.ResponseFormatJSONSchemaTypeJSONSchema),
-							JSONSchema: externalOpenAI.F(externalOpenAI.ResponseFormatJSONSchemaJSONSchemaParam{
-								Name:   externalOpenAI.F("ask_code_info"),
-								Schema: externalOpenAI.F(ask.AskCodeInfoResponseSchema),
-								Strict: externalOpenAI.Bool(true),
-							}),
-						},
-					),
-					Messages: externalOpenAI.F(chat),
+				if strings.TrimSpace(userInput) == "" || repl.handleCommand(userInput) {
+					continue
 				}
 
-				// Esegui la richiesta di completamento
-				response, err := localOpenAI.RunCompletion(params)
+				response, _, err := repl.askTurn(userInput)
 				if err != nil {
 					fmt.Println("Errore durante la richiesta a OpenAI:", err)
 					continue
 				}
 
-				// Decodifica la risposta
-				askResponse := ask.AskCodeInfo{}
-				_ = json.Unmarshal([]byte(response), &askResponse)
-
-				// Aggiungi la risposta al contesto della chat
-				chat = append(chat, externalOpenAI.AssistantMessage(askResponse.ContextualResponse))
-
 				// Mostra la risposta
-				fmt.Printf("\nAssistant: %s\n", askResponse.ContextualResponse)
+				fmt.Printf("\nAssistant: %s\n", response.ContextualResponse)
+			}
+
+			// /clear può aver aperto una nuova sessione
+			session = repl.session
+			if len(session.Messages) > 0 {
+				// Registra anche l'hash del contesto aggiornato alla ripresa
+				session.ContextHash = conv.ContextHash
+				syncCompaction(session, conv)
+				if err := session.Save(); err != nil {
+					fmt.Println("Errore durante il salvataggio della sessione:", err)
+				}
+				fmt.Printf("\nSessione salvata: %s (riprendila con 'isy ask --resume %s')\n", session.ID, session.ID)
 			}
 
 			// Carica l'uso dei token alla fine della sessione
@@ -104,17 +233,126 @@ func AskCommand() *cobra.Command {
 			// Calcola i token e i costi della sessione
 			inputTokensUsed := finalUsage.TokenInput - initialUsage.TokenInput
 			outputTokensUsed := finalUsage.TokenOutput - initialUsage.TokenOutput
-			sessionCost := finalUsage.TotalCost - initialUsage.TotalCost
+			sessionCost := formatCost(finalUsage.TotalCost-initialUsage.TotalCost, finalUsage.UnpricedTokens > initialUsage.UnpricedTokens)
 
 			// Mostra i dettagli della sessione
 			fmt.Printf("\nToken di input usati nella sessione: %d\n", inputTokensUsed)
 			fmt.Printf("Token di output usati nella sessione: %d\n", outputTokensUsed)
-			fmt.Printf("Costo della sessione (USD): %.4f\n", sessionCost)
+			fmt.Printf("Costo della sessione (USD): %s\n", sessionCost)
 
 			// Mostra i dettagli totali
 			fmt.Printf("\nTotale token di input: %d\n", finalUsage.TokenInput)
 			fmt.Printf("Totale token di output: %d\n", finalUsage.TokenOutput)
-			fmt.Printf("Costo totale (USD): %.4f\n", finalUsage.TotalCost)
+			fmt.Printf("Costo totale (USD): %s\n", formatCost(finalUsage.TotalCost, finalUsage.UnpricedTokens > 0))
 		},
 	}
+
+	cmd.Flags().StringVar(&profile, "profile", "", "Profilo di contesto da usare (default: context.profile o .isycontext)")
+	cmd.Flags().StringVar(&model, "model", "", "Modello da usare (default: model della configurazione)")
+	cmd.Flags().StringVar(&resume, "resume", "", "Riprende la sessione indicata (senza id: la più recente)")
+	cmd.Flags().Lookup("resume").NoOptDefVal = resumeLatest
+	cmd.Flags().StringVarP(&output, "output", "o", outputText, "Formato della risposta a una singola domanda: text o json")
+
+	return cmd
+}
+
+// askOutput è il risultato di "isy ask --output json"
+type askOutput struct {
+	Session  string          `json:"session"`
+	Model    string          `json:"model"`
+	Response ask.AskCodeInfo `json:"response"`
+	Usage    turnUsage       `json:"usage"`
+}
+
+// askTurn invia una domanda e restituisce la risposta, aggiornando la
+// conversazione e salvando subito il turno nella sessione
+func (r *replSession) askTurn(userInput string) (ask.AskCodeInfo, turnUsage, error) {
+	// /clear può aver aperto una nuova sessione
+	session := r.session
+
+	// Gli hook before_request possono riscrivere o bloccare la richiesta
+	userInput, err := r.rewriteRequest(userInput)
+	if err != nil {
+		return ask.AskCodeInfo{}, turnUsage{}, err
+	}
+
+	// Con il recupero semantico aggiunge il codice più rilevante per la richiesta
+	extra, err := r.requestExtra(userInput)
+	if err != nil {
+		return ask.AskCodeInfo{}, turnUsage{}, fmt.Errorf("errore durante il recupero del contesto per la richiesta: %v", err)
+	}
+
+	// Aggiorna il contesto se i file sono cambiati e compatta la
+	// conversazione se ha superato la soglia di token
+	turnStart, _ := localOpenAI.LoadTokenUsage()
+	r.refreshContext()
+	r.conv.AddUser(userInput, extra)
+	r.compactConversation()
+
+	// Prepara i parametri per la chiamata a OpenAI
+	params := externalOpenAI.ChatCompletionNewParams{
+		Model: externalOpenAI.F(localOpenAI.ChatModel(r.settings.Config)),
+		ResponseFormat: externalOpenAI.F[externalOpenAI.ChatCompletionNewParamsResponseFormatUnion](
+			externalOpenAI.ResponseFormatJSONSchemaParam{
+				Type: externalOpenAI.F(externalOpenAI.ResponseFormatJSONSchemaTypeJSONSchema),
+				JSONSchema: externalOpenAI.F(externalOpenAI.ResponseFormatJSONSchemaJSONSchemaParam{
+					Name:   externalOpenAI.F("ask_code_info"),
+					Schema: externalOpenAI.F(ask.AskCodeInfoResponseSchema),
+					Strict: externalOpenAI.Bool(true),
+				}),
+			},
+		),
+		Messages: externalOpenAI.F(r.conv.Messages()),
+	}
+
+	// Esegui la richiesta di completamento
+	response, err := r.complete(params)
+	if err != nil {
+		// Toglie la domanda senza risposta, così la conversazione resta coerente
+		r.conv.DropLast()
+		return ask.AskCodeInfo{}, turnUsage{}, err
+	}
+	usage := usageSince(turnStart)
+
+	// Decodifica la risposta; una risposta troncata o rifiutata non va in sessione
+	askResponse := ask.AskCodeInfo{}
+	if err := json.Unmarshal([]byte(response), &askResponse); err != nil {
+		r.conv.DropLast()
+		return ask.AskCodeInfo{}, usage, fmt.Errorf("errore nella decodifica della risposta: %v", err)
+	}
+
+	// Aggiungi la risposta al contesto della chat
+	r.conv.AddAssistant(askResponse.ContextualResponse)
+
+	// Salva il turno subito, così la sessione sopravvive a un'uscita improvvisa
+	session.Model = localOpenAI.ChatModel(r.settings.Config)
+	session.Append("user", userInput)
+	session.Append("assistant", askResponse.ContextualResponse)
+	r.record(userInput, askResponse.ContextualResponse)
+	session.AddUsage(usage.InputTokens, usage.OutputTokens, usage.Cost)
+	session.ContextHash = r.conv.ContextHash
+	syncCompaction(session, r.conv)
+	if err := session.Save(); err != nil {
+		fmt.Fprintln(r.out, "Errore durante il salvataggio della sessione:", err)
+	}
+
+	return askResponse, usage, nil
+}
+
+// sessionIDPattern riconosce gli id di sessione (anche abbreviati), per
+// distinguerli da una domanda in "isy ask --resume <id>"
+var sessionIDPattern = regexp.MustCompile(`^[0-9]{8}(-[0-9a-f-]*)?$`)
+
+const (
+	// Valore di --resume senza id: riprende la sessione più recente
+	resumeLatest = "latest"
+	// File della cronologia degli input di ask e code, in .isy
+	historyFile = "history"
+)
+
+// syncCompaction registra nella sessione il riassunto e i messaggi compattati,
+// così alla ripresa la conversazione riparte già compattata
+func syncCompaction(session *sessions.Session, conv *conversation.Conversation) {
+	session.Summary = conv.Summary
+	session.Compacted = max(len(session.Messages)-len(conv.Turns), 0)
 }
@@ -1,35 +1,96 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	codeUtils "isy-cli/internal/code"
+	"isy-cli/internal/config"
 	"isy-cli/internal/context"
+	"isy-cli/internal/diff"
+	"isy-cli/internal/hooks"
+	"isy-cli/internal/lineedit"
 	localOpenAI "isy-cli/internal/openai"
 	"isy-cli/internal/openai/schemas/code"
+	"isy-cli/internal/operations"
+	"isy-cli/internal/policy"
+	"isy-cli/internal/project"
+	"isy-cli/internal/verify"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	externalOpenAI "github.com/openai/openai-go"
 	"github.com/spf13/cobra"
 )
 
 func CodeCommand() *cobra.Command {
-	return &cobra.Command{
-		Use:   "code",
-		Short: "Interactively modify code with OpenAI assistance",
+	var profile string
+	var model string
+	var branch string
+	var output string
+	var apply bool
+
+	cmd := &cobra.Command{
+		Use:   "code [task]",
+		Short: "Modify code with OpenAI assistance, interactively or with a single task",
+		Long: `Start an interactive session that proposes code modifications on a virtual
+branch (a copy of the project under .isy/branches).
+
+With a task as argument, isy proposes the modifications for it and exits; use
+--apply to apply them to the branch. Input piped on stdin is appended to the
+task, and --output json prints the structured response and the token usage.
+
+After each applied response the checks configured under "verify" (e.g. gofmt,
+go vet, go test) run in the branch; with verify.feedback a failure is sent back
+to the model for a correction. With --apply, failed checks exit with status 1.
+Checks and hooks from .isy/config.json run only once approved with isy trust.
+
+The policy in .isy/policy.json limits what the model may change: protected
+paths, forbidden operations, files and lines per turn, and paths that need a
+confirmation before they are applied.`,
 		Run: func(cmd *cobra.Command, args []string) {
-			var selectedBranch string
+			task := strings.TrimSpace(strings.Join(args, " "))
+			oneShot := task != ""
+
+			if err := checkOutput(output); err != nil {
+				fmt.Println("Errore:", err)
+				return
+			}
+			if (output == outputJSON || apply) && !oneShot {
+				fmt.Println("Errore: --output json e --apply richiedono un task come argomento")
+				return
+			}
 
-			branchesDir := ".isy/branches"
+			// Senza REPL gli avvisi vanno su stderr, così stdout contiene solo il risultato
+			notices := io.Writer(os.Stdout)
+			fail := func(message string, err error) {
+				fmt.Println(message, err)
+			}
+			if oneShot {
+				notices = os.Stderr
+				fail = func(message string, err error) {
+					exitWithError(output, message, err)
+				}
 
-			if len(args) > 0 {
-				selectedBranch = args[0]
-			} else {
-				branches, err := codeUtils.ListBranchesSortedByDate(branchesDir)
+				input, err := readPipedInput()
 				if err != nil {
+					fail("Errore:", err)
+					return
+				}
+				task = withPipedInput(task, input)
+			}
+
+			selectedBranch := branch
+
+			branchesDir := project.StatePath("branches")
+
+			// Senza REPL non si chiede quale branch usare: se ne crea uno nuovo
+			if selectedBranch == "" && !oneShot {
+				branches, err := codeUtils.ListBranchesSortedByDate(branchesDir)
+				if err != nil && !os.IsNotExist(errors.Unwrap(err)) {
 					fmt.Println("Error retrieving branches:", err)
 					return
 				}
@@ -52,10 +113,10 @@ func CodeCommand() *cobra.Command {
 			}
 
 			if selectedBranch == "" { // Nel caso non venga selezionato alcun branch esistente
-				fmt.Println("No previous branch found, creating a new virtual branch.")
+				fmt.Fprintln(notices, "No previous branch found, creating a new virtual branch.")
 				hash, err := codeUtils.GenerateHash()
 				if err != nil {
-					fmt.Println("Error generating hash:", err)
+					fail("Error generating hash:", err)
 					return
 				}
 				selectedBranch = hash
@@ -63,97 +124,379 @@ func CodeCommand() *cobra.Command {
 
 			tempDir := filepath.Join(branchesDir, selectedBranch)
 
+			currentHash, err := codeUtils.ComputeDirectoryHash(project.Root())
+			if err != nil {
+				fail("Error computing current directory hash:", err)
+				return
+			}
+
 			if _, err := os.Stat(tempDir); !os.IsNotExist(err) {
-				currentHash, err := codeUtils.ComputeDirectoryHash(".")
+				// Il branch può contenere modifiche applicate: si confronta il
+				// progetto con lo stato da cui il branch è stato creato
+				baseHash, err := codeUtils.LoadBranchBase(branchesDir, selectedBranch)
 				if err != nil {
-					fmt.Println("Error computing current directory hash:", err)
+					fail("Error reading branch base:", err)
 					return
 				}
-
-				branchHash, err := codeUtils.ComputeDirectoryHash(tempDir)
-				if err != nil {
-					fmt.Println("Error computing branch directory hash:", err)
-					return
+				if baseHash == "" {
+					baseHash, err = codeUtils.ComputeDirectoryHash(tempDir)
+					if err != nil {
+						fail("Error computing branch directory hash:", err)
+						return
+					}
 				}
 
-				if currentHash != branchHash {
-					fmt.Println("The current codebase differs from the selected branch. Operation aborted.")
+				if currentHash != baseHash {
+					fail("Operation aborted:", fmt.Errorf("the current codebase differs from the selected branch"))
 					return
 				}
 			} else {
-				if err := codeUtils.CopyDir(".", tempDir); err != nil {
-					fmt.Println("Error copying project:", err)
+				if err := codeUtils.CopyDir(project.Root(), tempDir); err != nil {
+					fail("Error copying project:", err)
 					return
 				}
+				if err := codeUtils.SaveBranchBase(branchesDir, selectedBranch, currentHash); err != nil {
+					fail("Error saving branch base:", err)
+					return
+				}
+			}
+
+			fmt.Fprintln(notices, "Working on branch:", tempDir)
+
+			// Contesto, file aggiunti e modifiche fanno riferimento al branch
+			if err := os.Chdir(tempDir); err != nil {
+				fail("Error entering branch directory:", err)
+				return
 			}
 
-			fmt.Println("Working on branch:", tempDir)
+			// Carica configurazione e profilo di contesto
+			runner, err := hooks.Load("code", notices)
+			if err != nil {
+				fail("Errore durante il caricamento della configurazione:", err)
+				return
+			}
+			opts, err := sessionOptions(runner, profile)
+			if err != nil {
+				fail("Errore:", err)
+				return
+			}
+			settings, err := context.ResolveSettings(opts)
+			if err != nil {
+				fail("Errore durante il caricamento della configurazione:", err)
+				return
+			}
+			if err := overrideModel(settings, model); err != nil {
+				fail("Errore:", err)
+				return
+			}
+
+			// La policy del progetto limita le modifiche che il modello può proporre
+			changePolicy, err := policy.Load()
+			if err != nil {
+				fail("Errore durante il caricamento della policy:", err)
+				return
+			}
 
 			// Inizializza il contesto
-			contextContent, err := context.BuildContext()
+			contextContent, err := buildSessionContext(settings, opts)
 			if err != nil {
-				fmt.Println("Errore durante la generazione del contesto:", err)
+				fail("Errore durante la generazione del contesto:", err)
 				return
 			}
 
-			systemPrompt := code.SYSTEM_PROMPT
+			// Nella REPL l'editor serve anche a confermare i comandi chiesti dal modello
+			var editor *lineedit.Editor
+			if !oneShot {
+				editor = lineedit.New(project.StatePath(historyFile))
+			}
+			toolbox := newToolbox(settings, notices, editor)
+
+			systemPrompt := systemPromptWithTools(codeSystemPrompt(settings.Config, changePolicy), toolbox)
 
 			// Initialize an empty chat session
-			chat := []externalOpenAI.ChatCompletionMessageParamUnion{
-				externalOpenAI.SystemMessage(systemPrompt),
-				externalOpenAI.UserMessage(contextContent),
-			}
+			conv := newConversation(settings, systemPrompt, contextContent)
 
-			reader := bufio.NewReader(os.Stdin)
-			fmt.Println("Interactive code modification session started. Type your requests. Press Ctrl+D to exit.")
+			initialUsage, err := localOpenAI.LoadTokenUsage()
+			if err != nil {
+				fail("Errore caricando uso token iniziale:", err)
+				return
+			}
+			repl := &replSession{settings: settings, opts: opts, conv: conv, start: initialUsage, out: notices, tools: toolbox, hooks: runner, symbols: &context.SymbolIndex{}, branch: tempDir, policy: changePolicy, editor: editor}
 
-			for {
-				fmt.Print("\nYou: ")
-				userInput, err := reader.ReadString('\n')
+			if oneShot {
+				response, usage, err := repl.codeTurn(task)
 				if err != nil {
-					// EOF detected, exit the session
-					fmt.Println("\nExiting chat session.")
-					break
+					fail(codeTurnFailure(err), err)
+					return
 				}
 
-				userInput = userInput[:len(userInput)-1] // Rimuovi il newline
-
-				// Aggiungi il messaggio dell'utente alla chat
-				chat = append(chat, externalOpenAI.UserMessage(userInput))
+				result := codeOutput{Branch: selectedBranch, Model: localOpenAI.ChatModel(settings.Config), Response: response, Usage: usage}
+				if apply {
+					if err := repl.applyWithChecks(&result); err != nil {
+						fail("Errore durante l'applicazione delle modifiche:", err)
+						return
+					}
+					result.Usage = usageSince(initialUsage)
+				}
 
-				// Prepare request parameters for OpenAI completion
-				params := externalOpenAI.ChatCompletionNewParams{
-					Model: externalOpenAI.F(externalOpenAI.ChatModelGPT4o),
-					ResponseFormat: externalOpenAI.F[externalOpenAI.ChatCompletionNewParamsResponseFormatUnion](
-						externalOpenAI.ResponseFormatJSONSchemaParam{
-							Type: externalOpenAI.F(externalOpenAI.ResponseFormatJSONSchemaTypeJSONSchema),
-							JSONSchema: externalOpenAI.F(externalOpenAI.ResponseFormatJSONSchemaJSONSchemaParam{
-								Name:   externalOpenAI.F("code_modification"),
-								Schema: externalOpenAI.F(code.CodeModificationResponseSchema),
-								Strict: externalOpenAI.Bool(true),
-							}),
-						}),
-					Messages: externalOpenAI.F(chat),
+				if output == outputJSON {
+					writeJSON(result)
+				} else {
+					printCodeOutput(result, apply, notices)
 				}
+				// Con controlli falliti il codice di uscita è 1, anche con --output json
+				if verify.Failed(result.Checks) {
+					os.Exit(1)
+				}
+				return
+			}
+
+			fmt.Println("Interactive code modification session started. Type your requests, /help for commands. Press Ctrl+D to exit.")
 
-				// Execute the completion request
-				response, err := localOpenAI.RunCompletion(params)
+			for {
+				fmt.Println()
+				userInput, err := editor.ReadInput("You: ")
+				if err == lineedit.ErrInterrupted {
+					continue
+				}
 				if err != nil {
-					fmt.Println("Errore durante la richiesta a OpenAI:", err)
+					// EOF detected, exit the session
+					fmt.Println("\nExiting chat session.")
+					break
+				}
+				if strings.TrimSpace(userInput) == "" || repl.handleCommand(userInput) {
 					continue
 				}
 
-				// Decode the response into the structured schema
-				codeModificationResponse := code.CodeModificationResponse{}
-				err = json.Unmarshal([]byte(response), &codeModificationResponse)
+				codeModificationResponse, _, err := repl.codeTurn(userInput)
 				if err != nil {
-					fmt.Println("Errore nella decodifica della risposta:", err)
+					fmt.Println(codeTurnFailure(err), err)
 					continue
 				}
 
-				// Print the response
-				fmt.Println("OpenAI:", codeModificationResponse)
+				printProposal(codeModificationResponse)
 			}
 		},
 	}
+
+	cmd.Flags().StringVar(&profile, "profile", "", "Profilo di contesto da usare (default: context.profile o .isycontext)")
+	cmd.Flags().StringVar(&model, "model", "", "Modello da usare (default: model della configurazione)")
+	cmd.Flags().StringVarP(&branch, "branch", "b", "", "Branch virtuale da usare o creare (default: scelto all'avvio, nuovo senza REPL)")
+	cmd.Flags().StringVarP(&output, "output", "o", outputText, "Formato del risultato di un singolo task: text o json")
+	cmd.Flags().BoolVar(&apply, "apply", false, "Applica al branch le modifiche proposte per il task")
+
+	return cmd
+}
+
+// maxPlanCorrections è il numero di volte in cui una risposta con problemi viene
+// rimandata al modello prima di rinunciare
+const maxPlanCorrections = 2
+
+// codeOutput è il risultato di "isy code --output json"
+type codeOutput struct {
+	Branch   string                        `json:"branch"`
+	Model    string                        `json:"model"`
+	Response code.CodeModificationResponse `json:"response"`
+	Applied  []string                      `json:"applied,omitempty"`
+	Notes    []string                      `json:"notes,omitempty"`
+	Checks   []verify.Result               `json:"checks,omitempty"` // Esito dei controlli dopo l'ultima applicazione
+
+	// Correzioni chieste al modello dopo controlli falliti, già applicate
+	Corrections []code.CodeModificationResponse `json:"corrections,omitempty"`
+	Usage       turnUsage                       `json:"usage"`
+}
+
+// printCodeOutput stampa il risultato di un singolo task in formato testo
+func printCodeOutput(result codeOutput, applied bool, notices io.Writer) {
+	fmt.Print(describeModifications(result.Response))
+	for _, correction := range result.Corrections {
+		fmt.Printf("\nCorrection after failed checks:\n%s", describeModifications(correction))
+	}
+	if applied {
+		fmt.Printf("Applied to branch %s: %s\n", result.Branch, strings.Join(result.Applied, ", "))
+		for _, note := range result.Notes {
+			fmt.Fprintln(notices, "nota:", note)
+		}
+		if len(result.Checks) > 0 {
+			fmt.Printf("Checks:\n%s", verify.Summary(result.Checks))
+		}
+		if verify.Failed(result.Checks) {
+			fmt.Fprint(notices, result.Checks[len(result.Checks)-1].Output)
+		}
+	}
+}
+
+// applyWithChecks applica la proposta in attesa ed esegue i controlli; se
+// falliscono e verify.feedback è attivo, rimanda l'esito al modello e ne
+// applica le correzioni, fino a verify.max_feedback volte
+func (r *replSession) applyWithChecks(result *codeOutput) error {
+	maxFeedback := r.settings.Config.Verify.MaxFeedback
+	if maxFeedback <= 0 {
+		maxFeedback = verify.DefaultMaxFeedback
+	}
+
+	for corrections := 0; ; corrections++ {
+		change, checks, err := r.applyPending()
+		if err != nil && corrections > 0 {
+			// Le modifiche precedenti restano applicate: si riporta l'esito dei loro controlli
+			fmt.Fprintln(r.out, "Correzione non applicata:", err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, file := range change.Files {
+			if !containsString(result.Applied, file) {
+				result.Applied = append(result.Applied, file)
+			}
+		}
+		result.Notes = append(result.Notes, change.Notes...)
+
+		result.Checks = checks
+		if !verify.Failed(result.Checks) || !r.settings.Config.Verify.Feedback || corrections == maxFeedback {
+			return nil
+		}
+
+		fmt.Fprintf(r.out, "Controlli falliti: richiesta di correzione al modello (%d/%d).\n", corrections+1, maxFeedback)
+		request := r.request
+		response, _, err := r.codeTurn(verify.Report(result.Checks))
+		if err != nil {
+			// Le modifiche applicate restano: l'esito dei controlli dice cosa non va
+			fmt.Fprintln(r.out, codeTurnFailure(err), err)
+			return nil
+		}
+		r.request = correctionRequest(request)
+		result.Corrections = append(result.Corrections, response)
+	}
+}
+
+// codeTurn invia una richiesta di modifica e restituisce la proposta, che
+// resta in attesa di /apply
+func (r *replSession) codeTurn(userInput string) (code.CodeModificationResponse, turnUsage, error) {
+	// Gli hook before_request possono riscrivere o bloccare la richiesta
+	userInput, err := r.rewriteRequest(userInput)
+	if err != nil {
+		return code.CodeModificationResponse{}, turnUsage{}, err
+	}
+
+	// Con il recupero semantico aggiunge il codice più rilevante per la richiesta
+	extra, err := r.requestExtra(userInput)
+	if err != nil {
+		return code.CodeModificationResponse{}, turnUsage{}, fmt.Errorf("errore durante il recupero del contesto per la richiesta: %v", err)
+	}
+
+	// Aggiorna il contesto se i file sono cambiati e compatta la
+	// conversazione se ha superato la soglia di token
+	turnStart, _ := localOpenAI.LoadTokenUsage()
+	r.refreshContext()
+	r.conv.AddUser(userInput, extra)
+	r.compactConversation()
+
+	// Il formato dipende dal modello, che può cambiare con /model durante la sessione
+	format := r.settings.Config.Code.EditFormatFor(localOpenAI.ChatModel(r.settings.Config))
+	r.conv.System = systemPromptWithTools(codeSystemPrompt(r.settings.Config, r.policy), r.tools)
+
+	// Prepare request parameters for OpenAI completion
+	params := externalOpenAI.ChatCompletionNewParams{
+		Model:    externalOpenAI.F(localOpenAI.ChatModel(r.settings.Config)),
+		Messages: externalOpenAI.F(r.conv.Messages()),
+	}
+	if format == config.EditFormatJSON {
+		params.ResponseFormat = externalOpenAI.F[externalOpenAI.ChatCompletionNewParamsResponseFormatUnion](
+			externalOpenAI.ResponseFormatJSONSchemaParam{
+				Type: externalOpenAI.F(externalOpenAI.ResponseFormatJSONSchemaTypeJSONSchema),
+				JSONSchema: externalOpenAI.F(externalOpenAI.ResponseFormatJSONSchemaJSONSchemaParam{
+					Name:   externalOpenAI.F("code_modification"),
+					Schema: externalOpenAI.F(code.CodeModificationResponseSchema),
+					Strict: externalOpenAI.Bool(true),
+				}),
+			})
+	}
+
+	// Le risposte che non si possono applicare tornano al modello con i problemi
+	// trovati, per un numero limitato di correzioni
+	for attempt := 1; ; attempt++ {
+		response, codeModificationResponse, err := r.requestModifications(params, format)
+		if err != nil {
+			r.conv.DropLast()
+			return code.CodeModificationResponse{}, usageSince(turnStart), err
+		}
+
+		// Keep the proposed modifications in the conversation for follow-up requests
+		r.conv.AddAssistant(response)
+		planErr := operations.Validate(r.branch, codeModificationResponse, r.policy)
+		if planErr == nil {
+			r.record(userInput, response)
+			r.pending = &codeModificationResponse
+			r.request = userInput
+			return codeModificationResponse, usageSince(turnStart), nil
+		}
+		if attempt > maxPlanCorrections {
+			r.record(userInput, response)
+			return code.CodeModificationResponse{}, usageSince(turnStart), planErr
+		}
+
+		fmt.Fprintf(r.out, "Le modifiche proposte hanno %d problemi: richiesta di correzione al modello (%d/%d).\n",
+			len(planErr.Problems), attempt, maxPlanCorrections)
+		r.conv.AddUser(planErr.Report(), "")
+		params.Messages = externalOpenAI.F(r.conv.Messages())
+	}
+}
+
+// printProposal mostra nella REPL le modifiche proposte, in attesa di /apply
+func printProposal(response code.CodeModificationResponse) {
+	fmt.Printf("\nProposed modifications:\n%s", describeModifications(response))
+	if len(response.Steps) > 0 || response.Patch != "" {
+		fmt.Println("Use /diff to review them and /apply to apply them to the branch.")
+	}
+}
+
+// codeTurnFailure restituisce l'intestazione del messaggio per un errore di codeTurn
+func codeTurnFailure(err error) string {
+	var planErr *operations.PlanError
+	if errors.As(err, &planErr) {
+		return "Nessuna modifica valida dopo le correzioni:"
+	}
+	var veto *hooks.VetoError
+	if errors.As(err, &veto) {
+		return "Richiesta interrotta:"
+	}
+	return "Errore durante la richiesta a OpenAI:"
+}
+
+// requestModifications esegue la richiesta e ne decodifica la risposta, che può
+// essere l'elenco di passi o una patch a seconda del formato
+func (r *replSession) requestModifications(params externalOpenAI.ChatCompletionNewParams, format string) (string, code.CodeModificationResponse, error) {
+	response, err := r.complete(params)
+	if err != nil {
+		return "", code.CodeModificationResponse{}, err
+	}
+
+	// Decode the response into the structured schema, or read the patch. Una
+	// patch illeggibile resta com'è: la validazione la segnala come problema e il
+	// modello può correggerla come gli altri errori.
+	codeModificationResponse := code.CodeModificationResponse{}
+	if format == config.EditFormatDiff {
+		if patches, err := diff.Parse(response); err == nil {
+			codeModificationResponse.Patch = diff.Format(patches)
+		} else {
+			codeModificationResponse.Patch = response
+		}
+	} else if err := json.Unmarshal([]byte(response), &codeModificationResponse); err != nil {
+		return "", code.CodeModificationResponse{}, fmt.Errorf("errore nella decodifica della risposta: %v", err)
+	}
+	return response, codeModificationResponse, nil
+}
+
+// codeSystemPrompt restituisce il prompt di sistema per il formato delle
+// risposte chiesto al modello configurato, con i limiti della policy
+func codeSystemPrompt(cfg *config.Config, pol *policy.Policy) string {
+	prompt := code.SYSTEM_PROMPT
+	if cfg.Code.EditFormatFor(localOpenAI.ChatModel(cfg)) == config.EditFormatDiff {
+		prompt = code.DIFF_SYSTEM_PROMPT
+	}
+	if description := pol.Describe(); description != "" {
+		prompt += "\n\n" + description
+	}
+	return prompt
 }
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"isy-cli/internal/config"
+	"isy-cli/internal/secrets"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// ConfigCommand raggruppa i comandi per la configurazione a livelli
+func ConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect and edit the layered configuration (global, project, local, env)",
+	}
+
+	cmd.AddCommand(configShowCommand())
+	cmd.AddCommand(configGetCommand())
+	cmd.AddCommand(configSetCommand())
+	cmd.AddCommand(configUnsetCommand())
+	cmd.AddCommand(configListCommand())
+
+	return cmd
+}
+
+func configShowCommand() *cobra.Command {
+	var showOrigin bool
+
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show the effective configuration",
+		Long: `Show the effective configuration obtained by merging, in increasing order of precedence:
+  global   user config file in the XDG config directory (credentials and defaults)
+  project  .isy/config.json, committed and shared with the team
+  local    .isy/config.local.json, git-ignored personal overrides
+  env      ISY_* environment variables (e.g. ISY_EMBEDDINGS_BASE_URL)`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, origins, err := config.LoadLayered()
+			if err != nil {
+				fmt.Println("Errore durante il caricamento della configurazione:", err)
+				return
+			}
+
+			values, err := config.ToMap(cfg)
+			if err != nil {
+				fmt.Println("Errore durante la lettura della configurazione:", err)
+				return
+			}
+
+			flat := config.Flatten(values)
+			for _, key := range config.SortedKeys(flat) {
+				line := fmt.Sprintf("%s = %s", key, formatConfigValue(key, flat[key]))
+				if showOrigin {
+					line += "    (" + describeOrigin(key, origins) + ")"
+				}
+				fmt.Println(line)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&showOrigin, "origin", false, "Mostra da quale livello proviene ogni valore")
+
+	return cmd
+}
+
+func configGetCommand() *cobra.Command {
+	var showOrigin bool
+
+	cmd := &cobra.Command{
+		Use:   "get <key>",
+		Short: "Print the effective value of a key or section (e.g. embeddings.top_k)",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			key := args[0]
+			if _, err := config.LookupField(key); err != nil && !config.IsSection(key) {
+				fmt.Println("Errore:", err)
+				return
+			}
+
+			cfg, origins, err := config.LoadLayered()
+			if err != nil {
+				fmt.Println("Errore durante il caricamento della configurazione:", err)
+				return
+			}
+			values, err := config.ToMap(cfg)
+			if err != nil {
+				fmt.Println("Errore durante la lettura della configurazione:", err)
+				return
+			}
+
+			value, ok := config.GetPath(values, key)
+			if !ok {
+				fmt.Printf("%s non è impostata\n", key)
+				return
+			}
+
+			// Una sezione viene mostrata come elenco delle sue chiavi
+			if section, ok := value.(map[string]interface{}); ok {
+				flat := config.Flatten(section)
+				for _, subKey := range config.SortedKeys(flat) {
+					fullKey := key + "." + subKey
+					line := fmt.Sprintf("%s = %s", fullKey, formatConfigValue(fullKey, flat[subKey]))
+					if showOrigin {
+						line += "    (" + describeOrigin(fullKey, origins) + ")"
+					}
+					fmt.Println(line)
+				}
+				return
+			}
+
+			line := formatConfigValue(key, value)
+			if showOrigin {
+				line += "    (" + describeOrigin(key, origins) + ")"
+			}
+			fmt.Println(line)
+		},
+	}
+
+	cmd.Flags().BoolVar(&showOrigin, "origin", false, "Mostra da quale livello proviene il valore")
+
+	return cmd
+}
+
+func configSetCommand() *cobra.Command {
+	var global, local bool
+
+	cmd := &cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "Validate and set a key in the project config (or --global / --local)",
+		Long: `Validate and set a key in the project config (or --global / --local).
+
+Lists accept a JSON array or comma-separated values; booleans accept true/false.
+Run "isy config list" to see every key with its type and constraints.`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			layer, err := selectedLayer(global, local)
+			if err != nil {
+				fmt.Println("Errore:", err)
+				return
+			}
+
+			// Le credenziali non vengono mai scritte in chiaro nei file di configurazione
+			value := args[1]
+			if isSecretKey(args[0]) {
+				if value, err = storeSecretValue(args[0], value); err != nil {
+					fmt.Println("Errore durante il salvataggio del segreto:", err)
+					return
+				}
+			}
+
+			if err := config.SetKey(layer, args[0], value); err != nil {
+				fmt.Println("Errore:", err)
+				return
+			}
+
+			path, _ := config.LayerPath(layer)
+			fmt.Printf("%s impostata in %s\n", args[0], path)
+		},
+	}
+
+	cmd.Flags().BoolVar(&global, "global", false, "Scrive nella configurazione globale dell'utente")
+	cmd.Flags().BoolVar(&local, "local", false, "Scrive nella configurazione locale, ignorata da git")
+
+	return cmd
+}
+
+func configUnsetCommand() *cobra.Command {
+	var global, local bool
+
+	cmd := &cobra.Command{
+		Use:   "unset <key>",
+		Short: "Remove a key or section from the project config (or --global / --local)",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			layer, err := selectedLayer(global, local)
+			if err != nil {
+				fmt.Println("Errore:", err)
+				return
+			}
+
+			removed, err := config.UnsetKey(layer, args[0])
+			if err != nil {
+				fmt.Println("Errore:", err)
+				return
+			}
+
+			path, _ := config.LayerPath(layer)
+			if !removed {
+				fmt.Printf("%s non è impostata in %s\n", args[0], path)
+				return
+			}
+			fmt.Printf("%s rimossa da %s\n", args[0], path)
+		},
+	}
+
+	cmd.Flags().BoolVar(&global, "global", false, "Rimuove dalla configurazione globale dell'utente")
+	cmd.Flags().BoolVar(&local, "local", false, "Rimuove dalla configurazione locale")
+
+	return cmd
+}
+
+func configListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List every configuration key with its type and constraints",
+		Run: func(cmd *cobra.Command, args []string) {
+			for _, field := range config.Schema() {
+				line := fmt.Sprintf("%-32s %-9s", field.Key, field.TypeName())
+				if constraint := field.Constraint(); constraint != "" {
+					line += " " + constraint
+				}
+				fmt.Println(strings.TrimRight(line, " "))
+			}
+		},
+	}
+}
+
+// selectedLayer restituisce il livello indicato dai flag --global e --local
+func selectedLayer(global, local bool) (config.Layer, error) {
+	switch {
+	case global && local:
+		return "", fmt.Errorf("--global e --local non possono essere usati insieme")
+	case global:
+		return config.LayerGlobal, nil
+	case local:
+		return config.LayerLocal, nil
+	default:
+		return config.LayerProject, nil
+	}
+}
+
+// formatConfigValue rende un valore leggibile, mascherando le credenziali
+func formatConfigValue(key string, value interface{}) string {
+	if isSecretKey(key) {
+		// I riferimenti "secret:<nome>" non contengono la credenziale e restano visibili
+		if s, ok := value.(string); ok && s != "" {
+			if _, isRef := secrets.RefName(s); !isRef {
+				return maskSecret(s)
+			}
+		}
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+func isSecretKey(key string) bool {
+	field, err := config.LookupField(key)
+	return err == nil && field.Secret
+}
+
+// maskSecret lascia visibili solo gli ultimi caratteri di una credenziale
+func maskSecret(secret string) string {
+	if len(secret) <= 8 {
+		return `"****"`
+	}
+	return `"****` + secret[len(secret)-4:] + `"`
+}
+
+// describeOrigin indica il livello, e il file o la variabile, da cui proviene una chiave
+func describeOrigin(key string, origins config.Origins) string {
+	layer, ok := origins[key]
+	if !ok {
+		return string(config.LayerDefault)
+	}
+	if layer == config.LayerEnv {
+		return fmt.Sprintf("%s: %s", layer, config.EnvName(key))
+	}
+	path, err := config.LayerPath(layer)
+	if err != nil {
+		return string(layer)
+	}
+	return fmt.Sprintf("%s: %s", layer, path)
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"fmt"
+	"isy-cli/internal/config"
 	"isy-cli/internal/context"
 	"isy-cli/internal/openai"
+	"isy-cli/internal/project"
+	"isy-cli/internal/redact"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -12,20 +15,102 @@ import (
 // ContextCommand definisce il comando CLI per generare il context
 func ContextCommand() *cobra.Command {
 	var verbose bool // Variabile per l'opzione verbose
+	var mode string  // Modalità di resa dei file
+	var explain string
+	var profile string
+	var listProfiles bool
+	var redactPreview bool
 
 	cmd := &cobra.Command{
 		Use:   "context",
 		Short: "Genera un context unificato dai file specificati nel progetto",
 		Run: func(cmd *cobra.Command, args []string) {
-			outputPath := ".isy/last_context" // File dove salvare il contesto
+			opts := context.Options{Mode: mode, Profile: profile}
+
+			// Con --list-profiles elenca soltanto i profili disponibili
+			if listProfiles {
+				cfg, err := config.LoadConfig()
+				if err != nil {
+					fmt.Println("Errore durante il caricamento della configurazione:", err)
+					return
+				}
+				profiles, err := context.ListProfiles(cfg)
+				if err != nil {
+					fmt.Println("Errore durante il caricamento dei profili:", err)
+					return
+				}
+				if len(profiles) == 0 {
+					fmt.Println("Nessun profilo definito. Aggiungi file in .isycontext.d/<nome>.profile o la sezione profiles nella configurazione.")
+					return
+				}
+				for _, p := range profiles {
+					marker := " "
+					if p.Name == cfg.Context.Profile {
+						marker = "*"
+					}
+					fmt.Printf("%s %-16s %s\n", marker, p.Name, p.Description)
+					details := fmt.Sprintf("    origine: %s, regole: %d", p.Source, len(p.Rules.Rules))
+					if p.Mode != "" {
+						details += ", modalità: " + p.Mode
+					}
+					if p.Budget > 0 {
+						details += fmt.Sprintf(", budget: %d token", p.Budget)
+					}
+					fmt.Println(details)
+				}
+				return
+			}
+
+			// Con --explain spiega soltanto la decisione su un percorso
+			if explain != "" {
+				// Il percorso è relativo alla directory da cui è stato lanciato il comando
+				path, err := project.Rel(explain)
+				if err != nil {
+					fmt.Println("Errore durante l'analisi del percorso:", err)
+					return
+				}
+				decision, err := context.ExplainPath(path, opts)
+				if err != nil {
+					fmt.Println("Errore durante l'analisi del percorso:", err)
+					return
+				}
+				status := "escluso"
+				if decision.Included {
+					status = "incluso"
+				}
+				fmt.Printf("%s: %s (%s)\n", explain, status, decision.Reason)
+				return
+			}
+
+			outputPath := project.StatePath("last_context") // File dove salvare il contesto
 
 			// Genera il contesto utilizzando BuildContext
-			contextContent, err := context.BuildContext()
+			contextContent, err := context.BuildContextWithOptions(opts)
 			if err != nil {
 				fmt.Println("Errore durante la generazione del contesto:", err)
 				return
 			}
 
+			// Mostra il contesto così come verrebbe inviato, con i segreti sostituiti
+			if redactPreview {
+				cfg, err := config.LoadConfig()
+				if err != nil {
+					fmt.Println("Errore durante il caricamento della configurazione:", err)
+					return
+				}
+				redactor, err := redact.New(cfg)
+				if err != nil {
+					fmt.Println("Errore durante la preparazione della redazione:", err)
+					return
+				}
+				contextContent = redactor.Redact(contextContent)
+				if summary := redactor.Summary(); summary != "" {
+					fmt.Println(summary)
+				} else {
+					fmt.Println("Redazione: nessun segreto trovato nel contesto")
+				}
+			}
+
 			// Se l'opzione verbose è attiva, stampa il contesto in console
 			if verbose {
 				fmt.Println("\n--- Context Content ---")
@@ -54,6 +139,11 @@ func ContextCommand() *cobra.Command {
 
 	// Aggiungi l'opzione verbose
 	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Stampa il contesto in console")
+	cmd.Flags().StringVar(&profile, "profile", "", "Profilo di contesto da usare (default: context.profile o .isycontext)")
+	cmd.Flags().BoolVar(&listProfiles, "list-profiles", false, "Elenca i profili di contesto disponibili")
+	cmd.Flags().BoolVar(&redactPreview, "redact", false, "Applica la redazione dei segreti e mostra cosa verrebbe sostituito")
+	cmd.Flags().StringVar(&explain, "explain", "", "Spiega quale regola include o esclude il percorso indicato")
+	cmd.Flags().StringVar(&mode, "mode", "", "Modalità del contesto: full oppure outline (default: context.mode)")
 
 	return cmd
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	codeUtils "isy-cli/internal/code"
+	"isy-cli/internal/diff"
+	"isy-cli/internal/project"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+// DiffCommand mostra le modifiche di un branch virtuale rispetto al progetto
+func DiffCommand() *cobra.Command {
+	var patch bool
+
+	cmd := &cobra.Command{
+		Use:   "diff [branch]",
+		Short: "Show the changes of a virtual branch (default: the most recent one)",
+		Long:  "Show the changes of a virtual branch against the project. With --patch only the unified diff is printed, ready for git apply or patch -p1.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			branchesDir := project.StatePath("branches")
+
+			branch := ""
+			if len(args) == 1 {
+				branch = args[0]
+			} else {
+				branches, err := codeUtils.ListBranchesSortedByDate(branchesDir)
+				if err != nil && !os.IsNotExist(errors.Unwrap(err)) {
+					exitWithError(outputText, "Errore durante la lettura dei branch:", err)
+				}
+				if len(branches) == 0 {
+					exitWithError(outputText, "Nessun branch trovato:", fmt.Errorf("crea un branch con isy code"))
+				}
+				branch = branches[0]
+			}
+
+			branchDir := filepath.Join(branchesDir, branch)
+			if info, err := os.Stat(branchDir); err != nil || !info.IsDir() {
+				exitWithError(outputText, "Branch non valido:", fmt.Errorf("il branch %s non esiste", branch))
+			}
+
+			files, err := diff.Trees(project.Root(), branchDir)
+			if err != nil {
+				exitWithError(outputText, "Errore durante il confronto con il progetto:", err)
+			}
+
+			// La patch va su stdout da sola, così può essere salvata o passata a git apply
+			fmt.Print(diff.Patch(files, 3))
+			if patch {
+				return
+			}
+			if len(files) == 0 {
+				fmt.Printf("Il branch %s non ha modifiche rispetto al progetto.\n", branch)
+				return
+			}
+			fmt.Printf("\n%d file modificati nel branch %s:\n%s", len(files), branch, diff.Summary(files))
+		},
+	}
+
+	cmd.Flags().BoolVar(&patch, "patch", false, "Stampa solo la patch unified diff, senza riepilogo")
+
+	return cmd
+}
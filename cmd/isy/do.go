@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"isy-cli/internal/commands"
+	"isy-cli/internal/config"
+	"isy-cli/internal/project"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// DoCommand raccoglie come sottocomandi i comandi definiti dal progetto in
+// .isy/commands. I file vengono letti prima che cobra analizzi gli argomenti,
+// da dir.
+func DoCommand(dir string) *cobra.Command {
+	templates, errs := commands.LoadAll(dir)
+
+	cmd := &cobra.Command{
+		Use:   "do <command> [flags]",
+		Short: "Run a command defined by the project in .isy/commands",
+		Long: `Run a command defined by the project. Each file .isy/commands/<name>.yaml
+describes a recurring task: a prompt template, its variables (passed as
+--<variable>), a context profile, a model and a type, ask for an answer or code
+for modifications on a virtual branch. For example:
+
+  description: Write table-driven tests for a package
+  type: code
+  profile: backend
+  variables:
+    - name: target
+      description: Package to test
+      required: true
+  prompt: |
+    Write table-driven tests for the package {{.target}}.
+
+  isy do testgen --target pkg/foo --apply`,
+		Run: func(cmd *cobra.Command, args []string) {
+			for _, err := range errs {
+				fmt.Fprintln(os.Stderr, "Errore:", err)
+			}
+			if len(args) > 0 {
+				fmt.Printf("Comando %s non trovato in %s.\n", args[0], dir)
+				return
+			}
+			if len(templates) == 0 {
+				fmt.Printf("Nessun comando definito: aggiungi un file .yaml in %s.\n", dir)
+				return
+			}
+			cmd.Help()
+		},
+	}
+
+	for _, t := range templates {
+		cmd.AddCommand(templateCommand(t))
+	}
+	return cmd
+}
+
+// templateCommand esegue un comando del progetto come isy ask o isy code con
+// un singolo task, ricavato dal prompt del comando
+func templateCommand(t *commands.Template) *cobra.Command {
+	values := make(map[string]*string)
+	var output, branch string
+	var apply bool
+
+	short := t.Description
+	if short == "" {
+		short = fmt.Sprintf("Project %s command defined in %s", t.Type, filepath.Base(t.Path))
+	}
+
+	cmd := &cobra.Command{
+		Use:   t.Name,
+		Short: short,
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			variables := make(map[string]string)
+			for name, value := range values {
+				variables[name] = *value
+			}
+			prompt, err := t.Render(variables)
+			if err != nil {
+				exitWithError(output, "Errore:", err)
+			}
+
+			target := AskCommand()
+			flags := []string{"--output", output}
+			// Il modello del comando sostituisce quello dei file di configurazione,
+			// ma non quello scelto dall'utente con ISY_MODEL
+			if _, ok := os.LookupEnv(config.EnvName("model")); t.Model != "" && !ok {
+				flags = append(flags, "--model", t.Model)
+			}
+			if t.Type == commands.TypeCode {
+				target = CodeCommand()
+				if branch != "" {
+					flags = append(flags, "--branch", branch)
+				}
+				if apply {
+					flags = append(flags, "--apply")
+				}
+			}
+			if t.Profile != "" {
+				flags = append(flags, "--profile", t.Profile)
+			}
+			if err := target.ParseFlags(flags); err != nil {
+				exitWithError(output, "Errore:", err)
+			}
+			target.Run(target, []string{prompt})
+		},
+	}
+
+	for _, variable := range t.Variables {
+		values[variable.Name] = cmd.Flags().String(variable.Name, variable.Default, variable.Description)
+		if variable.Required && variable.Default == "" {
+			cmd.MarkFlagRequired(variable.Name)
+		}
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", outputText, "Formato del risultato: text o json")
+	if t.Type == commands.TypeCode {
+		cmd.Flags().StringVarP(&branch, "branch", "b", "", "Branch virtuale da usare o creare (default: nuovo)")
+		cmd.Flags().BoolVar(&apply, "apply", false, "Applica al branch le modifiche proposte")
+	}
+	return cmd
+}
+
+// commandsDir individua la directory dei comandi del progetto dagli argomenti,
+// come farà project.Setup: i sottocomandi di do vanno registrati prima che
+// cobra li analizzi
+func commandsDir(args []string) string {
+	root := ""
+	for i, arg := range args {
+		switch {
+		case arg == "--root" && i+1 < len(args):
+			root = args[i+1]
+		case strings.HasPrefix(arg, "--root="):
+			root = strings.TrimPrefix(arg, "--root=")
+		}
+	}
+	if root == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			cwd = "."
+		}
+		root = cwd
+		if found, ok := project.Discover(cwd); ok {
+			root = found
+		}
+	}
+	return filepath.Join(root, project.DirName, commands.Dir)
+}
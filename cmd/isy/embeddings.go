@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"isy-cli/internal/context"
+	"isy-cli/internal/embeddings"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// EmbeddingsCommand raggruppa i comandi per l'indice semantico
+func EmbeddingsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "embeddings",
+		Short: "Manage the semantic index of the files in .isycontext",
+	}
+
+	cmd.AddCommand(embeddingsIndexCommand())
+	cmd.AddCommand(embeddingsSearchCommand())
+	cmd.AddCommand(embeddingsServeCommand())
+
+	return cmd
+}
+
+func embeddingsIndexCommand() *cobra.Command {
+	var profile string
+
+	cmd := &cobra.Command{
+		Use:   "index",
+		Short: "Chunk and embed the files in .isycontext, reusing unchanged chunks",
+		Run: func(cmd *cobra.Command, args []string) {
+			stats, err := context.UpdateEmbeddingIndex(context.Options{Profile: profile})
+			if err != nil {
+				fmt.Println("Errore durante l'indicizzazione:", err)
+				return
+			}
+
+			fmt.Printf("File indicizzati: %d\n", stats.Files)
+			fmt.Printf("Chunk totali: %d (nuovi: %d, riutilizzati: %d)\n", stats.Chunks, stats.Embedded, stats.Reused)
+		},
+	}
+
+	cmd.Flags().StringVar(&profile, "profile", "", "Profilo di contesto da indicizzare")
+
+	return cmd
+}
+
+func embeddingsSearchCommand() *cobra.Command {
+	var topK int
+	var profile string
+
+	cmd := &cobra.Command{
+		Use:   "search <query>",
+		Short: "Show the chunks nearest to a query",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			query := strings.Join(args, " ")
+
+			results, err := context.SemanticSearch(query, topK, context.Options{Profile: profile})
+			if err != nil {
+				fmt.Println("Errore durante la ricerca semantica:", err)
+				return
+			}
+
+			for _, result := range results {
+				fmt.Printf("%.4f  %s:%d-%d\n", result.Score, result.Path, result.StartLine, result.EndLine)
+			}
+		},
+	}
+
+	cmd.Flags().IntVarP(&topK, "top", "k", 0, "Numero di risultati (default: embeddings.top_k)")
+	cmd.Flags().StringVar(&profile, "profile", "", "Profilo di contesto in cui cercare")
+
+	return cmd
+}
+
+func embeddingsServeCommand() *cobra.Command {
+	var addr string
+	var dimensions int
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run a local OpenAI-compatible embeddings server backed by the hashing embedder",
+		Long: `Run a local stand-in for the OpenAI embeddings endpoint, backed by the deterministic
+hashing embedder. Point embeddings.base_url at it to exercise the whole flow offline.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			embedder := embeddings.NewHashEmbedder(dimensions)
+
+			fmt.Printf("Server di embedding in ascolto su http://%s/v1 (%s)\n", addr, embedder.Name())
+			if err := http.ListenAndServe(addr, embeddings.NewServer(embedder)); err != nil {
+				fmt.Println("Errore del server di embedding:", err)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&addr, "addr", "127.0.0.1:8089", "Indirizzo di ascolto")
+	cmd.Flags().IntVar(&dimensions, "dimensions", embeddings.DefaultDimensions, "Dimensione dei vettori")
+
+	return cmd
+}
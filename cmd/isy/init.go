@@ -7,11 +7,44 @@ import (
 )
 
 func InitCommand() *cobra.Command {
-	return &cobra.Command{
+	var opts config.InitOptions
+	var gitignore, noGitignore bool
+
+	cmd := &cobra.Command{
 		Use:   "init",
 		Short: "Initialize the project",
+		Long: `Initialize the project.
+
+Language and framework are detected from marker files (go.mod, package.json,
+pyproject.toml, Cargo.toml, ...) and used to generate a default .isycontext.
+Answers can be given with flags or an answers file (JSON, same keys as the
+config plus "gitignore"), so init can run in CI without prompts.
+
+Re-initializing an existing project (--force) only rewrites the files init
+generates: config.json and, when missing, .isycontext and the .gitignore
+entries. Branches, sessions, the apply journal, commands, policy and local
+config are kept; --wipe deletes the whole .isy directory first.`,
 		Run: func(cmd *cobra.Command, args []string) {
-			config.InitProject()
+			if gitignore || noGitignore {
+				opts.Gitignore = &gitignore
+			}
+			config.InitProject(opts)
 		},
 	}
+
+	cmd.Flags().StringVar(&opts.ProjectName, "name", "", "Nome del progetto")
+	cmd.Flags().StringVar(&opts.Author, "author", "", "Nome dell'autore o dell'azienda")
+	cmd.Flags().StringVar(&opts.LanguageAndFramework, "stack", "", "Linguaggio e/o framework (default: rilevato)")
+	cmd.Flags().StringVar(&opts.Description, "description", "", "Descrizione del progetto")
+	cmd.Flags().StringVar(&opts.APIKey, "api-key", "", "OpenAI API Key, salvata nello store dei segreti")
+	cmd.Flags().StringVar(&opts.ResponseLanguage, "language", "", "Lingua delle risposte (it, en, ecc)")
+	cmd.Flags().StringVar(&opts.AnswersFile, "answers", "", "File JSON con le risposte")
+	cmd.Flags().BoolVarP(&opts.NonInteractive, "yes", "y", false, "Nessun prompt: usa i valori rilevati per le risposte mancanti")
+	cmd.Flags().BoolVar(&opts.Force, "force", false, "Reinizializza anche se .isy esiste già, riscrivendo solo config.json")
+	cmd.Flags().BoolVar(&opts.Wipe, "wipe", false, "Cancella l'intera directory .isy (branch, sessioni, journal, comandi, policy) prima di reinizializzare")
+	cmd.Flags().BoolVar(&gitignore, "gitignore", false, "Aggiunge a .gitignore i file di stato di .isy (branch, sessioni, journal)")
+	cmd.Flags().BoolVar(&noGitignore, "no-gitignore", false, "Non modifica .gitignore")
+	cmd.MarkFlagsMutuallyExclusive("gitignore", "no-gitignore")
+
+	return cmd
 }
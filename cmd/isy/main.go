@@ -2,24 +2,96 @@ package main
 
 import (
 	"fmt"
+	"isy-cli/internal/hooks"
+	"isy-cli/internal/operations"
+	"isy-cli/internal/project"
+	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
 )
 
 func main() {
+	var root string
+
 	var rootCmd = &cobra.Command{
 		Use:   "isy",
 		Short: "isy is your AI-powered coding assistant",
 		Long:  "isy is a CLI tool to help you manage and edit your codebase with the power of OpenAI.",
+		// Individua la radice del progetto risalendo fino alla directory .isy più vicina,
+		// così isy funziona da qualsiasi sottodirectory. init la crea nella directory corrente.
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := project.Setup(root, cmd.Name() != "init"); err != nil {
+				return err
+			}
+			recoverInterruptedApply()
+			return nil
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			runAfterRunHooks(commandName(cmd), args)
+		},
 	}
+	rootCmd.PersistentFlags().StringVar(&root, "root", "", "Radice del progetto (default: la directory .isy più vicina)")
 
 	// Aggiungi i comandi disponibili
 	rootCmd.AddCommand(InitCommand())
 	rootCmd.AddCommand(AskCommand())
 	rootCmd.AddCommand(CodeCommand())
+	rootCmd.AddCommand(DiffCommand())
+	rootCmd.AddCommand(DoCommand(commandsDir(os.Args[1:])))
 	rootCmd.AddCommand(ContextCommand()) // Aggiunto il comando context
+	rootCmd.AddCommand(EmbeddingsCommand())
+	rootCmd.AddCommand(SymbolsCommand())
+	rootCmd.AddCommand(RefsCommand())
+	rootCmd.AddCommand(ConfigCommand())
+	rootCmd.AddCommand(SecretsCommand())
+	rootCmd.AddCommand(TrustCommand())
+	rootCmd.AddCommand(SessionsCommand())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
 	}
 }
+
+// recoverInterruptedApply annulla le modifiche rimaste a metà da un'applicazione
+// interrotta (crash o Ctrl+C), usando il journal in .isy
+func recoverInterruptedApply() {
+	if !project.Found() {
+		return
+	}
+	recovered, err := operations.Recover()
+	for _, dir := range recovered {
+		if rel, err := filepath.Rel(project.Root(), dir); err == nil {
+			dir = rel
+		}
+		fmt.Fprintf(os.Stderr, "Applicazione delle modifiche interrotta: %s riportato allo stato precedente.\n", dir)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Errore durante il ripristino delle modifiche interrotte:", err)
+	}
+}
+
+// commandName restituisce il comando di isy di primo livello, es. "do" per
+// "isy do testgen" o "config" per "isy config set": è il nome che gli hook
+// ricevono e che filtrano con commands
+func commandName(cmd *cobra.Command) string {
+	for cmd.HasParent() && cmd.Parent().HasParent() {
+		cmd = cmd.Parent()
+	}
+	return cmd.Name()
+}
+
+// runAfterRunHooks esegue gli hook after_run al termine di un comando. Gli
+// errori vengono solo segnalati: il comando è già concluso.
+func runAfterRunHooks(command string, args []string) {
+	if !project.Found() {
+		return
+	}
+	runner, err := hooks.Load(command, os.Stderr)
+	if err == nil {
+		err = runner.Run(hooks.AfterRun, &hooks.RunData{Args: args})
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Errore negli hook after_run:", err)
+	}
+}
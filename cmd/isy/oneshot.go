@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	localOpenAI "isy-cli/internal/openai"
+	"os"
+	"strings"
+)
+
+// Formati di --output per l'esecuzione non interattiva di ask e code
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// turnUsage è il consumo di token e il costo di una richiesta
+type turnUsage struct {
+	InputTokens  int64    `json:"input_tokens"`
+	OutputTokens int64    `json:"output_tokens"`
+	Cost         *float64 `json:"cost"` // nil se la richiesta ha usato un modello senza prezzo
+}
+
+// usageSince calcola il consumo dall'istante in cui è stato letto start
+func usageSince(start localOpenAI.TokenUsage) turnUsage {
+	end, err := localOpenAI.LoadTokenUsage()
+	if err != nil {
+		return turnUsage{}
+	}
+	usage := turnUsage{
+		InputTokens:  end.TokenInput - start.TokenInput,
+		OutputTokens: end.TokenOutput - start.TokenOutput,
+	}
+	if end.UnpricedTokens == start.UnpricedTokens {
+		cost := end.TotalCost - start.TotalCost
+		usage.Cost = &cost
+	}
+	return usage
+}
+
+// formatCost rende un costo in USD. Se alcune richieste hanno usato modelli
+// senza prezzo il costo è sconosciuto, o noto solo in parte.
+func formatCost(cost float64, unknown bool) string {
+	switch {
+	case !unknown:
+		return fmt.Sprintf("%.4f", cost)
+	case cost > 0:
+		return fmt.Sprintf("almeno %.4f (prezzo di alcuni modelli sconosciuto)", cost)
+	default:
+		return "sconosciuto (prezzo del modello non noto)"
+	}
+}
+
+// checkOutput verifica il valore di --output
+func checkOutput(output string) error {
+	if output != outputText && output != outputJSON {
+		return fmt.Errorf("formato di output non valido %q: usa %s o %s", output, outputText, outputJSON)
+	}
+	return nil
+}
+
+// readPipedInput legge l'input rediretto su stdin, es. "go test ./... 2>&1 | isy ask ...".
+// Se stdin è un terminale restituisce "".
+func readPipedInput() (string, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice != 0 {
+		return "", nil
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("errore durante la lettura di stdin: %v", err)
+	}
+	return string(data), nil
+}
+
+// withPipedInput accoda alla richiesta l'input letto da stdin
+func withPipedInput(request, input string) string {
+	if strings.TrimSpace(input) == "" {
+		return request
+	}
+	if !strings.HasSuffix(input, "\n") {
+		input += "\n"
+	}
+	return request + "\n\n----- STDIN -----\n" + input + "----- END STDIN -----\n"
+}
+
+// writeJSON stampa il risultato di un'esecuzione non interattiva
+func writeJSON(value interface{}) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		exitWithError(outputJSON, "Errore durante la serializzazione del risultato:", err)
+	}
+	fmt.Println(string(data))
+}
+
+// exitWithError termina un'esecuzione non interattiva con un codice di uscita
+// diverso da zero; con --output json anche l'errore è un oggetto JSON
+func exitWithError(output, message string, err error) {
+	if output == outputJSON {
+		data, _ := json.Marshal(map[string]string{"error": strings.TrimSpace(message + " " + err.Error())})
+		fmt.Println(string(data))
+	} else {
+		fmt.Fprintln(os.Stderr, message, err)
+	}
+	os.Exit(1)
+}
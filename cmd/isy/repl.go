@@ -0,0 +1,652 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	codeUtils "isy-cli/internal/code"
+	"isy-cli/internal/context"
+	"isy-cli/internal/conversation"
+	"isy-cli/internal/diff"
+	"isy-cli/internal/hooks"
+	"isy-cli/internal/lineedit"
+	localOpenAI "isy-cli/internal/openai"
+	"isy-cli/internal/openai/schemas/code"
+	"isy-cli/internal/operations"
+	"isy-cli/internal/policy"
+	"isy-cli/internal/project"
+	"isy-cli/internal/sessions"
+	"isy-cli/internal/tools"
+	"isy-cli/internal/verify"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// replSession è lo stato condiviso dalle sessioni interattive di ask e code
+type replSession struct {
+	settings *context.Settings
+	opts     context.Options
+	conv     *conversation.Conversation
+	files    []string            // File aggiunti con /add, inviati a ogni richiesta
+	log      []conversation.Turn // Trascrizione completa, anche dei turni compattati
+	start    localOpenAI.TokenUsage
+	out      io.Writer            // Avvisi (contesto aggiornato, compattazione): stderr senza REPL
+	tools    *tools.Toolbox       // Funzioni che il modello può chiamare (nil = disattivate)
+	hooks    *hooks.Runner        // Hook dell'utente (nil = nessuno)
+	symbols  *context.SymbolIndex // Indice dei simboli, ricostruito quando cambiano i file
+
+	session *sessions.Session // Solo ask: la sessione salvata
+
+	branch  string                         // Solo code: directory del branch
+	pending *code.CodeModificationResponse // Solo code: ultima proposta non applicata
+	request string                         // Solo code: richiesta da cui è nata la proposta, per la storia del branch
+	policy  *policy.Policy                 // Solo code: limiti alle modifiche del modello
+	editor  *lineedit.Editor               // Solo code: conferme chieste dalla policy (nil senza REPL)
+	applied []*operations.Change           // Solo code: modifiche applicate, per /undo
+}
+
+// replCommand è un comando della sessione interattiva, es. /add
+type replCommand struct {
+	name     string
+	usage    string
+	help     string
+	codeOnly bool
+	run      func(r *replSession, args []string)
+}
+
+var replCommands = []replCommand{
+	{name: "add", usage: "/add <file>...", help: "Aggiunge file (anche glob) a ogni richiesta", run: (*replSession).add},
+	{name: "drop", usage: "/drop [file]...", help: "Toglie file aggiunti con /add (senza argomenti: tutti)", run: (*replSession).drop},
+	{name: "context", usage: "/context", help: "Mostra contesto, file aggiunti e token della conversazione", run: (*replSession).showContext},
+	{name: "cost", usage: "/cost", help: "Mostra token e costo della sessione", run: (*replSession).showCost},
+	{name: "model", usage: "/model [nome]", help: "Mostra o cambia il modello per questa sessione", run: (*replSession).model},
+	{name: "clear", usage: "/clear", help: "Ricomincia la conversazione (i file aggiunti restano)", run: (*replSession).clear},
+	{name: "save", usage: "/save [file]", help: "Salva la sessione o ne esporta la trascrizione in Markdown", run: (*replSession).save},
+	{name: "undo", usage: "/undo", help: "Annulla l'ultima modifica applicata (in ask: l'ultimo scambio)", run: (*replSession).undo},
+	{name: "apply", usage: "/apply", help: "Applica al branch le modifiche proposte", codeOnly: true, run: (*replSession).apply},
+	{name: "diff", usage: "/diff [branch]", help: "Mostra le modifiche proposte o quelle del branch", codeOnly: true, run: (*replSession).diff},
+	{name: "history", usage: "/history", help: "Mostra le modifiche applicate al branch e l'esito dei controlli", codeOnly: true, run: (*replSession).history},
+}
+
+// handleCommand esegue un comando se l'input inizia con "/" e restituisce true
+func (r *replSession) handleCommand(input string) bool {
+	input = strings.TrimSpace(input)
+	if !strings.HasPrefix(input, "/") {
+		return false
+	}
+	fields := strings.Fields(strings.TrimPrefix(input, "/"))
+	if len(fields) == 0 {
+		return false
+	}
+	name, args := fields[0], fields[1:]
+
+	if name == "help" {
+		r.help()
+		return true
+	}
+	for _, command := range replCommands {
+		if command.name != name {
+			continue
+		}
+		if command.codeOnly && r.branch == "" {
+			fmt.Printf("/%s è disponibile solo in isy code.\n", name)
+			return true
+		}
+		command.run(r, args)
+		return true
+	}
+	fmt.Printf("Comando sconosciuto: /%s (usa /help per l'elenco)\n", name)
+	return true
+}
+
+func (r *replSession) help() {
+	fmt.Println("Comandi disponibili:")
+	for _, command := range replCommands {
+		if command.codeOnly && r.branch == "" {
+			continue
+		}
+		fmt.Printf("  %-16s %s\n", command.usage, command.help)
+	}
+	fmt.Printf("  %-16s %s\n", "/help", "Mostra questo elenco")
+	fmt.Println(`Per scrivere su più righe termina la riga con \ oppure racchiudi il testo tra due righe """.`)
+}
+
+// requestExtra restituisce il codice da anteporre alla richiesta: i file
+// aggiunti con /add e quello recuperato per la richiesta
+func (r *replSession) requestExtra(userInput string) (string, error) {
+	extra, err := buildRequestContext(r.settings, r.opts, r.symbols, userInput)
+	if err != nil {
+		return "", err
+	}
+	if len(r.files) == 0 {
+		return extra, nil
+	}
+
+	// I file aggiunti esplicitamente vengono inviati per intero
+	full := *r.settings
+	full.Mode = context.ModeFull
+	full.Budget = 0
+	added, err := context.MergeFiles(&full, r.files)
+	if err != nil {
+		return "", err
+	}
+	return "----- FILES ADDED BY THE USER -----\n\n" + added + "----- END FILES ADDED BY THE USER -----\n\n" + extra, nil
+}
+
+// record aggiunge uno scambio alla trascrizione
+func (r *replSession) record(userInput, response string) {
+	r.log = append(r.log,
+		conversation.Turn{Role: "user", Content: userInput},
+		conversation.Turn{Role: "assistant", Content: response})
+}
+
+func (r *replSession) add(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Uso: /add <file>...")
+		return
+	}
+	for _, arg := range args {
+		rel, err := project.Rel(arg)
+		if err != nil {
+			fmt.Println("Errore:", err)
+			continue
+		}
+		matches, _ := filepath.Glob(rel)
+		found := false
+		for _, match := range matches {
+			if info, err := os.Stat(match); err != nil || info.IsDir() {
+				continue
+			}
+			found = true
+			if containsString(r.files, match) {
+				continue
+			}
+			r.files = append(r.files, match)
+			fmt.Println("Aggiunto:", match)
+		}
+		if !found {
+			fmt.Println("Nessun file corrisponde a", arg)
+		}
+	}
+}
+
+func (r *replSession) drop(args []string) {
+	if len(args) == 0 {
+		r.files = nil
+		fmt.Println("Tutti i file aggiunti sono stati rimossi.")
+		return
+	}
+	for _, arg := range args {
+		rel, err := project.Rel(arg)
+		if err != nil {
+			fmt.Println("Errore:", err)
+			continue
+		}
+		var kept []string
+		for _, file := range r.files {
+			if matched, _ := filepath.Match(rel, file); !matched {
+				kept = append(kept, file)
+			}
+		}
+		if len(kept) == len(r.files) {
+			fmt.Println("File non aggiunto:", arg)
+			continue
+		}
+		r.files = kept
+		fmt.Println("Rimosso:", arg)
+	}
+}
+
+func (r *replSession) showContext(args []string) {
+	fmt.Printf("Modello: %s\n", localOpenAI.ChatModel(r.settings.Config))
+	if r.settings.Profile != nil && r.settings.Profile.Name != "" {
+		fmt.Printf("Profilo: %s\n", r.settings.Profile.Name)
+	}
+	if r.branch != "" {
+		fmt.Printf("Branch: %s\n", r.branch)
+	}
+	fmt.Printf("Contesto del progetto: %d token\n", localOpenAI.CountTokens(r.conv.Context))
+	fmt.Printf("Conversazione: %d messaggi, %d token in totale", len(r.conv.Turns), r.conv.Tokens())
+	if r.conv.Options.Disabled {
+		fmt.Println(" (compattazione disattivata)")
+	} else {
+		fmt.Printf(" (compattazione oltre %d)\n", r.conv.Threshold())
+	}
+	if r.conv.Summary != "" {
+		fmt.Printf("Riassunto dei turni compattati: %d token\n", localOpenAI.CountTokens(r.conv.Summary))
+	}
+	if len(r.files) == 0 {
+		fmt.Println("Nessun file aggiunto con /add.")
+		return
+	}
+	fmt.Println("File aggiunti:")
+	for _, file := range r.files {
+		content, _ := os.ReadFile(file)
+		fmt.Printf("  %s (%d token)\n", file, localOpenAI.CountTokens(string(content)))
+	}
+}
+
+func (r *replSession) showCost(args []string) {
+	current, err := localOpenAI.LoadTokenUsage()
+	if err != nil {
+		fmt.Println("Errore caricando uso token:", err)
+		return
+	}
+	fmt.Printf("Token di input usati finora: %d\n", current.TokenInput-r.start.TokenInput)
+	fmt.Printf("Token di output usati finora: %d\n", current.TokenOutput-r.start.TokenOutput)
+	fmt.Printf("Costo finora (USD): %s\n", formatCost(current.TotalCost-r.start.TotalCost, current.UnpricedTokens > r.start.UnpricedTokens))
+	if r.session != nil {
+		fmt.Printf("Costo totale della sessione %s (USD): %s\n", r.session.ID, formatCost(r.session.Cost, r.session.CostUnknown))
+	}
+}
+
+func (r *replSession) model(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Modello:", localOpenAI.ChatModel(r.settings.Config))
+		return
+	}
+	if len(args) > 1 {
+		fmt.Println("Uso: /model [nome]")
+		return
+	}
+	if err := overrideModel(r.settings, args[0]); err != nil {
+		fmt.Println("Errore:", err)
+		return
+	}
+	fmt.Printf("Modello impostato a %s per questa sessione.\n", r.settings.Config.Model)
+}
+
+func (r *replSession) clear(args []string) {
+	r.conv.Turns = nil
+	r.conv.Summary = ""
+	r.pending = nil
+
+	if r.session != nil {
+		// La sessione precedente resta salvata; le nuove domande ne aprono un'altra
+		if len(r.session.Messages) > 0 {
+			fmt.Printf("Sessione %s salvata.\n", r.session.ID)
+		}
+		session, err := sessions.New(localOpenAI.ChatModel(r.settings.Config), r.session.Profile)
+		if err != nil {
+			fmt.Println("Errore durante la creazione della sessione:", err)
+			return
+		}
+		session.ContextHash = r.conv.ContextHash
+		r.session = session
+	}
+	r.log = nil
+	fmt.Println("Conversazione ricominciata.")
+}
+
+func (r *replSession) save(args []string) {
+	if len(args) == 0 {
+		if r.session == nil {
+			fmt.Println("Uso: /save <file> (esporta la trascrizione in Markdown)")
+			return
+		}
+		if len(r.session.Messages) == 0 {
+			fmt.Println("Niente da salvare: la sessione è vuota.")
+			return
+		}
+		syncCompaction(r.session, r.conv)
+		if err := r.session.Save(); err != nil {
+			fmt.Println("Errore durante il salvataggio della sessione:", err)
+			return
+		}
+		fmt.Printf("Sessione salvata: %s\n", r.session.ID)
+		return
+	}
+
+	// Il percorso è relativo alla directory da cui è stato lanciato il comando
+	path := args[0]
+	if !filepath.IsAbs(path) {
+		path = project.Path(filepath.FromSlash(project.Subdir()), path)
+	}
+	if err := os.WriteFile(path, []byte(r.transcript()), 0644); err != nil {
+		fmt.Println("Errore durante il salvataggio della trascrizione:", err)
+		return
+	}
+	fmt.Println("Trascrizione salvata in", args[0])
+}
+
+// transcript restituisce la conversazione in Markdown
+func (r *replSession) transcript() string {
+	var builder strings.Builder
+	title := "isy ask"
+	if r.branch != "" {
+		title = "isy code"
+	}
+	builder.WriteString("# " + title + "\n")
+	for _, turn := range r.log {
+		speaker := "You"
+		if turn.Role == "assistant" {
+			speaker = "Assistant"
+		}
+		builder.WriteString(fmt.Sprintf("\n## %s\n\n%s\n", speaker, turn.Content))
+	}
+	return builder.String()
+}
+
+func (r *replSession) undo(args []string) {
+	if r.branch != "" {
+		if len(r.applied) == 0 {
+			fmt.Println("Nessuna modifica applicata da annullare.")
+			return
+		}
+		change := r.applied[len(r.applied)-1]
+		if err := change.Undo(); err != nil {
+			fmt.Println("Errore durante l'annullamento:", err)
+			return
+		}
+		r.applied = r.applied[:len(r.applied)-1]
+		fmt.Printf("Modifiche annullate: %s\n", strings.Join(change.Files, ", "))
+		return
+	}
+
+	// In ask annulla l'ultimo scambio
+	if len(r.conv.Turns) < 2 || len(r.log) < 2 {
+		fmt.Println("Nessuno scambio da annullare.")
+		return
+	}
+	r.conv.Turns = r.conv.Turns[:len(r.conv.Turns)-2]
+	r.log = r.log[:len(r.log)-2]
+	if r.session != nil && len(r.session.Messages) >= 2 {
+		r.session.Messages = r.session.Messages[:len(r.session.Messages)-2]
+		syncCompaction(r.session, r.conv)
+		if err := r.session.Save(); err != nil {
+			fmt.Println("Errore durante il salvataggio della sessione:", err)
+		}
+	}
+	fmt.Println("Ultimo scambio annullato.")
+}
+
+func (r *replSession) apply(args []string) {
+	if r.pending == nil {
+		fmt.Println("Nessuna modifica proposta da applicare.")
+		return
+	}
+	change, results, err := r.applyPending()
+	if errors.Is(err, errNotConfirmed) {
+		fmt.Println("Modifiche non applicate: usa /diff per rivederle o chiedi una modifica diversa.")
+		return
+	}
+	if err != nil {
+		fmt.Println("Errore durante l'applicazione delle modifiche:", err)
+		return
+	}
+	if len(change.Files) > 0 {
+		r.applied = append(r.applied, change)
+	}
+	fmt.Printf("Modifiche applicate al branch: %s\n", strings.Join(change.Files, ", "))
+	for _, note := range change.Notes {
+		fmt.Println("  nota:", note)
+	}
+
+	if len(results) == 0 {
+		return
+	}
+	fmt.Printf("Controlli:\n%s", verify.Summary(results))
+	if !verify.Failed(results) {
+		return
+	}
+	fmt.Print(results[len(results)-1].Output)
+	if !r.settings.Config.Verify.Feedback {
+		fmt.Println("Descrivi la correzione da fare o usa /undo per annullare le modifiche.")
+		return
+	}
+
+	// La correzione resta una proposta, da rivedere e applicare come le altre
+	fmt.Println("Controlli falliti: richiesta di correzione al modello.")
+	request := r.request
+	response, _, err := r.codeTurn(verify.Report(results))
+	if err != nil {
+		fmt.Println(codeTurnFailure(err), err)
+		return
+	}
+	r.request = correctionRequest(request)
+	printProposal(response)
+}
+
+// errNotConfirmed indica che l'utente non ha confermato le modifiche ai
+// percorsi per cui la policy chiede una conferma
+var errNotConfirmed = errors.New("modifiche non confermate")
+
+// applyPending applica al branch la proposta in attesa ed esegue i controlli.
+// Gli hook before_apply possono cambiarla, e viene controllata di nuovo; la
+// policy può chiedere una conferma, che senza REPL non si può dare; gli hook
+// after_apply possono bloccare le modifiche applicate, che vengono annullate.
+func (r *replSession) applyPending() (*operations.Change, []verify.Result, error) {
+	paths, planErr := operations.Touched(r.branch, *r.pending)
+	if planErr != nil {
+		return nil, nil, planErr
+	}
+	data := hooks.ApplyData{Branch: r.branch, Files: paths, Response: *r.pending}
+	if err := r.hooks.Run(hooks.BeforeApply, &data); err != nil {
+		return nil, nil, err
+	}
+	response := data.Response
+	if !reflect.DeepEqual(response, *r.pending) {
+		if planErr := operations.Validate(r.branch, response, r.policy); planErr != nil {
+			return nil, nil, fmt.Errorf("modifiche cambiate da un hook before_apply: %v", planErr)
+		}
+		if paths, planErr = operations.Touched(r.branch, response); planErr != nil {
+			return nil, nil, planErr
+		}
+	}
+
+	if confirm := r.policy.NeedsConfirmation(paths); len(confirm) > 0 {
+		if r.editor == nil {
+			return nil, nil, fmt.Errorf("la policy del progetto richiede una conferma per %s: applica le modifiche da isy code senza task", strings.Join(confirm, ", "))
+		}
+		fmt.Printf("La policy del progetto richiede una conferma per: %s\n", strings.Join(confirm, ", "))
+		if !r.editor.Confirm("Applicare le modifiche?") {
+			return nil, nil, errNotConfirmed
+		}
+	}
+
+	// Apply è una transazione: se fallisce il branch resta com'era
+	change, err := operations.Apply(r.branch, response)
+	if err != nil {
+		return nil, nil, err
+	}
+	applied := hooks.AppliedData{Branch: r.branch, Files: change.Files, Notes: change.Notes}
+	if err := r.hooks.Run(hooks.AfterApply, &applied); err != nil {
+		if undoErr := change.Undo(); undoErr != nil {
+			return nil, nil, fmt.Errorf("%v; annullamento non riuscito: %v", err, undoErr)
+		}
+		return nil, nil, fmt.Errorf("%v: le modifiche sono state annullate", err)
+	}
+	r.pending = nil
+	return change, r.verifyChange(change), nil
+}
+
+// verifyChange esegue i controlli sulle modifiche applicate e le registra
+// nella storia del branch
+func (r *replSession) verifyChange(change *operations.Change) []verify.Result {
+	results := verify.Run(r.branch, r.settings.Config.Verify, change.Files, r.out)
+	entry := codeUtils.HistoryEntry{Time: time.Now(), Request: r.request, Files: change.Files, Checks: results}
+	if err := codeUtils.AppendHistory(filepath.Dir(r.branch), filepath.Base(r.branch), entry); err != nil {
+		fmt.Fprintln(r.out, "Errore durante la registrazione della storia del branch:", err)
+	}
+	return results
+}
+
+// correctionRequest descrive nella storia del branch una correzione chiesta
+// al modello dopo controlli falliti
+func correctionRequest(request string) string {
+	return "correzione dei controlli falliti: " + request
+}
+
+func (r *replSession) history(args []string) {
+	entries, err := codeUtils.LoadHistory(filepath.Dir(r.branch), filepath.Base(r.branch))
+	if err != nil {
+		fmt.Println("Errore durante la lettura della storia del branch:", err)
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Println("Nessuna modifica applicata al branch.")
+		return
+	}
+	for i, entry := range entries {
+		request := strings.SplitN(strings.TrimSpace(entry.Request), "\n", 2)[0]
+		if len(request) > 70 {
+			request = request[:67] + "..."
+		}
+		fmt.Printf("%d. %s  %s\n", i+1, entry.Time.Format("2006-01-02 15:04"), request)
+		fmt.Printf("   file: %s\n", strings.Join(entry.Files, ", "))
+		if len(entry.Checks) > 0 {
+			fmt.Print(verify.Summary(entry.Checks))
+		}
+	}
+}
+
+func (r *replSession) diff(args []string) {
+	if r.pending != nil && (len(args) == 0 || args[0] != "branch") {
+		preview, err := previewModifications(r.branch, *r.pending)
+		if err != nil {
+			fmt.Println("Errore durante l'anteprima delle modifiche:", err)
+			return
+		}
+		fmt.Print(preview)
+		fmt.Println("Modifiche proposte, non ancora applicate: usa /apply per applicarle.")
+		return
+	}
+
+	files, err := diff.Trees(project.Root(), r.branch)
+	if err != nil {
+		fmt.Println("Errore durante il confronto con il progetto:", err)
+		return
+	}
+	if len(files) == 0 {
+		fmt.Println("Il branch non ha modifiche rispetto al progetto.")
+		return
+	}
+	fmt.Print(diff.Patch(files, 3))
+	fmt.Printf("\n%d file modificati nel branch:\n%s", len(files), diff.Summary(files))
+}
+
+// previewModifications applica una proposta a una copia dei file coinvolti e
+// ne restituisce le differenze, senza toccare il branch
+func previewModifications(branch string, response code.CodeModificationResponse) (string, error) {
+	preview, err := os.MkdirTemp("", "isy-preview-")
+	if err != nil {
+		return "", fmt.Errorf("errore durante la creazione della directory temporanea: %v", err)
+	}
+	defer os.RemoveAll(preview)
+
+	before, err := os.MkdirTemp("", "isy-preview-")
+	if err != nil {
+		return "", fmt.Errorf("errore durante la creazione della directory temporanea: %v", err)
+	}
+	defer os.RemoveAll(before)
+
+	// Copia nelle due directory i file del branch toccati dalla proposta
+	var touched []string
+	for _, step := range response.Steps {
+		touched = append(touched, step.FilePath)
+		if step.NewPath != "" {
+			touched = append(touched, step.NewPath)
+		}
+	}
+	if response.Patch != "" {
+		if touched, err = operations.PatchFiles(response.Patch); err != nil {
+			return "", err
+		}
+	}
+	for _, file := range touched {
+		path := filepath.Clean(filepath.FromSlash(file))
+		source := filepath.Join(branch, path)
+		info, err := os.Stat(source)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		content, err := os.ReadFile(source)
+		if err != nil {
+			continue
+		}
+		// Anche i permessi, così l'anteprima mostra solo i cambi di modo della proposta
+		for _, dir := range []string{before, preview} {
+			target := filepath.Join(dir, path)
+			if err := operations.CreateFile(target, string(content)); err != nil {
+				return "", err
+			}
+			if err := os.Chmod(target, info.Mode().Perm()); err != nil {
+				return "", fmt.Errorf("errore durante la copia dei permessi di %s: %v", file, err)
+			}
+		}
+	}
+
+	var builder strings.Builder
+	if _, err := operations.Apply(preview, response); err != nil {
+		builder.WriteString(fmt.Sprintf("Attenzione: %v\n", err))
+	}
+	files, err := diff.Trees(before, preview)
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		builder.WriteString(file.Unified(3))
+	}
+	return builder.String(), nil
+}
+
+// describeModifications riassume i passi di una proposta, uno per riga
+func describeModifications(response code.CodeModificationResponse) string {
+	if response.Patch != "" {
+		return describePatch(response.Patch)
+	}
+	if len(response.Steps) == 0 {
+		return "Nessuna modifica proposta.\n"
+	}
+	var builder strings.Builder
+	for i, step := range response.Steps {
+		builder.WriteString(fmt.Sprintf("%d. %s %s", i+1, step.OperationType, step.FilePath))
+		if step.NewPath != "" {
+			builder.WriteString(" -> " + step.NewPath)
+		}
+		if step.Mode != "" {
+			builder.WriteString(" (mode " + step.Mode + ")")
+		}
+		if step.OperationType == "edit" && len(step.Edits) > 0 {
+			var ranges []string
+			for _, edit := range step.Edits {
+				// Le righe delle modifiche ancorate al testo sono solo indicative
+				if edit.Search != "" {
+					ranges = append(ranges, fmt.Sprintf("~%d-%d", edit.StartLine, edit.EndLine))
+					continue
+				}
+				ranges = append(ranges, fmt.Sprintf("%d-%d", edit.StartLine, edit.EndLine))
+			}
+			sort.Strings(ranges)
+			builder.WriteString(" (righe " + strings.Join(ranges, ", ") + ")")
+		}
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// describePatch riassume i file di una patch, uno per riga
+func describePatch(patch string) string {
+	patches, err := diff.Parse(patch)
+	if err != nil {
+		return fmt.Sprintf("Patch non valida: %v\n", err)
+	}
+	var builder strings.Builder
+	for i, filePatch := range patches {
+		builder.WriteString(fmt.Sprintf("%d. %s %s (%s)\n", i+1, filePatch.Status(), filePatch.Path(), filePatch.Stat()))
+	}
+	return builder.String()
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"isy-cli/internal/config"
+	"isy-cli/internal/secrets"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// SecretsCommand raggruppa i comandi per le credenziali conservate fuori dalla configurazione
+func SecretsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "Manage credentials stored in the OS keyring or in the encrypted secrets file",
+		Long: `Manage credentials stored in the OS keyring or in the encrypted secrets file.
+
+Config values reference a secret by name, e.g. "api_key": "secret:openai-api-key".
+The backend is chosen with secrets.backend (auto, keyring, file). The encrypted file
+asks for a passphrase, or reads it from ISY_SECRETS_PASSPHRASE.`,
+	}
+
+	cmd.AddCommand(secretsSetCommand())
+	cmd.AddCommand(secretsDeleteCommand())
+	cmd.AddCommand(secretsListCommand())
+	cmd.AddCommand(secretsMigrateCommand())
+
+	return cmd
+}
+
+func secretsSetCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "set <name>",
+		Short: "Store a secret, reading its value from stdin",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			store, err := secrets.Open(config.SecretsBackend())
+			if err != nil {
+				fmt.Println("Errore durante l'apertura dello store dei segreti:", err)
+				return
+			}
+
+			fmt.Printf("Inserisci il valore di %s:\n", args[0])
+			value, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			value = strings.TrimSpace(value)
+			if value == "" {
+				fmt.Println("Errore: il valore non può essere vuoto")
+				return
+			}
+
+			if err := store.Set(args[0], value); err != nil {
+				fmt.Println("Errore durante il salvataggio del segreto:", err)
+				return
+			}
+			fmt.Printf("Segreto salvato in %s. Usalo nella configurazione come %q\n", store.Name(), secrets.Ref(args[0]))
+		},
+	}
+}
+
+func secretsDeleteCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete <name>",
+		Short: "Remove a secret from the store",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			store, err := secrets.Open(config.SecretsBackend())
+			if err != nil {
+				fmt.Println("Errore durante l'apertura dello store dei segreti:", err)
+				return
+			}
+
+			if err := store.Delete(args[0]); err != nil {
+				fmt.Println("Errore durante la rimozione del segreto:", err)
+				return
+			}
+			fmt.Printf("Segreto %s rimosso da %s\n", args[0], store.Name())
+		},
+	}
+}
+
+func secretsListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List stored secrets and the config keys that reference them",
+		Run: func(cmd *cobra.Command, args []string) {
+			store, err := secrets.Open(config.SecretsBackend())
+			if err != nil {
+				fmt.Println("Errore durante l'apertura dello store dei segreti:", err)
+				return
+			}
+
+			fmt.Println("Store:", store.Name())
+			if fileStore, ok := store.(*secrets.FileStore); ok {
+				names, err := fileStore.Names()
+				if err != nil {
+					fmt.Println("Errore durante la lettura dei segreti:", err)
+					return
+				}
+				for _, name := range names {
+					fmt.Println("  " + name)
+				}
+			} else {
+				fmt.Println("  (il portachiavi non permette di elencare i segreti)")
+			}
+
+			// Riferimenti presenti nei file di configurazione
+			for _, layer := range config.FileLayers {
+				values, err := config.LoadLayer(layer)
+				if err != nil {
+					continue
+				}
+				flat := config.Flatten(values)
+				for _, key := range config.SortedKeys(flat) {
+					value, _ := flat[key].(string)
+					if name, ok := secrets.RefName(value); ok {
+						fmt.Printf("%s = %s    (%s)\n", key, name, layer)
+					} else if isSecretKey(key) && value != "" {
+						fmt.Printf("%s in chiaro    (%s) -> esegui 'isy secrets migrate'\n", key, layer)
+					}
+				}
+			}
+		},
+	}
+}
+
+func secretsMigrateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "migrate",
+		Short: "Move plaintext credentials out of the config files into the secrets store",
+		Run: func(cmd *cobra.Command, args []string) {
+			store, err := secrets.Open(config.SecretsBackend())
+			if err != nil {
+				fmt.Println("Errore durante l'apertura dello store dei segreti:", err)
+				return
+			}
+
+			migrations, err := config.MigrateSecrets(store)
+			for _, migration := range migrations {
+				path, _ := config.LayerPath(migration.Layer)
+				fmt.Printf("%s (%s) -> %s\n", migration.Key, path, migration.Ref)
+			}
+			if err != nil {
+				fmt.Println("Errore durante la migrazione:", err)
+				return
+			}
+			if len(migrations) == 0 {
+				fmt.Println("Nessuna credenziale in chiaro nei file di configurazione.")
+				return
+			}
+			fmt.Printf("Credenziali spostate in %s: %d\n", store.Name(), len(migrations))
+			fmt.Println("Se la configurazione del progetto era già nel repository, la chiave resta nella cronologia git: revocala e generane una nuova.")
+		},
+	}
+}
+
+// storeSecretValue salva nello store il valore di una chiave segreta e
+// restituisce il riferimento da scrivere nella configurazione
+func storeSecretValue(key, value string) (string, error) {
+	if _, ok := secrets.RefName(value); ok {
+		return value, nil
+	}
+
+	store, err := secrets.Open(config.SecretsBackend())
+	if err != nil {
+		return "", err
+	}
+	return config.StoreSecret(store, config.SecretName(key), value)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"isy-cli/internal/config"
+	"isy-cli/internal/context"
+	"isy-cli/internal/conversation"
+	"isy-cli/internal/hooks"
+	"isy-cli/internal/lineedit"
+	localOpenAI "isy-cli/internal/openai"
+	"isy-cli/internal/openai/schemas/compact"
+	"isy-cli/internal/tools"
+	"strings"
+
+	externalOpenAI "github.com/openai/openai-go"
+)
+
+// overrideModel sostituisce per questa esecuzione il modello configurato, come
+// --model e /model; con model vuoto non cambia nulla
+func overrideModel(settings *context.Settings, model string) error {
+	if model == "" {
+		return nil
+	}
+	field, err := config.LookupField("model")
+	if err != nil {
+		return err
+	}
+	value, err := field.Parse(model)
+	if err != nil {
+		return err
+	}
+	settings.Config.Model = value.(string)
+	return nil
+}
+
+// buildSessionContext genera il contesto iniziale della sessione. Con il recupero
+// semantico attivo contiene solo progetto e albero: i file arrivano a ogni richiesta.
+func buildSessionContext(settings *context.Settings, opts context.Options) (string, error) {
+	if settings.Config.Embeddings.Enabled {
+		return context.BuildBaseContext(opts)
+	}
+	return context.BuildContextWithOptions(opts)
+}
+
+// buildRequestContext restituisce il codice più rilevante per la richiesta, da
+// anteporre al messaggio dell'utente: i chunk più simili con il recupero semantico,
+// i corpi citati in modalità outline e le definizioni da cui dipendono i simboli citati.
+// index conserva l'indice dei simboli tra una richiesta e l'altra (nil = nessuna cache).
+func buildRequestContext(settings *context.Settings, opts context.Options, index *context.SymbolIndex, userInput string) (string, error) {
+	extra := ""
+
+	if settings.Mode == context.ModeOutline {
+		expanded, err := context.BuildExpandedContext(userInput, opts)
+		if err != nil {
+			return "", err
+		}
+		extra = expanded + extra
+	}
+
+	// Aggiunge le definizioni da cui dipendono i simboli citati
+	related, err := context.BuildRelatedDefinitions(userInput, opts, index)
+	if err != nil {
+		return "", err
+	}
+	extra = related + extra
+
+	if settings.Config.Embeddings.Enabled {
+		relevant, err := context.BuildSemanticContext(userInput, opts)
+		if err != nil {
+			return "", err
+		}
+		extra = relevant + extra
+	}
+
+	return extra, nil
+}
+
+// newConversation prepara la conversazione con le soglie di compattazione della configurazione
+func newConversation(settings *context.Settings, systemPrompt, contextContent string) *conversation.Conversation {
+	compaction := settings.Config.Compaction
+	return conversation.New(systemPrompt, contextContent, conversation.Options{
+		Disabled:  compaction.Disabled,
+		Threshold: compaction.Threshold,
+		KeepTurns: compaction.KeepTurns,
+	})
+}
+
+// newToolbox prepara le funzioni che il modello può chiamare, oppure nil se sono
+// disattivate. run_command chiede conferma con l'editor, quindi senza REPL
+// (editor nil) non viene offerto.
+func newToolbox(settings *context.Settings, out io.Writer, editor *lineedit.Editor) *tools.Toolbox {
+	toolsConfig := settings.Config.Tools
+	if toolsConfig.Disabled {
+		return nil
+	}
+
+	options := tools.Options{
+		Budget:         toolsConfig.Budget,
+		Commands:       !toolsConfig.DisableCommands && editor != nil,
+		CommandTimeout: toolsConfig.CommandTimeout,
+		Out:            out,
+	}
+	if editor != nil {
+		options.Approve = func(command string) bool {
+			fmt.Printf("Il modello vuole eseguire: %s\n", command)
+			return editor.Confirm("Eseguire il comando?")
+		}
+	}
+	return tools.New(settings, options)
+}
+
+// systemPromptWithTools aggiunge al prompt di sistema le istruzioni sulle funzioni
+func systemPromptWithTools(systemPrompt string, toolbox *tools.Toolbox) string {
+	if toolbox == nil {
+		return systemPrompt
+	}
+	return systemPrompt + tools.Prompt
+}
+
+// complete esegue la richiesta del turno. Con le funzioni attive il modello può
+// leggere file e cercare nel progetto; i risultati restano nella conversazione
+// insieme alla richiesta, così le domande successive possono farvi riferimento.
+// La risposta passa poi dagli hook after_response, che possono riscriverla.
+func (r *replSession) complete(params externalOpenAI.ChatCompletionNewParams) (string, error) {
+	var response string
+	var err error
+	if r.tools == nil {
+		response, err = localOpenAI.RunCompletion(params)
+	} else {
+		r.tools.Reset()
+		response, err = localOpenAI.RunCompletionWithTools(params, r.tools)
+		if err == nil {
+			r.conv.AppendExtra(r.tools.Transcript())
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	data := hooks.ResponseData{Model: localOpenAI.ChatModel(r.settings.Config), Response: response}
+	if err := r.hooks.Run(hooks.AfterResponse, &data); err != nil {
+		return "", err
+	}
+	return data.Response, nil
+}
+
+// rewriteRequest passa la richiesta dell'utente dagli hook before_request
+func (r *replSession) rewriteRequest(userInput string) (string, error) {
+	data := hooks.RequestData{Prompt: userInput}
+	if err := r.hooks.Run(hooks.BeforeRequest, &data); err != nil {
+		return "", err
+	}
+	return data.Prompt, nil
+}
+
+// sessionOptions restituisce le opzioni del contesto di una sessione dopo gli
+// hook before_context, che possono cambiare profilo e modalità
+func sessionOptions(runner *hooks.Runner, profile string) (context.Options, error) {
+	data := hooks.ContextData{Profile: profile}
+	if err := runner.Run(hooks.BeforeContext, &data); err != nil {
+		return context.Options{}, err
+	}
+	return context.Options{Profile: data.Profile, Mode: data.Mode}, nil
+}
+
+// refreshContext rigenera il contesto e lo sostituisce solo se i file sono cambiati
+func (r *replSession) refreshContext() {
+	contextContent, err := buildSessionContext(r.settings, r.opts)
+	if err != nil {
+		fmt.Fprintln(r.out, "Errore durante l'aggiornamento del contesto:", err)
+		return
+	}
+	if r.conv.RefreshContext(contextContent) {
+		fmt.Fprintln(r.out, "I file del progetto sono cambiati: il contesto è stato aggiornato.")
+	}
+}
+
+// compactConversation compatta la conversazione se ha superato la soglia e lo segnala
+func (r *replSession) compactConversation() {
+	report, err := r.conv.Compact(summarizeTurns(r.settings))
+	if err != nil {
+		fmt.Fprintln(r.out, "Errore durante la compattazione della conversazione:", err)
+		return
+	}
+	if report != nil {
+		fmt.Fprintln(r.out, report)
+	}
+}
+
+// summarizeTurns riassume con il modello i turni da compattare
+func summarizeTurns(settings *context.Settings) conversation.Summarizer {
+	return func(previousSummary string, turns []conversation.Turn) (string, error) {
+		var builder strings.Builder
+		if previousSummary != "" {
+			builder.WriteString("PREVIOUS SUMMARY:\n" + previousSummary + "\n\n")
+		}
+		builder.WriteString("TURNS TO COMPRESS:\n")
+		for _, turn := range turns {
+			builder.WriteString(fmt.Sprintf("\n[%s]\n%s\n", turn.Role, turn.Content))
+		}
+
+		params := externalOpenAI.ChatCompletionNewParams{
+			Model: externalOpenAI.F(localOpenAI.ChatModel(settings.Config)),
+			ResponseFormat: externalOpenAI.F[externalOpenAI.ChatCompletionNewParamsResponseFormatUnion](
+				externalOpenAI.ResponseFormatJSONSchemaParam{
+					Type: externalOpenAI.F(externalOpenAI.ResponseFormatJSONSchemaTypeJSONSchema),
+					JSONSchema: externalOpenAI.F(externalOpenAI.ResponseFormatJSONSchemaJSONSchemaParam{
+						Name:   externalOpenAI.F("conversation_summary"),
+						Schema: externalOpenAI.F(compact.ConversationSummaryResponseSchema),
+						Strict: externalOpenAI.Bool(true),
+					}),
+				},
+			),
+			Messages: externalOpenAI.F([]externalOpenAI.ChatCompletionMessageParamUnion{
+				externalOpenAI.SystemMessage(compact.SYSTEM_PROMPT),
+				externalOpenAI.UserMessage(builder.String()),
+			}),
+		}
+
+		response, err := localOpenAI.RunCompletion(params)
+		if err != nil {
+			return "", err
+		}
+		summary := compact.ConversationSummary{}
+		if err := json.Unmarshal([]byte(response), &summary); err != nil {
+			return "", fmt.Errorf("errore nella decodifica del riassunto: %v", err)
+		}
+		return summary.Summary, nil
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"isy-cli/internal/sessions"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// SessionsCommand elenca le sessioni di ask salvate
+func SessionsCommand() *cobra.Command {
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "sessions",
+		Short: "List saved ask sessions (resume one with isy ask --resume <id>)",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			all, err := sessions.List()
+			if err != nil {
+				fmt.Println("Errore durante la lettura delle sessioni:", err)
+				return
+			}
+			if len(all) == 0 {
+				fmt.Println("Nessuna sessione salvata.")
+				return
+			}
+
+			if limit > 0 && len(all) > limit {
+				all = all[:limit]
+			}
+			for _, session := range all {
+				cost := fmt.Sprintf("$%.4f", session.Cost)
+				if session.CostUnknown {
+					cost += "+" // Una parte del costo è sconosciuta
+				}
+				fmt.Printf("%s  %s  %-12s %3d domande  %-8s %s\n",
+					session.ID, session.Updated.Format("2006-01-02 15:04"), session.Model,
+					session.Turns(), cost, session.Title)
+			}
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "Numero massimo di sessioni mostrate (0 = tutte)")
+
+	cmd.AddCommand(sessionsSearchCommand())
+	cmd.AddCommand(sessionsShowCommand())
+
+	return cmd
+}
+
+func sessionsSearchCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "search <text>",
+		Short: "Search the messages of saved sessions",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			query := strings.Join(args, " ")
+			matches, err := sessions.Search(query)
+			if err != nil {
+				fmt.Println("Errore durante la ricerca:", err)
+				return
+			}
+			if len(matches) == 0 {
+				fmt.Println("Nessuna sessione contiene:", query)
+				return
+			}
+
+			current := ""
+			for _, match := range matches {
+				if match.Session.ID != current {
+					current = match.Session.ID
+					fmt.Printf("\n%s  %s\n", match.Session.ID, match.Session.Title)
+				}
+				role := "title"
+				if match.Message.Role != "" {
+					role = match.Message.Role
+				}
+				fmt.Printf("  %-9s %s\n", role+":", match.Snippet)
+			}
+		},
+	}
+}
+
+func sessionsShowCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <id>",
+		Short: "Print the transcript of a saved session",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			session, err := sessions.Load(args[0])
+			if err != nil {
+				fmt.Println("Errore durante il caricamento della sessione:", err)
+				return
+			}
+
+			fmt.Printf("Sessione %s (%s, creata il %s)\n", session.ID, session.Model, session.Created.Format("2006-01-02 15:04"))
+			fmt.Printf("Token di input: %d, di output: %d, costo (USD): %s\n", session.InputTokens, session.OutputTokens, formatCost(session.Cost, session.CostUnknown))
+			for _, message := range session.Messages {
+				speaker := "You"
+				if message.Role == "assistant" {
+					speaker = "Assistant"
+				}
+				fmt.Printf("\n%s: %s\n", speaker, message.Content)
+			}
+		},
+	}
+}
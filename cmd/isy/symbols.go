@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"isy-cli/internal/symbols"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// SymbolsCommand elenca le definizioni trovate nel progetto
+func SymbolsCommand() *cobra.Command {
+	var kind string
+	var showImports bool
+
+	cmd := &cobra.Command{
+		Use:   "symbols [filter]",
+		Short: "List the symbols defined in the project",
+		Long:  "List definitions (functions, types, classes, ...) across the project, optionally filtered by a name substring, or print the package import graph.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			index, err := symbols.Build(".")
+			if err != nil {
+				fmt.Println("Errore durante la costruzione dell'indice dei simboli:", err)
+				return
+			}
+
+			if showImports {
+				packages := make([]string, 0, len(index.Imports))
+				for pkg := range index.Imports {
+					packages = append(packages, pkg)
+				}
+				sort.Strings(packages)
+
+				for _, pkg := range packages {
+					fmt.Printf("%s\n", pkg)
+					for _, imported := range index.Imports[pkg] {
+						fmt.Printf("  -> %s\n", imported)
+					}
+				}
+				return
+			}
+
+			filter := ""
+			if len(args) > 0 {
+				filter = strings.ToLower(args[0])
+			}
+
+			for _, symbol := range index.Symbols {
+				if kind != "" && symbol.Kind != kind {
+					continue
+				}
+				if filter != "" && !strings.Contains(strings.ToLower(symbol.Name), filter) {
+					continue
+				}
+				fmt.Printf("%-7s %s  %s:%d\n", symbol.Kind, qualifiedName(symbol), symbol.Path, symbol.Line)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&kind, "kind", "", "Mostra solo i simboli di questo tipo (func, method, type, class, const, var)")
+	cmd.Flags().BoolVar(&showImports, "imports", false, "Mostra il grafo degli import tra package")
+
+	return cmd
+}
+
+// RefsCommand mostra definizioni e riferimenti di un nome
+func RefsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "refs <name>",
+		Short: "Show where a symbol is defined and referenced",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			name := args[0]
+
+			index, err := symbols.Build(".")
+			if err != nil {
+				fmt.Println("Errore durante la costruzione dell'indice dei simboli:", err)
+				return
+			}
+
+			definitions := index.Definitions(name)
+			references := index.ReferencesTo(name)
+			if len(definitions) == 0 && len(references) == 0 {
+				fmt.Printf("Nessun simbolo trovato con nome %s\n", name)
+				return
+			}
+
+			fmt.Println("Definizioni:")
+			for _, symbol := range definitions {
+				fmt.Printf("  %s:%d  %s %s\n", symbol.Path, symbol.Line, symbol.Kind, qualifiedName(symbol))
+			}
+
+			fmt.Println("Riferimenti:")
+			for _, reference := range references {
+				fmt.Printf("  %s:%d\n", reference.Path, reference.Line)
+			}
+		},
+	}
+}
+
+func qualifiedName(symbol symbols.Symbol) string {
+	if symbol.Receiver != "" {
+		return symbol.Receiver + "." + symbol.Name
+	}
+	return symbol.Name
+}
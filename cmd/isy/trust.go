@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"isy-cli/internal/config"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// TrustCommand approva gli hook e i controlli definiti nella configurazione del progetto
+func TrustCommand() *cobra.Command {
+	var yes, revoke bool
+
+	cmd := &cobra.Command{
+		Use:   "trust",
+		Short: "Review and approve the shell commands defined by the project configuration",
+		Long: `Review and approve the shell commands defined by the project configuration.
+
+Hooks ("hooks") and checks ("verify.hooks") in .isy/config.json come with the
+repository, so isy runs them only after you approve them. The approval is stored
+outside the project, next to the global configuration, and covers the commands
+as they are now: when they change (e.g. after a pull) they must be approved
+again. Commands in config.local.json and in the global configuration always run.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if revoke {
+				if err := config.RevokeProjectTrust(); err != nil {
+					fmt.Println("Errore durante la revoca dell'approvazione:", err)
+					return
+				}
+				fmt.Println("Approvazione revocata: gli hook e i controlli del progetto non verranno eseguiti.")
+				return
+			}
+
+			commands, err := config.ProjectCommands()
+			if err != nil {
+				fmt.Println("Errore durante la lettura della configurazione del progetto:", err)
+				return
+			}
+			if len(commands) == 0 {
+				fmt.Println("La configurazione del progetto non definisce hook né controlli.")
+				return
+			}
+			trusted, err := config.ProjectTrusted()
+			if err != nil {
+				fmt.Println("Errore durante la lettura dei progetti approvati:", err)
+				return
+			}
+
+			fmt.Println("Comandi definiti in .isy/config.json:")
+			for _, key := range config.SortedKeys(commands) {
+				data, _ := json.MarshalIndent(commands[key], "  ", "  ")
+				fmt.Printf("  %s: %s\n", key, data)
+			}
+			if trusted {
+				fmt.Println("\nQuesti comandi sono già approvati.")
+				return
+			}
+
+			if !yes {
+				fmt.Print("\nI comandi verranno eseguiti con i tuoi permessi. Approvarli? (s/N): ")
+				answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+				switch strings.ToLower(strings.TrimSpace(answer)) {
+				case "s", "si", "sì", "y", "yes":
+				default:
+					fmt.Println("Comandi non approvati.")
+					return
+				}
+			}
+			if err := config.TrustProject(); err != nil {
+				fmt.Println("Errore durante il salvataggio dell'approvazione:", err)
+				return
+			}
+			fmt.Println("Comandi approvati.")
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Approva senza chiedere conferma")
+	cmd.Flags().BoolVar(&revoke, "revoke", false, "Revoca l'approvazione dei comandi del progetto")
+	cmd.MarkFlagsMutuallyExclusive("yes", "revoke")
+
+	return cmd
+}
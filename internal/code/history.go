@@ -0,0 +1,73 @@
+package code
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"isy-cli/internal/verify"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// HistoryEntry è una modifica applicata al branch, con l'esito dei controlli
+type HistoryEntry struct {
+	Time    time.Time       `json:"time"`
+	Request string          `json:"request"`
+	Files   []string        `json:"files"`
+	Checks  []verify.Result `json:"checks,omitempty"`
+}
+
+// branchHistoryPath restituisce il file con la storia delle modifiche del branch
+func branchHistoryPath(branchesDir, name string) string {
+	return filepath.Join(branchesDir, name+".history")
+}
+
+// AppendHistory aggiunge una voce alla storia del branch, una riga JSON per voce
+func AppendHistory(branchesDir, name string, entry HistoryEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("could not encode branch history: %v", err)
+	}
+	file, err := os.OpenFile(branchHistoryPath(branchesDir, name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open branch history: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("could not write branch history: %v", err)
+	}
+	return nil
+}
+
+// LoadHistory restituisce la storia del branch dalla voce più vecchia; è vuota
+// per i branch senza modifiche applicate
+func LoadHistory(branchesDir, name string) ([]HistoryEntry, error) {
+	file, err := os.Open(branchHistoryPath(branchesDir, name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read branch history: %v", err)
+	}
+	defer file.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// Una riga scritta a metà da un crash non rende illeggibile il resto
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read branch history: %v", err)
+	}
+	return entries, nil
+}
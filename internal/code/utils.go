@@ -7,9 +7,11 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"isy-cli/internal/project"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 )
 
 func GenerateHash() (string, error) {
@@ -33,8 +35,8 @@ func CopyDir(src, dst string) error {
 		}
 		targetPath := filepath.Join(dst, relPath)
 
-		// Skip the .isy directory
-		if info.IsDir() && info.Name() == ".isy" {
+		// Skip the .isy and .git directories
+		if info.IsDir() && path != src && project.SkippedDir(info.Name()) {
 			return filepath.SkipDir
 		}
 
@@ -69,8 +71,8 @@ func ComputeDirectoryHash(dir string) (string, error) {
 			return err
 		}
 
-		// Salta la cartella .isy
-		if info.IsDir() && info.Name() == ".isy" {
+		// Salta le cartelle .isy e .git, che i branch non copiano
+		if info.IsDir() && path != dir && project.SkippedDir(info.Name()) {
 			return filepath.SkipDir
 		}
 
@@ -119,3 +121,30 @@ func ListBranchesSortedByDate(dir string) ([]string, error) {
 
 	return branches, nil
 }
+
+// branchBasePath restituisce il file con l'hash del progetto da cui è nato il branch
+func branchBasePath(branchesDir, name string) string {
+	return filepath.Join(branchesDir, name+".base")
+}
+
+// SaveBranchBase registra l'hash del progetto al momento della creazione del
+// branch, così che il branch resti utilizzabile dopo averci applicato modifiche
+func SaveBranchBase(branchesDir, name, hash string) error {
+	if err := os.WriteFile(branchBasePath(branchesDir, name), []byte(hash+"\n"), 0644); err != nil {
+		return fmt.Errorf("could not save branch base: %v", err)
+	}
+	return nil
+}
+
+// LoadBranchBase restituisce l'hash registrato da SaveBranchBase, oppure ""
+// per i branch creati prima che venisse registrato
+func LoadBranchBase(branchesDir, name string) (string, error) {
+	data, err := os.ReadFile(branchBasePath(branchesDir, name))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not read branch base: %v", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,165 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Dir è la directory dei comandi del progetto, dentro .isy
+const Dir = "commands"
+
+// Tipi di comando: una domanda come isy ask o una modifica come isy code
+const (
+	TypeAsk  = "ask"
+	TypeCode = "code"
+)
+
+var (
+	namePattern     = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	variablePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+)
+
+// Nomi già usati dai flag di isy do, che le variabili non possono avere
+var reservedVariables = map[string]bool{"output": true, "branch": true, "apply": true, "help": true, "root": true}
+
+// Template è un comando definito dal progetto in .isy/commands/<nome>.yaml,
+// eseguito con "isy do <nome>"
+type Template struct {
+	Name        string     `yaml:"-"` // Dal nome del file
+	Path        string     `yaml:"-"`
+	Description string     `yaml:"description"`
+	Type        string     `yaml:"type"`    // ask o code (default ask)
+	Prompt      string     `yaml:"prompt"`  // Testo della richiesta, con le variabili come {{.target}}
+	Profile     string     `yaml:"profile"` // Profilo di contesto (default: quello del progetto)
+	Model       string     `yaml:"model"`   // Modello (default: quello configurato)
+	Variables   []Variable `yaml:"variables"`
+
+	prompt *template.Template
+}
+
+// Variable è un parametro del comando, passato come --<nome>
+type Variable struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Default     string `yaml:"default"`
+	Required    bool   `yaml:"required"`
+}
+
+// LoadAll legge i comandi nella directory indicata, in ordine di nome. Un file
+// non valido non impedisce di usare gli altri: i suoi errori vengono
+// restituiti a parte.
+func LoadAll(dir string) ([]*Template, []error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, []error{err}
+	}
+	more, _ := filepath.Glob(filepath.Join(dir, "*.yml"))
+	paths = append(paths, more...)
+	sort.Strings(paths)
+
+	var templates []*Template
+	var errs []error
+	seen := make(map[string]string)
+	for _, path := range paths {
+		t, err := Load(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if previous, ok := seen[t.Name]; ok {
+			errs = append(errs, fmt.Errorf("comando %s definito sia in %s sia in %s", t.Name, previous, path))
+			continue
+		}
+		seen[t.Name] = path
+		templates = append(templates, t)
+	}
+	return templates, errs
+}
+
+// Load legge e controlla un comando
+func Load(path string) (*Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("errore durante la lettura del comando %s: %v", path, err)
+	}
+	t := &Template{}
+	if err := yaml.Unmarshal(data, t); err != nil {
+		return nil, fmt.Errorf("comando %s non valido: %v", path, err)
+	}
+	t.Path = path
+	t.Name = strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".yaml"), ".yml")
+	if err := t.check(); err != nil {
+		return nil, fmt.Errorf("comando %s non valido: %v", path, err)
+	}
+	return t, nil
+}
+
+func (t *Template) check() error {
+	if !namePattern.MatchString(t.Name) {
+		return fmt.Errorf("il nome %q deve contenere solo lettere minuscole, cifre, - e _", t.Name)
+	}
+	switch t.Type {
+	case "":
+		t.Type = TypeAsk
+	case TypeAsk, TypeCode:
+	default:
+		return fmt.Errorf("type %q non valido: usa %s o %s", t.Type, TypeAsk, TypeCode)
+	}
+	if strings.TrimSpace(t.Prompt) == "" {
+		return fmt.Errorf("manca prompt")
+	}
+	if t.Profile != "" && !namePattern.MatchString(t.Profile) {
+		return fmt.Errorf("profile %q non valido: usa solo lettere minuscole, cifre, - e _", t.Profile)
+	}
+
+	names := make(map[string]bool)
+	for _, variable := range t.Variables {
+		if !variablePattern.MatchString(variable.Name) {
+			return fmt.Errorf("variabile %q non valida: usa lettere minuscole, cifre e _", variable.Name)
+		}
+		if reservedVariables[variable.Name] {
+			return fmt.Errorf("variabile %s non valida: il nome è riservato a un flag di isy do", variable.Name)
+		}
+		if names[variable.Name] {
+			return fmt.Errorf("variabile %s ripetuta", variable.Name)
+		}
+		names[variable.Name] = true
+	}
+
+	// Una variabile non dichiarata nel prompt è un errore al momento dell'esecuzione
+	prompt, err := template.New(t.Name).Option("missingkey=error").Parse(t.Prompt)
+	if err != nil {
+		return fmt.Errorf("prompt non valido: %v", err)
+	}
+	t.prompt = prompt
+	return nil
+}
+
+// Render compone la richiesta con i valori delle variabili; quelle non indicate
+// prendono il valore di default
+func (t *Template) Render(values map[string]string) (string, error) {
+	data := make(map[string]string)
+	for _, variable := range t.Variables {
+		value, ok := values[variable.Name]
+		if !ok || value == "" {
+			value = variable.Default
+		}
+		if value == "" && variable.Required {
+			return "", fmt.Errorf("manca il valore di --%s", variable.Name)
+		}
+		data[variable.Name] = value
+	}
+
+	var builder strings.Builder
+	if err := t.prompt.Execute(&builder, data); err != nil {
+		return "", fmt.Errorf("errore nella composizione del prompt di %s: %v", t.Name, err)
+	}
+	return strings.TrimSpace(builder.String()), nil
+}
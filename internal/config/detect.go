@@ -0,0 +1,275 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Stack è un linguaggio (con l'eventuale framework) riconosciuto nel progetto
+type Stack struct {
+	Language  string
+	Framework string
+	Marker    string   // File che ha permesso di riconoscerlo
+	Include   []string // Pattern .isycontext dei file sorgente
+	Exclude   []string // Directory e file generati da escludere
+}
+
+// Name descrive lo stack come "Linguaggio/Framework"
+func (s Stack) Name() string {
+	if s.Framework == "" {
+		return s.Language
+	}
+	return s.Language + "/" + s.Framework
+}
+
+// stackDetector riconosce uno stack a partire da un file marcatore
+type stackDetector struct {
+	markers []string // Nomi (o glob) cercati nella directory del progetto
+	detect  func(dir, marker string) Stack
+}
+
+var stackDetectors = []stackDetector{
+	{markers: []string{"go.mod"}, detect: detectGo},
+	{markers: []string{"package.json"}, detect: detectNode},
+	{markers: []string{"pyproject.toml", "requirements.txt", "setup.py", "Pipfile"}, detect: detectPython},
+	{markers: []string{"Cargo.toml"}, detect: func(dir, marker string) Stack {
+		return Stack{
+			Language: "Rust",
+			Include:  []string{"*.rs", "Cargo.toml"},
+			Exclude:  []string{"target/"},
+		}
+	}},
+	{markers: []string{"pom.xml", "build.gradle", "build.gradle.kts"}, detect: detectJVM},
+	{markers: []string{"Gemfile"}, detect: func(dir, marker string) Stack {
+		stack := Stack{
+			Language: "Ruby",
+			Include:  []string{"*.rb", "*.rake", "Gemfile"},
+			Exclude:  []string{"vendor/", "tmp/", "log/"},
+		}
+		if fileExists(filepath.Join(dir, "config", "application.rb")) {
+			stack.Framework = "Rails"
+			stack.Include = append(stack.Include, "*.erb")
+		}
+		return stack
+	}},
+	{markers: []string{"composer.json"}, detect: func(dir, marker string) Stack {
+		stack := Stack{
+			Language: "PHP",
+			Include:  []string{"*.php", "composer.json"},
+			Exclude:  []string{"vendor/"},
+		}
+		if fileExists(filepath.Join(dir, "artisan")) {
+			stack.Framework = "Laravel"
+			stack.Exclude = append(stack.Exclude, "storage/", "bootstrap/cache/")
+		}
+		return stack
+	}},
+	{markers: []string{"*.csproj", "*.sln"}, detect: func(dir, marker string) Stack {
+		return Stack{
+			Language:  "C#",
+			Framework: ".NET",
+			Include:   []string{"*.cs", "*.csproj"},
+			Exclude:   []string{"bin/", "obj/"},
+		}
+	}},
+}
+
+// DetectStacks riconosce gli stack presenti nella directory dai loro file marcatori
+func DetectStacks(dir string) []Stack {
+	var stacks []Stack
+	for _, detector := range stackDetectors {
+		for _, marker := range detector.markers {
+			matches, _ := filepath.Glob(filepath.Join(dir, marker))
+			if len(matches) == 0 {
+				continue
+			}
+			stack := detector.detect(dir, filepath.Base(matches[0]))
+			stack.Marker = filepath.Base(matches[0])
+			stacks = append(stacks, stack)
+			break
+		}
+	}
+	return stacks
+}
+
+func detectGo(dir, marker string) Stack {
+	stack := Stack{
+		Language: "Go",
+		Include:  []string{"*.go", "go.mod"},
+		Exclude:  []string{"vendor/"},
+	}
+
+	content, _ := os.ReadFile(filepath.Join(dir, marker))
+	for _, framework := range []struct{ module, name string }{
+		{"github.com/gin-gonic/gin", "Gin"},
+		{"github.com/labstack/echo", "Echo"},
+		{"github.com/gofiber/fiber", "Fiber"},
+		{"github.com/go-chi/chi", "Chi"},
+		{"github.com/spf13/cobra", "Cobra"},
+	} {
+		if strings.Contains(string(content), framework.module) {
+			stack.Framework = framework.name
+			break
+		}
+	}
+	return stack
+}
+
+func detectNode(dir, marker string) Stack {
+	stack := Stack{
+		Language: "JavaScript",
+		Include:  []string{"*.js", "*.jsx", "*.mjs", "package.json"},
+		Exclude:  []string{"node_modules/", "dist/", "build/", "coverage/", "*.min.js"},
+	}
+	if fileExists(filepath.Join(dir, "tsconfig.json")) {
+		stack.Language = "TypeScript"
+		stack.Include = append([]string{"*.ts", "*.tsx"}, stack.Include...)
+		stack.Include = append(stack.Include, "tsconfig.json")
+	}
+
+	var pkg struct {
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+	content, _ := os.ReadFile(filepath.Join(dir, marker))
+	_ = json.Unmarshal(content, &pkg)
+	hasDependency := func(name string) bool {
+		_, inDeps := pkg.Dependencies[name]
+		_, inDevDeps := pkg.DevDependencies[name]
+		return inDeps || inDevDeps
+	}
+
+	// L'ordine conta: Next.js e Nuxt dipendono a loro volta da React e Vue
+	for _, framework := range []struct{ dependency, name, output string }{
+		{"next", "Next.js", ".next/"},
+		{"nuxt", "Nuxt", ".nuxt/"},
+		{"@angular/core", "Angular", ".angular/"},
+		{"svelte", "Svelte", ".svelte-kit/"},
+		{"react", "React", ""},
+		{"vue", "Vue", ""},
+		{"express", "Express", ""},
+	} {
+		if hasDependency(framework.dependency) {
+			stack.Framework = framework.name
+			if framework.output != "" {
+				stack.Exclude = append(stack.Exclude, framework.output)
+			}
+			if framework.name == "Vue" || framework.name == "Nuxt" {
+				stack.Include = append(stack.Include, "*.vue")
+			}
+			if framework.name == "Svelte" {
+				stack.Include = append(stack.Include, "*.svelte")
+			}
+			break
+		}
+	}
+	return stack
+}
+
+func detectPython(dir, marker string) Stack {
+	stack := Stack{
+		Language: "Python",
+		Include:  []string{"*.py", marker},
+		Exclude:  []string{".venv/", "venv/", "__pycache__/", "*.egg-info/", "build/", "dist/"},
+	}
+
+	// Cerca il framework in tutti i file di dipendenze presenti
+	var dependencies strings.Builder
+	for _, name := range []string{"pyproject.toml", "requirements.txt", "setup.py", "Pipfile"} {
+		content, _ := os.ReadFile(filepath.Join(dir, name))
+		dependencies.WriteString(strings.ToLower(string(content)))
+	}
+	for _, framework := range []struct{ dependency, name string }{
+		{"django", "Django"},
+		{"fastapi", "FastAPI"},
+		{"flask", "Flask"},
+	} {
+		if strings.Contains(dependencies.String(), framework.dependency) {
+			stack.Framework = framework.name
+			if framework.name == "Django" {
+				stack.Include = append(stack.Include, "*.html")
+				stack.Exclude = append(stack.Exclude, "staticfiles/")
+			}
+			break
+		}
+	}
+	return stack
+}
+
+func detectJVM(dir, marker string) Stack {
+	stack := Stack{
+		Language: "Java",
+		Include:  []string{"*.java", marker},
+		Exclude:  []string{"target/", "build/", ".gradle/"},
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "src", "main", "kotlin"))
+	if strings.HasSuffix(marker, ".kts") || len(matches) > 0 {
+		stack.Language = "Kotlin"
+		stack.Include = append([]string{"*.kt"}, stack.Include...)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(dir, marker))
+	if strings.Contains(string(content), "spring-boot") || strings.Contains(string(content), "org.springframework.boot") {
+		stack.Framework = "Spring Boot"
+		stack.Include = append(stack.Include, "application*.properties", "application*.yml")
+	}
+	return stack
+}
+
+// StacksName descrive gli stack riconosciuti, es. "Go/Cobra, TypeScript/React"
+func StacksName(stacks []Stack) string {
+	names := make([]string, len(stacks))
+	for i, stack := range stacks {
+		names[i] = stack.Name()
+	}
+	return strings.Join(names, ", ")
+}
+
+// DefaultIsyContext genera un .isycontext adatto agli stack riconosciuti
+func DefaultIsyContext(stacks []Stack) string {
+	var builder strings.Builder
+	builder.WriteString("# File inclusi nel contesto di isy. Sintassi di .gitignore: vince l'ultima\n")
+	builder.WriteString("# regola che corrisponde e \"!\" esclude. Usa 'isy context --explain <file>'\n")
+	builder.WriteString("# per capire perché un file è incluso o escluso.\n\n")
+	builder.WriteString("@gitignore\n")
+	builder.WriteString("@max-size 256KB\n\n")
+
+	builder.WriteString("README.md\n\n")
+	if len(stacks) == 0 {
+		builder.WriteString("# Nessuno stack riconosciuto: aggiungi qui i pattern dei file sorgente\n")
+		return builder.String()
+	}
+
+	seen := make(map[string]bool)
+	writeUnique := func(line string) {
+		if !seen[line] {
+			seen[line] = true
+			builder.WriteString(line + "\n")
+		}
+	}
+
+	for _, stack := range stacks {
+		builder.WriteString(fmt.Sprintf("# %s (riconosciuto da %s)\n", stack.Name(), stack.Marker))
+		for _, pattern := range stack.Include {
+			writeUnique(pattern)
+		}
+		builder.WriteString("\n")
+	}
+
+	builder.WriteString("# File generati e dipendenze\n")
+	for _, stack := range stacks {
+		for _, pattern := range stack.Exclude {
+			writeUnique("!" + pattern)
+		}
+	}
+
+	return builder.String()
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
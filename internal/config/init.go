@@ -2,73 +2,190 @@ package config
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
+	"isy-cli/internal/project"
+	"isy-cli/internal/secrets"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
-func InitProject() {
+// InitOptions contiene le risposte di init fornite senza prompt. I campi vuoti
+// vengono chiesti all'utente, oppure riempiti con i valori rilevati se l'init
+// non è interattivo.
+type InitOptions struct {
+	ProjectName          string `json:"project_name"`
+	Author               string `json:"author"`
+	LanguageAndFramework string `json:"language_and_framework"`
+	Description          string `json:"description"`
+	APIKey               string `json:"api_key"`
+	ResponseLanguage     string `json:"ia_model_response_language"`
+	Gitignore            *bool  `json:"gitignore"` // Aggiunge i file di stato di .isy a .gitignore (nil = chiedi)
 
-	// Verifica se la directory .isy esiste
-	if _, err := os.Stat(".isy"); err == nil {
-		fmt.Println("Il progetto è già stato inizializzato.")
-		fmt.Print("Vuoi cancellare tutto e rifare l'init? (s/n): ")
-		var response string
-		fmt.Scanln(&response)
-		if strings.ToLower(response) != "s" {
-			fmt.Println("Operazione annullata.")
-			return
-		}
+	AnswersFile    string `json:"-"` // File JSON con le risposte, nel formato di questa struct
+	NonInteractive bool   `json:"-"` // Nessun prompt: usa i valori rilevati per quelli mancanti
+	Force          bool   `json:"-"` // Reinizializza senza chiedere se .isy esiste già
+	Wipe           bool   `json:"-"` // Cancella l'intera .isy prima di reinizializzare
+}
 
-		// Cancella la directory
-		err := os.RemoveAll(".isy")
-		if err != nil {
-			fmt.Println("Errore durante la cancellazione della directory:", err)
-			return
+const defaultResponseLanguage = "en"
+
+// File e directory di .isy che appartengono alla singola copia di lavoro e non
+// vanno nel repository, a differenza di configurazione, profili, comandi e policy
+var stateIgnoreEntries = []string{
+	".isy/branches/",
+	".isy/journal/",
+	".isy/sessions/",
+	".isy/" + localConfigFile,
+	".isy/history",
+	".isy/token_usage.json",
+	".isy/embeddings.json",
+	".isy/redaction.log",
+	".isy/last_context",
+}
+
+// LoadInitAnswers legge un file di risposte e lo unisce alle opzioni: i valori
+// già presenti nelle opzioni (es. dai flag) hanno la precedenza
+func LoadInitAnswers(opts InitOptions) (InitOptions, error) {
+	if opts.AnswersFile == "" {
+		return opts, nil
+	}
+
+	data, err := os.ReadFile(opts.AnswersFile)
+	if err != nil {
+		return opts, fmt.Errorf("errore durante la lettura del file di risposte: %v", err)
+	}
+	var answers InitOptions
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&answers); err != nil {
+		return opts, fmt.Errorf("errore durante la decodifica del file di risposte %s: %v", opts.AnswersFile, err)
+	}
+
+	firstNonEmpty := func(values ...string) string {
+		for _, value := range values {
+			if value != "" {
+				return value
+			}
 		}
+		return ""
 	}
+	opts.ProjectName = firstNonEmpty(opts.ProjectName, answers.ProjectName)
+	opts.Author = firstNonEmpty(opts.Author, answers.Author)
+	opts.LanguageAndFramework = firstNonEmpty(opts.LanguageAndFramework, answers.LanguageAndFramework)
+	opts.Description = firstNonEmpty(opts.Description, answers.Description)
+	opts.APIKey = firstNonEmpty(opts.APIKey, answers.APIKey)
+	opts.ResponseLanguage = firstNonEmpty(opts.ResponseLanguage, answers.ResponseLanguage)
+	if opts.Gitignore == nil {
+		opts.Gitignore = answers.Gitignore
+	}
+	return opts, nil
+}
 
-	// Crea la directory .isy
-	err := os.Mkdir(".isy", 0755)
+// stdinIsTerminal indica se l'input arriva da un terminale e non da una pipe o da un file
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func InitProject(opts InitOptions) {
+	opts, err := LoadInitAnswers(opts)
 	if err != nil {
-		fmt.Println("Errore durante la creazione della directory:", err)
+		fmt.Println("Errore:", err)
 		return
 	}
 
+	// Con un file di risposte, --yes o senza terminale non viene chiesto nulla
+	interactive := !opts.NonInteractive && opts.AnswersFile == "" && stdinIsTerminal()
 	reader := bufio.NewReader(os.Stdin)
 
-	// Raccoglie i dati di configurazione dall'utente
-	fmt.Println("Inserisci il nome del progetto:")
-	projectName, _ := reader.ReadString('\n')
-	projectName = strings.TrimSpace(projectName)
+	// Verifica se la directory .isy esiste. La reinizializzazione riscrive solo
+	// i file generati da init: branch, sessioni, journal, comandi, policy e
+	// configurazione locale restano, a meno di chiedere esplicitamente --wipe.
+	isyDir := project.StatePath()
+	_, statErr := os.Stat(isyDir)
+	exists := statErr == nil
+	if exists {
+		if !opts.Force {
+			if !interactive {
+				fmt.Println("Il progetto è già stato inizializzato. Usa --force per reinizializzarlo.")
+				return
+			}
+			fmt.Println("Il progetto è già stato inizializzato.")
+			question := "Vuoi rifare l'init? Branch, sessioni, comandi e gli altri file di .isy vengono mantenuti"
+			if opts.Wipe {
+				question = "Vuoi cancellare l'intera directory .isy (branch, sessioni, journal, comandi, policy) e rifare l'init?"
+			}
+			if !askYesNo(reader, question, false) {
+				fmt.Println("Operazione annullata.")
+				return
+			}
+		}
 
-	fmt.Println("Inserisci il nome dell'autore o dell'azienda:")
-	author, _ := reader.ReadString('\n')
-	author = strings.TrimSpace(author)
+		if opts.Wipe {
+			if err := os.RemoveAll(isyDir); err != nil {
+				fmt.Println("Errore durante la cancellazione della directory:", err)
+				return
+			}
+			exists = false
+		}
+	}
 
-	fmt.Println("Inserisci il linguaggio e/o framework da utilizzare:")
-	languageAndFramework, _ := reader.ReadString('\n')
-	languageAndFramework = strings.TrimSpace(languageAndFramework)
+	// Rileva linguaggio e framework dai file marcatori del progetto
+	stacks := DetectStacks(project.Root())
+	if len(stacks) > 0 {
+		fmt.Println("Stack rilevato:", StacksName(stacks))
+	}
 
-	fmt.Println("Descrivi il progetto (obiettivi, funzionalità, ecc.):")
-	description, _ := reader.ReadString('\n')
-	description = strings.TrimSpace(description)
+	defaultName := filepath.Base(project.Root())
 
-	fmt.Println("Inserisci la tua OpenAI API Key:")
-	apiKey, _ := reader.ReadString('\n')
-	apiKey = strings.TrimSpace(apiKey)
+	// Raccoglie i dati di configurazione dall'utente
+	answer := func(value, question, def string) string {
+		if value != "" {
+			return value
+		}
+		if !interactive {
+			return def
+		}
+		return askLine(reader, question, def)
+	}
+	projectName := answer(opts.ProjectName, "Inserisci il nome del progetto:", defaultName)
+	author := answer(opts.Author, "Inserisci il nome dell'autore o dell'azienda:", "")
+	languageAndFramework := answer(opts.LanguageAndFramework, "Inserisci il linguaggio e/o framework da utilizzare:", StacksName(stacks))
+	description := answer(opts.Description, "Descrivi il progetto (obiettivi, funzionalità, ecc.):", "")
+	apiKey := answer(opts.APIKey, "Inserisci la tua OpenAI API Key (lascia vuoto per usare quella già salvata nella configurazione globale):", "")
+	language := answer(opts.ResponseLanguage, "Inserisci la lingua con cui isy ti risponderà (it, en, ecc):", defaultResponseLanguage)
 
-	fmt.Println("Inserisci la lingua con cui isy ti risponderà (it, en, ecc):")
-	language, _ := reader.ReadString('\n')
-	language = strings.TrimSpace(language)
+	if field, err := LookupField("ia_model_response_language"); err == nil {
+		if _, err := field.Normalize(language); err != nil {
+			fmt.Println("Errore:", err)
+			return
+		}
+	}
+
+	// Crea la directory .isy
+	if !exists {
+		if err := os.Mkdir(isyDir, 0755); err != nil {
+			fmt.Println("Errore durante la creazione della directory:", err)
+			return
+		}
+	}
+
+	// L'API key è una credenziale personale: va nella configurazione globale,
+	// non nel file del progetto che viene condiviso
+	if apiKey != "" {
+		if err := saveGlobalAPIKey(apiKey); err != nil {
+			fmt.Println("Errore durante il salvataggio dell'API key:", err)
+			return
+		}
+	}
 
-	// Aggiungi l'API key alla configurazione
 	config := &Config{
 		ProjectName:             projectName,
 		Author:                  author,
 		LanguageAndFramework:    languageAndFramework,
 		Description:             description,
-		APIKey:                  apiKey, // Salva l'API key
 		IaModelResponseLanguage: language,
 	}
 
@@ -79,13 +196,37 @@ func InitProject() {
 		return
 	}
 
-	fmt.Print("Creazione del file .isycontext per specificare i file da includere nel contesto")
-	err = os.WriteFile(".isycontext", []byte("# Add your file patterns here\n"), 0644)
-	if err != nil {
-		fmt.Println("Errore durante la creazione del file .isycontext:", err)
-		return
+	// Un .isycontext esistente è già stato curato dall'utente e non va sovrascritto
+	contextPath := project.Path(project.ContextFile)
+	gitignorePath := project.Path(".gitignore")
+	if _, err := os.Stat(contextPath); err == nil {
+		fmt.Println("File .isycontext già presente: viene mantenuto.")
+	} else {
+		err = os.WriteFile(contextPath, []byte(DefaultIsyContext(stacks)), 0644)
+		if err != nil {
+			fmt.Println("Errore durante la creazione del file .isycontext:", err)
+			return
+		}
+		fmt.Println("File .isycontext creato per lo stack rilevato. Usa 'isy context --verbose' per vedere i file inclusi.")
+	}
+
+	// La configurazione, i profili, i comandi e la policy di .isy si condividono
+	// nel repository; branch, sessioni, journal e gli altri file di stato no
+	addToGitignore := false
+	switch {
+	case opts.Gitignore != nil:
+		addToGitignore = *opts.Gitignore
+	case interactive && !gitignoreContainsAll(gitignorePath, stateIgnoreEntries):
+		addToGitignore = askYesNo(reader, "Vuoi aggiungere a .gitignore i file di stato di .isy (branch, sessioni, journal, cronologia)?", true)
+	}
+	if addToGitignore {
+		if err := appendToGitignore(gitignorePath, stateIgnoreEntries); err != nil {
+			fmt.Println("Errore durante l'aggiornamento di .gitignore:", err)
+			return
+		}
+	} else if !gitignoreContainsAll(gitignorePath, stateIgnoreEntries) {
+		fmt.Println("Nota: i file di stato di .isy non sono in .gitignore (usa --gitignore per aggiungerli).")
 	}
-	fmt.Println("File .isycontext creato con successo. Puoi modificare il file per aggiungere le regex dei file da includere.")
 
 	fmt.Println("Progetto inizializzato con successo!")
 	fmt.Printf("Nome progetto: %s\n", projectName)
@@ -93,3 +234,115 @@ func InitProject() {
 	fmt.Printf("Linguaggio/Framework: %s\n", languageAndFramework)
 	fmt.Printf("Descrizione: %s\n", description)
 }
+
+// askLine pone una domanda e restituisce la risposta, o il valore predefinito se vuota
+func askLine(reader *bufio.Reader, question, def string) string {
+	if def != "" {
+		question = fmt.Sprintf("%s [%s]", question, def)
+	}
+	fmt.Println(question)
+	line, _ := reader.ReadString('\n')
+	if line = strings.TrimSpace(line); line != "" {
+		return line
+	}
+	return def
+}
+
+// askYesNo pone una domanda s/n con una risposta predefinita
+func askYesNo(reader *bufio.Reader, question string, def bool) bool {
+	hint := "(s/N)"
+	if def {
+		hint = "(S/n)"
+	}
+	fmt.Printf("%s %s: ", question, hint)
+	line, _ := reader.ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "s", "si", "sì", "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	default:
+		return def
+	}
+}
+
+// gitignoreContains indica se un .gitignore contiene già una voce
+func gitignoreContains(path, entry string) bool {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == entry || line == strings.TrimSuffix(entry, "/") || line == "/"+entry {
+			return true
+		}
+	}
+	return false
+}
+
+// gitignoreContainsAll indica se .gitignore contiene già tutte le voci, o
+// ignora per intero .isy per scelta dell'utente
+func gitignoreContainsAll(path string, entries []string) bool {
+	if gitignoreContains(path, project.DirName+"/") {
+		return true
+	}
+	for _, entry := range entries {
+		if !gitignoreContains(path, entry) {
+			return false
+		}
+	}
+	return true
+}
+
+// appendToGitignore aggiunge a .gitignore le voci mancanti, creandolo se serve
+func appendToGitignore(path string, entries []string) error {
+	var missing []string
+	for _, entry := range entries {
+		if !gitignoreContains(path, entry) {
+			missing = append(missing, entry)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(content) > 0 && !strings.HasSuffix(string(content), "\n") {
+		content = append(content, '\n')
+	}
+	content = append(content, []byte("# Stato locale di isy\n"+strings.Join(missing, "\n")+"\n")...)
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Aggiunti a %s: %s\n", path, strings.Join(missing, ", "))
+	return nil
+}
+
+// saveGlobalAPIKey salva l'API key nello store dei segreti e ne scrive il
+// riferimento nella configurazione globale dell'utente. Se lo store non è
+// utilizzabile la chiave resta nel file globale, leggibile solo dall'utente.
+func saveGlobalAPIKey(apiKey string) error {
+	values, err := LoadLayer(LayerGlobal)
+	if err != nil {
+		return err
+	}
+
+	value := apiKey
+	store, err := secrets.Open(SecretsBackend())
+	if err == nil {
+		value, err = StoreSecret(store, SecretName("api_key"), apiKey)
+	}
+	if err != nil {
+		fmt.Println("Impossibile salvare l'API key nello store dei segreti:", err)
+		fmt.Println("La chiave viene salvata nella configurazione globale; spostala in seguito con 'isy secrets migrate'.")
+		value = apiKey
+	} else {
+		fmt.Printf("API key salvata in %s\n", store.Name())
+	}
+
+	values["api_key"] = value
+	return SaveLayer(LayerGlobal, values)
+}
@@ -0,0 +1,296 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"isy-cli/internal/project"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Layer identifica un livello di configurazione. I livelli successivi
+// sovrascrivono i precedenti: global < project < local < env.
+type Layer string
+
+const (
+	LayerDefault Layer = "default"
+	LayerGlobal  Layer = "global"
+	LayerProject Layer = "project"
+	LayerLocal   Layer = "local"
+	LayerEnv     Layer = "env"
+)
+
+// FileLayers sono i livelli salvati su file, in ordine di precedenza crescente
+var FileLayers = []Layer{LayerGlobal, LayerProject, LayerLocal}
+
+const (
+	projectConfigFile = "config.json"
+	localConfigFile   = "config.local.json"
+	envPrefix         = "ISY_"
+)
+
+// LayerPath restituisce il file di un livello di configurazione
+func LayerPath(layer Layer) (string, error) {
+	switch layer {
+	case LayerGlobal:
+		// os.UserConfigDir rispetta XDG_CONFIG_HOME su Linux
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("impossibile determinare la directory di configurazione utente: %v", err)
+		}
+		return filepath.Join(dir, "isy", "config.json"), nil
+	case LayerProject:
+		return project.StatePath(projectConfigFile), nil
+	case LayerLocal:
+		return project.StatePath(localConfigFile), nil
+	default:
+		return "", fmt.Errorf("il livello %s non è salvato su file", layer)
+	}
+}
+
+// LoadLayer legge un livello di configurazione come mappa. Un file mancante
+// corrisponde a un livello vuoto.
+func LoadLayer(layer Layer) (map[string]interface{}, error) {
+	if layer == LayerEnv {
+		return envLayer()
+	}
+
+	path, err := LayerPath(layer)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{})
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore durante l'apertura del file di configurazione %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("errore durante la decodifica del file di configurazione %s: %v", path, err)
+	}
+	return values, nil
+}
+
+// SaveLayer scrive un livello di configurazione su file
+func SaveLayer(layer Layer, values map[string]interface{}) error {
+	path, err := LayerPath(layer)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("errore durante la creazione della directory di configurazione: %v", err)
+	}
+
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return fmt.Errorf("errore durante la serializzazione della configurazione: %v", err)
+	}
+
+	// Il file globale contiene credenziali: lo rende leggibile solo dall'utente
+	perm := os.FileMode(0644)
+	if layer == LayerGlobal {
+		perm = 0600
+	}
+	if err := os.WriteFile(path, append(data, '\n'), perm); err != nil {
+		return fmt.Errorf("errore durante la scrittura del file di configurazione %s: %v", path, err)
+	}
+
+	if layer == LayerLocal {
+		return ensureLocalIgnored()
+	}
+	return nil
+}
+
+// ensureLocalIgnored impedisce che la configurazione locale finisca nel repository
+func ensureLocalIgnored() error {
+	ignorePath := project.StatePath(".gitignore")
+	entry := localConfigFile
+
+	content, err := os.ReadFile(ignorePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("errore durante la lettura di %s: %v", ignorePath, err)
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(line) == entry {
+			return nil
+		}
+	}
+
+	if len(content) > 0 && !strings.HasSuffix(string(content), "\n") {
+		content = append(content, '\n')
+	}
+	content = append(content, []byte(entry+"\n")...)
+	if err := os.WriteFile(ignorePath, content, 0644); err != nil {
+		return fmt.Errorf("errore durante la scrittura di %s: %v", ignorePath, err)
+	}
+	return nil
+}
+
+// Origins associa a ogni chiave foglia (es. "embeddings.base_url") il livello da cui proviene
+type Origins map[string]Layer
+
+// LoadLayered unisce i livelli di configurazione e restituisce la configurazione
+// effettiva insieme all'origine di ogni valore
+func LoadLayered() (*Config, Origins, error) {
+	if _, err := os.Stat(project.StatePath(projectConfigFile)); err != nil {
+		return nil, nil, fmt.Errorf("nessun progetto isy trovato in %s o nelle directory superiori: esegui 'isy init' (%v)", project.Root(), err)
+	}
+
+	merged := make(map[string]interface{})
+	origins := make(Origins)
+
+	for _, layer := range append(append([]Layer{}, FileLayers...), LayerEnv) {
+		values, err := LoadLayer(layer)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Gli hook e i controlli del repository si eseguono solo dopo 'isy trust'
+		if layer == LayerProject {
+			if err := filterUntrusted(values); err != nil {
+				return nil, nil, err
+			}
+		}
+		mergeInto(merged, values, "", layer, origins)
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, nil, fmt.Errorf("errore durante l'unione della configurazione: %v", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, nil, fmt.Errorf("errore durante la decodifica della configurazione: %v", err)
+	}
+
+	return &config, origins, nil
+}
+
+// mergeInto copia src in dst ricorsivamente, registrando l'origine delle foglie
+func mergeInto(dst, src map[string]interface{}, prefix string, layer Layer, origins Origins) {
+	for key, value := range src {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		if nested, ok := value.(map[string]interface{}); ok {
+			existing, ok := dst[key].(map[string]interface{})
+			if !ok {
+				existing = make(map[string]interface{})
+				dst[key] = existing
+				clearOrigins(origins, path)
+			}
+			mergeInto(existing, nested, path, layer, origins)
+			continue
+		}
+
+		dst[key] = value
+		clearOrigins(origins, path)
+		origins[path] = layer
+	}
+}
+
+// clearOrigins dimentica le origini sotto un percorso che viene sovrascritto
+func clearOrigins(origins Origins, path string) {
+	for key := range origins {
+		if key == path || strings.HasPrefix(key, path+".") {
+			delete(origins, key)
+		}
+	}
+}
+
+// Flatten restituisce le foglie di una configurazione come coppie chiave puntata -> valore
+func Flatten(values map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{})
+	var walk func(map[string]interface{}, string)
+	walk = func(m map[string]interface{}, prefix string) {
+		for key, value := range m {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+				walk(nested, path)
+				continue
+			}
+			flat[path] = value
+		}
+	}
+	walk(values, "")
+	return flat
+}
+
+// ToMap converte una configurazione nella sua rappresentazione JSON generica
+func ToMap(config *Config) (map[string]interface{}, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{})
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// SortedKeys restituisce le chiavi di una mappa in ordine alfabetico
+func SortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// EnvName restituisce la variabile d'ambiente che sovrascrive una chiave,
+// es. embeddings.base_url -> ISY_EMBEDDINGS_BASE_URL
+func EnvName(key string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// envLayer legge le variabili ISY_* che corrispondono a chiavi note della configurazione
+func envLayer() (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	for _, field := range Schema() {
+		// Le chiavi con un nome libero (come i profili) non hanno una variabile
+		if strings.Contains(field.Key, "*") {
+			continue
+		}
+		raw, ok := os.LookupEnv(EnvName(field.Key))
+		if !ok {
+			continue
+		}
+
+		value, err := field.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", EnvName(field.Key), err)
+		}
+		setPath(values, field.Key, value)
+	}
+
+	return values, nil
+}
+
+// setPath imposta un valore in una mappa annidata seguendo una chiave puntata
+func setPath(values map[string]interface{}, key string, value interface{}) {
+	parts := strings.Split(key, ".")
+	current := values
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[part] = next
+		}
+		current = next
+	}
+	current[parts[len(parts)-1]] = value
+}
@@ -0,0 +1,378 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"isy-cli/internal/secrets"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Field descrive una chiave della configurazione e i valori che accetta
+type Field struct {
+	Key     string         // Percorso puntato; "*" indica un nome libero (es. profiles.*.mode)
+	Type    reflect.Type   // Tipo Go del campo
+	Enum    []string       // Valori ammessi, se limitati
+	Pattern *regexp.Regexp // Formato richiesto per le stringhe
+	Min     *float64       // Minimo per i numeri
+	Max     *float64       // Massimo per i numeri
+	Secret  bool           // Credenziale da non mostrare in chiaro
+}
+
+func bound(v float64) *float64 {
+	return &v
+}
+
+// constraints aggiunge i vincoli ai campi ricavati dalla struct Config
+var constraints = map[string]Field{
+	"model":                      {Pattern: regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:/-]*$`)},
+	"api_key":                    {Secret: true},
+	"ia_model_response_language": {Pattern: regexp.MustCompile(`^[a-z]{2,3}([-_][A-Za-z]{2,4})?$`)},
+
+	"run.max_retries": {Min: bound(0), Max: bound(10)},
+	"run.temperature": {Min: bound(0), Max: bound(2)},
+	"run.timeout":     {Min: bound(0)},
+
+	"compaction.threshold":  {Min: bound(0)},
+	"compaction.keep_turns": {Min: bound(0), Max: bound(50)},
+
+	"tools.budget":          {Min: bound(0), Max: bound(100)},
+	"tools.command_timeout": {Min: bound(0)},
+
+	"code.edit_format": {Enum: []string{EditFormatJSON, EditFormatDiff}},
+
+	"verify.timeout":      {Min: bound(0)},
+	"verify.max_feedback": {Min: bound(0), Max: bound(10)},
+
+	"hooks.timeout": {Min: bound(0)},
+
+	"context.mode":    {Enum: []string{ModeFull, ModeOutline}},
+	"context.budget":  {Min: bound(0)},
+	"context.profile": {Pattern: regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)},
+
+	"profiles.*.mode":   {Enum: []string{ModeFull, ModeOutline}},
+	"profiles.*.budget": {Min: bound(0)},
+
+	"embeddings.provider":    {Enum: []string{"openai", "hash"}},
+	"embeddings.base_url":    {Pattern: regexp.MustCompile(`^https?://`)},
+	"embeddings.model":       {Pattern: regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:/-]*$`)},
+	"embeddings.api_key":     {Secret: true},
+	"embeddings.dimensions":  {Min: bound(1), Max: bound(8192)},
+	"embeddings.top_k":       {Min: bound(1), Max: bound(100)},
+	"embeddings.chunk_lines": {Min: bound(5), Max: bound(1000)},
+
+	"redaction.entropy_threshold": {Min: bound(0), Max: bound(8)},
+
+	"secrets.backend": {Enum: []string{secrets.BackendAuto, secrets.BackendKeyring, secrets.BackendFile}},
+}
+
+// Modalità di resa dei file nel contesto, condivise con il pacchetto context
+const (
+	ModeFull    = "full"
+	ModeOutline = "outline"
+)
+
+// Formati delle risposte di code
+const (
+	EditFormatJSON = "json"
+	EditFormatDiff = "diff"
+)
+
+// Schema restituisce tutte le chiavi foglia della configurazione, in ordine alfabetico
+func Schema() []Field {
+	var fields []Field
+	collectFields(reflect.TypeOf(Config{}), "", &fields)
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Key < fields[j].Key
+	})
+	return fields
+}
+
+func collectFields(t reflect.Type, prefix string, fields *[]Field) {
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		name := strings.Split(structField.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		fieldType := structField.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+
+		switch {
+		case fieldType.Kind() == reflect.Struct:
+			collectFields(fieldType, path, fields)
+		case fieldType.Kind() == reflect.Map && fieldType.Elem().Kind() == reflect.Struct:
+			collectFields(fieldType.Elem(), path+".*", fields)
+		default:
+			field := constraints[path]
+			field.Key = path
+			field.Type = fieldType
+			*fields = append(*fields, field)
+		}
+	}
+}
+
+// LookupField trova lo schema di una chiave foglia, es. profiles.backend.budget
+func LookupField(key string) (Field, error) {
+	for _, field := range Schema() {
+		if keyMatches(field.Key, key) {
+			return field, nil
+		}
+	}
+	if IsSection(key) {
+		return Field{}, fmt.Errorf("%s è una sezione, non una chiave: indica uno dei suoi campi", key)
+	}
+	return Field{}, fmt.Errorf("chiave di configurazione sconosciuta: %s", key)
+}
+
+// IsSection indica se una chiave è il prefisso di altre chiavi (es. embeddings)
+func IsSection(key string) bool {
+	for _, field := range Schema() {
+		parts := strings.Split(field.Key, ".")
+		keyParts := strings.Split(key, ".")
+		if len(keyParts) < len(parts) && keyMatches(strings.Join(parts[:len(keyParts)], "."), key) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyMatches confronta una chiave con un percorso dello schema, dove "*" vale qualsiasi nome
+func keyMatches(pattern, key string) bool {
+	patternParts := strings.Split(pattern, ".")
+	keyParts := strings.Split(key, ".")
+	if len(patternParts) != len(keyParts) {
+		return false
+	}
+	for i, part := range patternParts {
+		if keyParts[i] == "" || (part != "*" && part != keyParts[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// TypeName descrive il tipo del campo in modo leggibile
+func (f Field) TypeName() string {
+	switch f.Type.Kind() {
+	case reflect.Slice:
+		if f.Type.Elem().Kind() == reflect.String {
+			return "list"
+		}
+		return "json-list"
+	case reflect.Int, reflect.Int64:
+		return "int"
+	case reflect.Float64:
+		return "number"
+	default:
+		return f.Type.Kind().String()
+	}
+}
+
+// Constraint descrive i vincoli del campo, o una stringa vuota se non ne ha
+func (f Field) Constraint() string {
+	var parts []string
+	if len(f.Enum) > 0 {
+		parts = append(parts, "one of "+strings.Join(f.Enum, "|"))
+	}
+	if f.Pattern != nil {
+		parts = append(parts, "matches "+f.Pattern.String())
+	}
+	if f.Min != nil && f.Max != nil {
+		parts = append(parts, fmt.Sprintf("%g..%g", *f.Min, *f.Max))
+	} else if f.Min != nil {
+		parts = append(parts, fmt.Sprintf(">= %g", *f.Min))
+	} else if f.Max != nil {
+		parts = append(parts, fmt.Sprintf("<= %g", *f.Max))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Parse converte un valore testuale (da riga di comando o da variabile
+// d'ambiente) nel tipo del campo e lo valida
+func (f Field) Parse(raw string) (interface{}, error) {
+	var value interface{}
+	switch f.Type.Kind() {
+	case reflect.String:
+		value = raw
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: valore booleano non valido: %s", f.Key, raw)
+		}
+		value = parsed
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: valore intero non valido: %s", f.Key, raw)
+		}
+		value = parsed
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: valore numerico non valido: %s", f.Key, raw)
+		}
+		value = parsed
+	case reflect.Slice:
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(raw), &parsed); err == nil {
+			value = parsed
+		} else if f.Type.Elem().Kind() == reflect.String {
+			// Una lista di stringhe può essere indicata anche separata da virgole
+			var items []interface{}
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			value = items
+		} else {
+			return nil, fmt.Errorf("%s: attesa una lista JSON: %v", f.Key, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: tipo non supportato: %s", f.Key, f.Type)
+	}
+	return f.Normalize(value)
+}
+
+// Normalize verifica che un valore abbia il tipo del campo e rispetti i suoi
+// vincoli, e lo restituisce nella forma generica usata nei file JSON
+func (f Field) Normalize(value interface{}) (interface{}, error) {
+	if raw, ok := value.(string); ok && f.Type.Kind() != reflect.String {
+		return f.Parse(raw)
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: valore non valido: %v", f.Key, err)
+	}
+	typed := reflect.New(f.Type)
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(typed.Interface()); err != nil {
+		return nil, fmt.Errorf("%s: atteso un valore di tipo %s: %v", f.Key, f.TypeName(), err)
+	}
+
+	if err := f.validate(typed.Elem()); err != nil {
+		return nil, err
+	}
+
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, fmt.Errorf("%s: valore non valido: %v", f.Key, err)
+	}
+	return normalized, nil
+}
+
+func (f Field) validate(value reflect.Value) error {
+	switch value.Kind() {
+	case reflect.String:
+		s := value.String()
+		if len(f.Enum) > 0 {
+			for _, allowed := range f.Enum {
+				if s == allowed {
+					return nil
+				}
+			}
+			return fmt.Errorf("%s: valore %q non ammesso (valori validi: %s)", f.Key, s, strings.Join(f.Enum, ", "))
+		}
+		if f.Pattern != nil && !f.Pattern.MatchString(s) {
+			return fmt.Errorf("%s: valore %q non valido (formato atteso: %s)", f.Key, s, f.Pattern)
+		}
+	case reflect.Int, reflect.Int64, reflect.Float64:
+		var n float64
+		if value.Kind() == reflect.Float64 {
+			n = value.Float()
+		} else {
+			n = float64(value.Int())
+		}
+		if f.Min != nil && n < *f.Min {
+			return fmt.Errorf("%s: il valore %g è inferiore al minimo %g", f.Key, n, *f.Min)
+		}
+		if f.Max != nil && n > *f.Max {
+			return fmt.Errorf("%s: il valore %g supera il massimo %g", f.Key, n, *f.Max)
+		}
+	}
+	return nil
+}
+
+// SetKey valida e imposta una chiave in un livello di configurazione su file
+func SetKey(layer Layer, key string, raw string) error {
+	field, err := LookupField(key)
+	if err != nil {
+		return err
+	}
+	value, err := field.Parse(raw)
+	if err != nil {
+		return err
+	}
+
+	values, err := LoadLayer(layer)
+	if err != nil {
+		return err
+	}
+	setPath(values, key, value)
+	return SaveLayer(layer, values)
+}
+
+// UnsetKey rimuove una chiave (o un'intera sezione) da un livello di configurazione.
+// Restituisce false se la chiave non era impostata in quel livello.
+func UnsetKey(layer Layer, key string) (bool, error) {
+	if _, err := LookupField(key); err != nil && !IsSection(key) {
+		return false, err
+	}
+
+	values, err := LoadLayer(layer)
+	if err != nil {
+		return false, err
+	}
+	if !deletePath(values, strings.Split(key, ".")) {
+		return false, nil
+	}
+	return true, SaveLayer(layer, values)
+}
+
+// GetPath restituisce il valore di una chiave puntata in una mappa annidata
+func GetPath(values map[string]interface{}, key string) (interface{}, bool) {
+	var current interface{} = values
+	for _, part := range strings.Split(key, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// deletePath rimuove una chiave e le sezioni rimaste vuote
+func deletePath(values map[string]interface{}, parts []string) bool {
+	if len(parts) == 1 {
+		if _, ok := values[parts[0]]; !ok {
+			return false
+		}
+		delete(values, parts[0])
+		return true
+	}
+
+	nested, ok := values[parts[0]].(map[string]interface{})
+	if !ok || !deletePath(nested, parts[1:]) {
+		return false
+	}
+	if len(nested) == 0 {
+		delete(values, parts[0])
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"isy-cli/internal/secrets"
+	"strings"
+)
+
+// SecretsConfig sceglie dove vengono conservate le credenziali
+type SecretsConfig struct {
+	Backend string `json:"backend"` // "auto" (default), "keyring" oppure "file"
+}
+
+// Nomi con cui le credenziali della configurazione vengono salvate nello store
+var secretNames = map[string]string{
+	"api_key":            "openai-api-key",
+	"embeddings.api_key": "embeddings-api-key",
+}
+
+// SecretName restituisce il nome con cui salvare nello store il valore di una chiave
+func SecretName(key string) string {
+	if name, ok := secretNames[key]; ok {
+		return name
+	}
+	return strings.ReplaceAll(key, ".", "-")
+}
+
+// ResolveSecret restituisce il valore di un campo che può contenere un
+// riferimento "secret:<nome>" a una credenziale
+func (c *Config) ResolveSecret(value string) (string, error) {
+	return secrets.Resolve(c.Secrets.Backend, value)
+}
+
+// SecretsBackend restituisce il backend configurato anche fuori da un progetto
+// inizializzato, leggendo i livelli disponibili
+func SecretsBackend() string {
+	backend := ""
+	for _, layer := range append(append([]Layer{}, FileLayers...), LayerEnv) {
+		values, err := LoadLayer(layer)
+		if err != nil {
+			continue
+		}
+		if value, ok := GetPath(values, "secrets.backend"); ok {
+			if s, ok := value.(string); ok && s != "" {
+				backend = s
+			}
+		}
+	}
+	return backend
+}
+
+// StoreSecret salva una credenziale nello store e restituisce il riferimento
+// da scrivere nella configurazione. Se il nome è già usato per un valore
+// diverso, ne sceglie uno nuovo per non sovrascrivere la credenziale esistente.
+func StoreSecret(store secrets.Store, name, value string) (string, error) {
+	existing, err := store.Get(name)
+	if err != nil && !errors.As(err, &secrets.ErrNotFound{}) {
+		return "", err
+	}
+	if err == nil && existing != value {
+		sum := sha256.Sum256([]byte(value))
+		name = name + "-" + hex.EncodeToString(sum[:4])
+	}
+
+	if err := store.Set(name, value); err != nil {
+		return "", err
+	}
+	return secrets.Ref(name), nil
+}
+
+// Migration descrive una credenziale spostata fuori da un file di configurazione
+type Migration struct {
+	Layer Layer
+	Key   string
+	Ref   string
+}
+
+// MigrateSecrets sposta nello store le credenziali in chiaro presenti nei file
+// di configurazione, sostituendole con un riferimento
+func MigrateSecrets(store secrets.Store) ([]Migration, error) {
+	var migrations []Migration
+
+	for _, layer := range FileLayers {
+		values, err := LoadLayer(layer)
+		if err != nil {
+			return migrations, err
+		}
+
+		changed := false
+		for _, field := range Schema() {
+			if !field.Secret || strings.Contains(field.Key, "*") {
+				continue
+			}
+			value, ok := GetPath(values, field.Key)
+			if !ok {
+				continue
+			}
+			plaintext, ok := value.(string)
+			if !ok || plaintext == "" {
+				continue
+			}
+			if _, isRef := secrets.RefName(plaintext); isRef {
+				continue
+			}
+
+			ref, err := StoreSecret(store, SecretName(field.Key), plaintext)
+			if err != nil {
+				return migrations, fmt.Errorf("errore durante il salvataggio di %s: %v", field.Key, err)
+			}
+
+			setPath(values, field.Key, ref)
+			changed = true
+			migrations = append(migrations, Migration{Layer: layer, Key: field.Key, Ref: ref})
+		}
+
+		if changed {
+			if err := SaveLayer(layer, values); err != nil {
+				return migrations, err
+			}
+		}
+	}
+
+	return migrations, nil
+}
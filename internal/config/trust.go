@@ -0,0 +1,198 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"isy-cli/internal/project"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// trustFile registra i progetti di cui l'utente ha approvato i comandi. Sta
+// accanto alla configurazione globale, fuori dal repository: un progetto non
+// può dichiararsi fidato da solo.
+const trustFile = "trusted.json"
+
+// Chiavi del livello di progetto che eseguono comandi della shell. Arrivano
+// con il repository, quindi vengono usate solo se il progetto è fidato.
+var commandKeys = [][]string{{"hooks"}, {"verify", "hooks"}}
+
+// TrustRecord è l'approvazione dei comandi di un progetto. Fingerprint riassume
+// i comandi approvati: se cambiano (es. dopo un pull) vanno approvati di nuovo.
+type TrustRecord struct {
+	Fingerprint string    `json:"fingerprint"`
+	Trusted     time.Time `json:"trusted"`
+}
+
+var untrustedWarning sync.Once
+
+// trustPath restituisce il file dei progetti fidati
+func trustPath() (string, error) {
+	global, err := LayerPath(LayerGlobal)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(global), trustFile), nil
+}
+
+func loadTrustRecords() (map[string]TrustRecord, error) {
+	path, err := trustPath()
+	if err != nil {
+		return nil, err
+	}
+	records := make(map[string]TrustRecord)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore durante la lettura di %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("errore durante la decodifica di %s: %v", path, err)
+	}
+	return records, nil
+}
+
+func saveTrustRecords(records map[string]TrustRecord) error {
+	path, err := trustPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("errore durante la creazione della directory di configurazione: %v", err)
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("errore durante la serializzazione dei progetti fidati: %v", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("errore durante la scrittura di %s: %v", path, err)
+	}
+	return nil
+}
+
+// ProjectCommands restituisce i comandi della shell definiti nel livello di
+// progetto (hook e controlli), come chiave puntata -> valore. Vuoto se non ce ne sono.
+func ProjectCommands() (map[string]interface{}, error) {
+	values, err := LoadLayer(LayerProject)
+	if err != nil {
+		return nil, err
+	}
+	return projectCommands(values), nil
+}
+
+func projectCommands(values map[string]interface{}) map[string]interface{} {
+	commands := make(map[string]interface{})
+	for _, key := range commandKeys {
+		current := values
+		for i, part := range key {
+			value, ok := current[part]
+			if !ok {
+				break
+			}
+			if i == len(key)-1 {
+				commands[strings.Join(key, ".")] = value
+				break
+			}
+			if current, ok = value.(map[string]interface{}); !ok {
+				break
+			}
+		}
+	}
+	return commands
+}
+
+// removeProjectCommands toglie dal livello di progetto le chiavi che eseguono comandi
+func removeProjectCommands(values map[string]interface{}) {
+	for _, key := range commandKeys {
+		current := values
+		for _, part := range key[:len(key)-1] {
+			next, ok := current[part].(map[string]interface{})
+			if !ok {
+				current = nil
+				break
+			}
+			current = next
+		}
+		if current != nil {
+			delete(current, key[len(key)-1])
+		}
+	}
+}
+
+// fingerprint riassume i comandi del progetto (json.Marshal ordina le chiavi)
+func fingerprint(commands map[string]interface{}) string {
+	data, _ := json.Marshal(commands)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ProjectTrusted indica se l'utente ha approvato i comandi attuali del progetto.
+// Un progetto senza comandi è sempre fidato.
+func ProjectTrusted() (bool, error) {
+	commands, err := ProjectCommands()
+	if err != nil {
+		return false, err
+	}
+	return trusted(commands)
+}
+
+func trusted(commands map[string]interface{}) (bool, error) {
+	if len(commands) == 0 {
+		return true, nil
+	}
+	records, err := loadTrustRecords()
+	if err != nil {
+		return false, err
+	}
+	record, ok := records[project.Root()]
+	return ok && record.Fingerprint == fingerprint(commands), nil
+}
+
+// TrustProject approva i comandi attuali del progetto
+func TrustProject() error {
+	commands, err := ProjectCommands()
+	if err != nil {
+		return err
+	}
+	records, err := loadTrustRecords()
+	if err != nil {
+		return err
+	}
+	records[project.Root()] = TrustRecord{Fingerprint: fingerprint(commands), Trusted: time.Now()}
+	return saveTrustRecords(records)
+}
+
+// RevokeProjectTrust ritira l'approvazione dei comandi del progetto
+func RevokeProjectTrust() error {
+	records, err := loadTrustRecords()
+	if err != nil {
+		return err
+	}
+	if _, ok := records[project.Root()]; !ok {
+		return nil
+	}
+	delete(records, project.Root())
+	return saveTrustRecords(records)
+}
+
+// filterUntrusted toglie dal livello di progetto i comandi non approvati,
+// segnalandolo una volta per esecuzione. Restano quelli dei livelli globale e
+// locale, che non arrivano con il repository.
+func filterUntrusted(values map[string]interface{}) error {
+	ok, err := trusted(projectCommands(values))
+	if err != nil || ok {
+		return err
+	}
+	removeProjectCommands(values)
+	untrustedWarning.Do(func() {
+		fmt.Fprintln(os.Stderr, "Il progetto definisce hook o controlli non ancora approvati: non vengono eseguiti. Controllali con 'isy trust' e approvali con 'isy trust --yes'.")
+	})
+	return nil
+}
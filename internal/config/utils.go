@@ -1,95 +1,234 @@
 package config
 
 import (
-	"encoding/json"
 	"fmt"
-	"os"
+	"path"
 )
 
 // Config rappresenta la struttura del file di configurazione
 type Config struct {
-	ProjectName             string `json:"project_name"`
-	Author                  string `json:"author"`
-	LanguageAndFramework    string `json:"language_and_framework"`
-	Description             string `json:"description"`
-	APIKey                  string `json:"api_key"`                    // Nuovo campo
-	IaModelResponseLanguage string `json:"ia_model_response_language"` // Nuovo campo
+	ProjectName             string                   `json:"project_name"`
+	Author                  string                   `json:"author"`
+	LanguageAndFramework    string                   `json:"language_and_framework"`
+	Description             string                   `json:"description"`
+	APIKey                  string                   `json:"api_key"`                    // Nuovo campo
+	IaModelResponseLanguage string                   `json:"ia_model_response_language"` // Nuovo campo
+	Model                   string                   `json:"model"`                      // Modello di chat (default gpt-4o)
+	Pricing                 []ModelPricing           `json:"pricing"`                    // Prezzi dei modelli, prima di quelli noti a isy
+	Run                     RunConfig                `json:"run"`
+	Compaction              CompactionConfig         `json:"compaction"`
+	Tools                   ToolsConfig              `json:"tools"`
+	Code                    CodeConfig               `json:"code"`
+	Verify                  VerifyConfig             `json:"verify"`
+	Hooks                   HooksConfig              `json:"hooks"`
+	Embeddings              EmbeddingsConfig         `json:"embeddings"`
+	Context                 ContextConfig            `json:"context"`
+	Profiles                map[string]ProfileConfig `json:"profiles,omitempty"`
+	Redaction               RedactionConfig          `json:"redaction"`
+	Secrets                 SecretsConfig            `json:"secrets"`
 }
 
-// LoadConfig legge il file di configurazione e restituisce un oggetto Config
-func LoadConfig() (*Config, error) {
-	configPath := ".isy/config.json"
-	configFile, err := os.Open(configPath)
-	if err != nil {
-		return nil, fmt.Errorf("errore durante l'apertura del file di configurazione: %v", err)
-	}
-	defer configFile.Close()
+// RunConfig controlla le richieste al modello
+type RunConfig struct {
+	MaxRetries  int      `json:"max_retries"`           // Tentativi in caso di errore (default 5)
+	Temperature *float64 `json:"temperature,omitempty"` // Temperatura di campionamento (default del modello)
+	Timeout     int      `json:"timeout"`               // Timeout di ogni richiesta in secondi (0 = nessuno)
+}
 
-	var config Config
-	decoder := json.NewDecoder(configFile)
-	err = decoder.Decode(&config)
-	if err != nil {
-		return nil, fmt.Errorf("errore durante la decodifica del file di configurazione: %v", err)
+// ModelPricing è il prezzo di un modello, in USD per milione di token
+type ModelPricing struct {
+	Model  string  `json:"model"`  // Nome del modello, anche glob (es. gpt-4.1*)
+	Input  float64 `json:"input"`  // Token di input
+	Output float64 `json:"output"` // Token di output
+}
+
+// CompactionConfig controlla la compattazione automatica delle conversazioni di ask e code
+type CompactionConfig struct {
+	Disabled  bool `json:"disabled"`   // Disattiva la compattazione automatica
+	Threshold int  `json:"threshold"`  // Token oltre i quali compattare (default 60000)
+	KeepTurns int  `json:"keep_turns"` // Scambi recenti mai riassunti (default 4)
+}
+
+// ToolsConfig controlla le funzioni che il modello può chiamare durante ask e code
+type ToolsConfig struct {
+	Disabled        bool `json:"disabled"`         // Il modello vede solo il contesto inviato
+	Budget          int  `json:"budget"`           // Chiamate per richiesta (default 10)
+	DisableCommands bool `json:"disable_commands"` // Non offre run_command, che chiede sempre conferma
+	CommandTimeout  int  `json:"command_timeout"`  // Timeout di ogni comando in secondi (default 60)
+}
+
+// CodeConfig controlla il formato delle modifiche proposte da code
+type CodeConfig struct {
+	EditFormat string   `json:"edit_format"` // "json" (default): elenco di modifiche; "diff": patch unified diff
+	DiffModels []string `json:"diff_models"` // Modelli (anche glob, es. gpt-4.1*) che rispondono sempre con una patch
+}
+
+// EditFormatFor restituisce il formato delle risposte da chiedere al modello indicato
+func (c CodeConfig) EditFormatFor(model string) string {
+	for _, pattern := range c.DiffModels {
+		if matched, err := path.Match(pattern, model); err == nil && matched {
+			return EditFormatDiff
+		}
 	}
-	return &config, nil
+	if c.EditFormat != "" {
+		return c.EditFormat
+	}
+	return EditFormatJSON
+}
+
+// VerifyConfig controlla i controlli eseguiti nel branch dopo ogni risposta applicata da code
+type VerifyConfig struct {
+	Disabled    bool         `json:"disabled"`     // Non esegue i controlli
+	Hooks       []VerifyHook `json:"hooks"`        // Controlli, nell'ordine in cui vengono eseguiti
+	Timeout     int          `json:"timeout"`      // Timeout di ogni controllo in secondi (default 300)
+	Feedback    bool         `json:"feedback"`     // Rimanda al modello l'esito dei controlli falliti
+	MaxFeedback int          `json:"max_feedback"` // Correzioni automatiche di seguito senza REPL (default 2)
+}
+
+// VerifyHook è un comando eseguito nel branch dopo le modifiche, es. go vet ./...
+type VerifyHook struct {
+	Name     string   `json:"name"`
+	Command  string   `json:"command"`  // Eseguito con sh -c nella directory del branch
+	Language string   `json:"language"` // Parte solo se cambiano file del linguaggio (es. go)
+	Files    []string `json:"files"`    // Parte solo se cambiano file corrispondenti, nella sintassi di .isycontext
+}
+
+// HooksConfig elenca i comandi dell'utente eseguiti nei punti di estensione di
+// isy. Ogni hook riceve l'operazione in JSON su stdin e può modificarla o bloccarla.
+type HooksConfig struct {
+	Timeout       int          `json:"timeout"`        // Timeout di ogni hook in secondi (default 30)
+	BeforeContext []HookConfig `json:"before_context"` // Prima di costruire il contesto di una sessione
+	BeforeRequest []HookConfig `json:"before_request"` // Prima di inviare una richiesta al modello
+	AfterResponse []HookConfig `json:"after_response"` // Dopo la risposta del modello
+	BeforeApply   []HookConfig `json:"before_apply"`   // Prima di applicare le modifiche al branch
+	AfterApply    []HookConfig `json:"after_apply"`    // Dopo aver applicato le modifiche al branch
+	AfterRun      []HookConfig `json:"after_run"`      // Al termine di un comando
+}
+
+// HookConfig è un comando eseguito in un punto di estensione
+type HookConfig struct {
+	Name     string   `json:"name"`
+	Command  string   `json:"command"`  // Eseguito con sh -c nella radice del progetto
+	Commands []string `json:"commands"` // Comandi di isy in cui eseguirlo, es. code (default: tutti)
+	Timeout  int      `json:"timeout"`  // Sostituisce hooks.timeout per questo hook
+	Required bool     `json:"required"` // Se l'hook fallisce l'operazione si interrompe, invece di proseguire
+}
+
+// RedactionConfig controlla la rimozione dei segreti prima di ogni richiesta esterna
+type RedactionConfig struct {
+	Disabled         bool               `json:"disabled"`          // Disattiva del tutto la redazione
+	DisableEntropy   bool               `json:"disable_entropy"`   // Disattiva il rilevamento per entropia
+	EntropyThreshold float64            `json:"entropy_threshold"` // Soglia in bit per carattere (default 4.0)
+	Patterns         []RedactionPattern `json:"patterns"`          // Pattern aggiuntivi definiti dal progetto
+	Allow            []string           `json:"allow"`             // Regex dei valori da non redigere mai
+}
+
+// RedactionPattern è un pattern di segreto specifico del progetto
+type RedactionPattern struct {
+	Name  string `json:"name"`
+	Regex string `json:"regex"` // Se ha gruppi viene sostituito solo il primo
 }
 
-// SaveConfig salva un oggetto Config nel file specificato
+// ProfileConfig definisce un profilo di contesto direttamente nella configurazione
+type ProfileConfig struct {
+	Description string   `json:"description"`
+	Include     []string `json:"include"`                // Pattern inclusi, nella sintassi di .isycontext
+	Exclude     []string `json:"exclude"`                // Pattern esclusi (senza "!")
+	Budget      int      `json:"budget"`                 // Limite di token per i file (0 = nessun limite)
+	Mode        string   `json:"mode"`                   // "full" oppure "outline"
+	LineNumbers *bool    `json:"line_numbers,omitempty"` // Numeri di riga nei file (default: sì)
+}
+
+// ContextConfig controlla come vengono resi i file nel contesto
+type ContextConfig struct {
+	Mode             string `json:"mode"`              // "full" (default) oppure "outline" per i file Go
+	RespectGitignore bool   `json:"respect_gitignore"` // Esclude i file ignorati da .gitignore
+	Profile          string `json:"profile"`           // Profilo usato quando non ne viene indicato uno
+	Budget           int    `json:"budget"`            // Limite di token per i file (0 = nessun limite)
+}
+
+// EmbeddingsConfig configura il recupero semantico del contesto
+type EmbeddingsConfig struct {
+	Enabled    bool   `json:"enabled"`     // Se attivo, ask e code scelgono il contesto per similarità
+	Provider   string `json:"provider"`    // "openai" (endpoint compatibile) oppure "hash" (deterministico, offline)
+	BaseURL    string `json:"base_url"`    // Endpoint compatibile con OpenAI, es. http://localhost:8089/v1
+	Model      string `json:"model"`       // Modello di embedding
+	APIKey     string `json:"api_key"`     // Se vuota viene usata la chiave principale
+	Dimensions int    `json:"dimensions"`  // Dimensione dei vettori (usata dal provider hash)
+	TopK       int    `json:"top_k"`       // Numero di chunk da includere per ogni richiesta
+	ChunkLines int    `json:"chunk_lines"` // Numero di righe per chunk
+}
+
+// LoadConfig restituisce la configurazione effettiva, unendo il file globale,
+// quello del progetto, quello locale e le variabili d'ambiente ISY_*
+func LoadConfig() (*Config, error) {
+	config, _, err := LoadLayered()
+	return config, err
+}
+
+// SaveConfig salva un oggetto Config nel file del progetto. I valori vuoti non
+// vengono scritti, così non nascondono quelli del file globale.
 func SaveConfig(config *Config) error {
-	configPath := ".isy/config.json"
-	configFile, err := os.Create(configPath)
+	values, err := ToMap(config)
 	if err != nil {
-		return fmt.Errorf("errore durante la creazione del file di configurazione: %v", err)
+		return fmt.Errorf("errore durante la serializzazione della configurazione: %v", err)
 	}
-	defer configFile.Close()
+	return SaveLayer(LayerProject, pruneEmpty(values))
+}
 
-	encoder := json.NewEncoder(configFile)
-	encoder.SetIndent("", "  ") // Formatta il JSON con indentazione
-	err = encoder.Encode(config)
-	if err != nil {
-		return fmt.Errorf("errore durante la scrittura del file di configurazione: %v", err)
+// pruneEmpty rimuove ricorsivamente i valori nulli, vuoti o a zero
+func pruneEmpty(values map[string]interface{}) map[string]interface{} {
+	for key, value := range values {
+		switch v := value.(type) {
+		case nil:
+			delete(values, key)
+		case string:
+			if v == "" {
+				delete(values, key)
+			}
+		case bool:
+			if !v {
+				delete(values, key)
+			}
+		case float64:
+			if v == 0 {
+				delete(values, key)
+			}
+		case []interface{}:
+			if len(v) == 0 {
+				delete(values, key)
+			}
+		case map[string]interface{}:
+			if len(pruneEmpty(v)) == 0 {
+				delete(values, key)
+			}
+		}
 	}
-	return nil
+	return values
 }
 
-// UpdateConfig aggiorna uno o più campi della configurazione e salva i cambiamenti
+// UpdateConfig aggiorna uno o più campi della configurazione del progetto e
+// salva i cambiamenti. Le chiavi sono percorsi puntati (es. "embeddings.top_k")
+// e ogni valore viene validato con lo schema prima di scrivere il file.
 func UpdateConfig(updates map[string]interface{}) error {
-	config, err := LoadConfig()
+	values, err := LoadLayer(LayerProject)
 	if err != nil {
 		return err
 	}
 
 	// Applica gli aggiornamenti
 	for key, value := range updates {
-		switch key {
-		case "project_name":
-			if v, ok := value.(string); ok {
-				config.ProjectName = v
-			}
-		case "author":
-			if v, ok := value.(string); ok {
-				config.Author = v
-			}
-		case "language_and_framework":
-			if v, ok := value.(string); ok {
-				config.LanguageAndFramework = v
-			}
-		case "description":
-			if v, ok := value.(string); ok {
-				config.Description = v
-			}
-		case "api_key":
-			if v, ok := value.(string); ok {
-				config.APIKey = v
-			}
-		case "ia_model_response_language":
-			if v, ok := value.(string); ok {
-				config.IaModelResponseLanguage = v
-			}
+		field, err := LookupField(key)
+		if err != nil {
+			return err
 		}
-
-		// Salva le modifiche
-		return SaveConfig(config)
+		normalized, err := field.Normalize(value)
+		if err != nil {
+			return err
+		}
+		setPath(values, key, normalized)
 	}
-	return nil
+
+	// Salva le modifiche una sola volta, dopo averle validate tutte
+	return SaveLayer(LayerProject, values)
 }
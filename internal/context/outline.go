@@ -0,0 +1,253 @@
+package context
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"isy-cli/internal/config"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ModeFull    = config.ModeFull
+	ModeOutline = config.ModeOutline
+)
+
+// GoOutline restituisce lo scheletro di un file Go: package, import, tipi,
+// costanti, variabili e firme delle funzioni con i relativi doc comment.
+// I corpi delle funzioni vengono omessi e sostituiti dall'intervallo di righe.
+func GoOutline(path string, src []byte) (string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+	if err != nil {
+		return "", fmt.Errorf("errore durante il parsing di %s: %v", path, err)
+	}
+
+	var builder strings.Builder
+
+	writeDoc(&builder, file.Doc)
+	builder.WriteString(fmt.Sprintf("package %s\n", file.Name.Name))
+
+	for _, decl := range file.Decls {
+		builder.WriteString("\n")
+
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			writeDoc(&builder, d.Doc)
+			decl := *d
+			decl.Doc = nil // Già scritto da writeDoc
+			if err := printNode(&builder, fset, file, &decl, d.Pos(), d.End()); err != nil {
+				return "", err
+			}
+			start := fset.Position(d.Pos()).Line
+			end := fset.Position(d.End()).Line
+			if end > start {
+				builder.WriteString(fmt.Sprintf(" // lines %d-%d", start, end))
+			}
+			builder.WriteString("\n")
+
+		case *ast.FuncDecl:
+			writeDoc(&builder, d.Doc)
+			signature := *d
+			signature.Body = nil
+			signature.Doc = nil // Già scritto da writeDoc
+			if err := printNode(&builder, fset, file, &signature, d.Pos(), d.Type.End()); err != nil {
+				return "", err
+			}
+			start := fset.Position(d.Pos()).Line
+			end := fset.Position(d.End()).Line
+			if d.Body != nil {
+				builder.WriteString(" { … }")
+			}
+			builder.WriteString(fmt.Sprintf(" // lines %d-%d\n", start, end))
+		}
+	}
+
+	return builder.String(), nil
+}
+
+func writeDoc(builder *strings.Builder, doc *ast.CommentGroup) {
+	if doc == nil {
+		return
+	}
+	for _, comment := range doc.List {
+		builder.WriteString(comment.Text)
+		builder.WriteString("\n")
+	}
+}
+
+// printNode stampa un nodo includendo solo i commenti che cadono al suo interno
+func printNode(builder *strings.Builder, fset *token.FileSet, file *ast.File, node ast.Node, from, to token.Pos) error {
+	var comments []*ast.CommentGroup
+	for _, group := range file.Comments {
+		if group.Pos() >= from && group.End() <= to {
+			comments = append(comments, group)
+		}
+	}
+
+	var buf bytes.Buffer
+	err := printer.Fprint(&buf, fset, &printer.CommentedNode{Node: node, Comments: comments})
+	if err != nil {
+		return fmt.Errorf("errore durante la stampa dell'outline: %v", err)
+	}
+	builder.Write(buf.Bytes())
+	return nil
+}
+
+// goDeclaration è una dichiarazione di primo livello con il suo intervallo di righe
+type goDeclaration struct {
+	Name      string
+	StartLine int
+	EndLine   int
+}
+
+// goDeclarations elenca funzioni, metodi e tipi dichiarati in un file Go.
+// L'intervallo di righe include il doc comment.
+func goDeclarations(path string, src []byte) ([]goDeclaration, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var decls []goDeclaration
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			start := d.Pos()
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			}
+			decls = append(decls, goDeclaration{
+				Name:      d.Name.Name,
+				StartLine: fset.Position(start).Line,
+				EndLine:   fset.Position(d.End()).Line,
+			})
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				start := d.Pos()
+				if d.Doc != nil {
+					start = d.Doc.Pos()
+				}
+				if len(d.Specs) > 1 {
+					start = typeSpec.Pos()
+				}
+				decls = append(decls, goDeclaration{
+					Name:      typeSpec.Name.Name,
+					StartLine: fset.Position(start).Line,
+					EndLine:   fset.Position(typeSpec.End()).Line,
+				})
+			}
+		}
+	}
+	return decls, nil
+}
+
+// BuildExpandedContext restituisce il codice completo delle parti rilevanti per la
+// richiesta, da usare insieme al contesto in modalità outline. Un file viene espanso
+// per intero se la richiesta ne cita il percorso o il nome; altrimenti vengono espansi
+// solo i tipi e le funzioni citati per nome.
+func BuildExpandedContext(query string, opts Options) (string, error) {
+	filesFromContext, err := GetContextFiles(opts)
+	if err != nil {
+		return "", fmt.Errorf("errore durante il recupero dei file del contesto: %v", err)
+	}
+
+	words := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(query, func(r rune) bool {
+		return !(r == '_' || r == '.' || r == '/' || r == '-' ||
+			('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9'))
+	}) {
+		words[strings.Trim(word, ".")] = true
+	}
+
+	var builder strings.Builder
+	for _, path := range filesFromContext {
+		if filepath.Ext(path) != ".go" {
+			continue // I file non Go sono già inclusi per intero
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("errore durante la lettura del file %s: %v", path, err)
+		}
+		lines := strings.Split(string(content), "\n")
+
+		if words[path] || words[filepath.Base(path)] {
+			writeFileLines(&builder, path, lines, 1, len(lines))
+			continue
+		}
+
+		decls, err := goDeclarations(path, content)
+		if err != nil {
+			continue // Un file che non compila resta solo nell'outline
+		}
+		for _, decl := range decls {
+			if len(decl.Name) < 3 || !words[decl.Name] {
+				continue
+			}
+			writeFileLines(&builder, path, lines, decl.StartLine, decl.EndLine)
+		}
+	}
+
+	if builder.Len() == 0 {
+		return "", nil
+	}
+	return "----- START EXPANDED CODE -----\n\n" + builder.String() + "----- END EXPANDED CODE -----\n\n", nil
+}
+
+// RenderFileRange legge un file e ne rende un intervallo di righe (1-based,
+// estremi inclusi; end <= 0 indica la fine del file) nel formato del contesto
+func RenderFileRange(path string, start, end int) (string, error) {
+	binary, err := IsBinaryFile(path)
+	if err != nil {
+		return "", fmt.Errorf("errore durante la lettura del file %s: %v", path, err)
+	}
+	if binary {
+		return "", fmt.Errorf("%s è un file binario", path)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("errore durante la lettura del file %s: %v", path, err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+
+	start = max(start, 1)
+	if end <= 0 || end > len(lines) {
+		end = len(lines)
+	}
+	if start > end {
+		return "", fmt.Errorf("intervallo %d-%d non valido: %s ha %d righe", start, end, path, len(lines))
+	}
+
+	var builder strings.Builder
+	writeFileLines(&builder, path, lines, start, end)
+	return builder.String(), nil
+}
+
+// writeFileLines scrive un intervallo di righe (1-based, estremi inclusi) nel formato del contesto
+func writeFileLines(builder *strings.Builder, path string, lines []string, start, end int) {
+	end = min(end, len(lines))
+
+	builder.WriteString("----- START FILE -----\n")
+	if start == 1 && end == len(lines) {
+		builder.WriteString(fmt.Sprintf("FILE: %s\n", path))
+	} else {
+		builder.WriteString(fmt.Sprintf("FILE: %s (lines %d-%d)\n", path, start, end))
+	}
+	builder.WriteString("----- CONTENT -----\n")
+	for i := start - 1; i < end; i++ {
+		builder.WriteString(fmt.Sprintf("%d: %s\n", i+1, lines[i]))
+	}
+	builder.WriteString("----- END FILE -----\n\n")
+}
@@ -0,0 +1,565 @@
+package context
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"isy-cli/internal/project"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rule è una riga di .isycontext (o di .gitignore). Le regole seguono la semantica
+// di gitignore: vince l'ultima che corrisponde, "!" esclude, "/" finale indica
+// una directory e una directory esclusa non viene visitata.
+type Rule struct {
+	Pattern string
+	Negate  bool
+	DirOnly bool
+	MaxSize int64 // Dimensione massima in byte dei file inclusi dalla regola (0 = nessun limite)
+	Source  string
+	Line    int
+	Text    string
+
+	regex   *regexp.Regexp
+	anyPath bool // Pattern senza "/": corrisponde a qualunque profondità
+}
+
+// RuleSet è l'insieme di regole che decide quali file entrano nel contesto
+type RuleSet struct {
+	Rules            []Rule
+	DefaultMaxSize   int64
+	RespectGitignore bool
+	IncludeBinary    bool
+	Settings         map[string]string // Direttive di resa (@budget, @mode, @line-numbers, @description)
+
+	gitignore []Rule
+}
+
+// Direttive che non riguardano la selezione dei file ma la resa del contesto
+var settingDirectives = map[string]bool{
+	"@budget":       true,
+	"@mode":         true,
+	"@line-numbers": true,
+	"@description":  true,
+}
+
+// Decision spiega perché un file è incluso o escluso
+type Decision struct {
+	Included bool
+	Reason   string
+	Rule     *Rule
+}
+
+// LoadRuleSet legge un file di regole, seguendo le direttive @include
+func LoadRuleSet(filePath string) (*RuleSet, error) {
+	ruleSet := &RuleSet{Settings: make(map[string]string)}
+	if err := ruleSet.load(filePath, map[string]bool{}); err != nil {
+		return nil, err
+	}
+	if ruleSet.RespectGitignore {
+		if err := ruleSet.loadGitignore(".gitignore"); err != nil {
+			return nil, err
+		}
+	}
+	return ruleSet, nil
+}
+
+// NewRuleSet costruisce un insieme di regole da una lista di righe
+func NewRuleSet(lines []string, source string) (*RuleSet, error) {
+	ruleSet := &RuleSet{Settings: make(map[string]string)}
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if strings.HasPrefix(line, "@") {
+			if err := ruleSet.applyDirective(source, i+1, line, map[string]bool{}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		rule, err := parseRule(line, source, i+1)
+		if err != nil {
+			return nil, err
+		}
+		ruleSet.Rules = append(ruleSet.Rules, rule)
+	}
+	if ruleSet.RespectGitignore {
+		if err := ruleSet.loadGitignore(".gitignore"); err != nil {
+			return nil, err
+		}
+	}
+	return ruleSet, nil
+}
+
+// EnableGitignore aggiunge le regole di .gitignore se non sono già attive
+func (rs *RuleSet) EnableGitignore() error {
+	if rs.RespectGitignore {
+		return nil
+	}
+	rs.RespectGitignore = true
+	return rs.loadGitignore(".gitignore")
+}
+
+// load interpreta un file di regole. Oltre ai pattern supporta le direttive:
+//
+//	@include <file>       include le regole di un altro file (relativo al file corrente)
+//	@gitignore            esclude anche i file ignorati da .gitignore
+//	@binary               non esclude automaticamente i file binari
+//	@max-size <size>      limite di dimensione predefinito, es. 256KB
+//	@budget <token>       limite di token per i file del contesto
+//	@mode full|outline    modalità di resa dei file Go
+//	@line-numbers on|off  numeri di riga nei file
+//	@description <testo>  descrizione del profilo
+//
+// e l'opzione per pattern max-size=<size>, es. "docs/** max-size=64KB".
+func (rs *RuleSet) load(filePath string, visiting map[string]bool) error {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return err
+	}
+	if visiting[absPath] {
+		return fmt.Errorf("@include ciclico: %s", filePath)
+	}
+	visiting[absPath] = true
+	defer delete(visiting, absPath)
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("errore durante l'apertura del file: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		// Ignore comments and empty lines
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		if strings.HasPrefix(line, "@") {
+			if err := rs.applyDirective(filePath, lineNumber, line, visiting); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rule, err := parseRule(line, filePath, lineNumber)
+		if err != nil {
+			return err
+		}
+		rs.Rules = append(rs.Rules, rule)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("errore durante la lettura del file: %v", err)
+	}
+	return nil
+}
+
+func (rs *RuleSet) applyDirective(filePath string, lineNumber int, line string, visiting map[string]bool) error {
+	fields := strings.Fields(line)
+	where := fmt.Sprintf("%s:%d", filePath, lineNumber)
+
+	switch fields[0] {
+	case "@include":
+		if len(fields) != 2 {
+			return fmt.Errorf("%s: @include richiede un file", where)
+		}
+		included := fields[1]
+		if !filepath.IsAbs(included) {
+			included = filepath.Join(filepath.Dir(filePath), included)
+		}
+		if err := rs.load(included, visiting); err != nil {
+			return fmt.Errorf("%s: %v", where, err)
+		}
+	case "@gitignore":
+		rs.RespectGitignore = true
+	case "@binary":
+		rs.IncludeBinary = true
+	case "@max-size":
+		if len(fields) != 2 {
+			return fmt.Errorf("%s: @max-size richiede una dimensione", where)
+		}
+		size, err := ParseSize(fields[1])
+		if err != nil {
+			return fmt.Errorf("%s: %v", where, err)
+		}
+		rs.DefaultMaxSize = size
+	default:
+		if !settingDirectives[fields[0]] {
+			return fmt.Errorf("%s: direttiva sconosciuta %s", where, fields[0])
+		}
+		value := strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+		if value == "" {
+			return fmt.Errorf("%s: %s richiede un valore", where, fields[0])
+		}
+		rs.Settings[fields[0]] = value
+	}
+	return nil
+}
+
+func (rs *RuleSet) loadGitignore(filePath string) error {
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("errore durante l'apertura di %s: %v", filePath, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		rule, err := compileRule(Rule{Source: filePath, Line: lineNumber, Text: line}, line)
+		if err != nil {
+			continue // Un pattern non valido in .gitignore non deve bloccare isy
+		}
+		rs.gitignore = append(rs.gitignore, rule)
+	}
+	return scanner.Err()
+}
+
+func parseRule(line, source string, lineNumber int) (Rule, error) {
+	rule := Rule{Source: source, Line: lineNumber, Text: line}
+	where := fmt.Sprintf("%s:%d", source, lineNumber)
+
+	fields := strings.Fields(line)
+	pattern := fields[0]
+	for _, option := range fields[1:] {
+		key, value, found := strings.Cut(option, "=")
+		if !found || key != "max-size" {
+			return rule, fmt.Errorf("%s: opzione sconosciuta %q", where, option)
+		}
+		size, err := ParseSize(value)
+		if err != nil {
+			return rule, fmt.Errorf("%s: %v", where, err)
+		}
+		rule.MaxSize = size
+	}
+
+	compiled, err := compileRule(rule, pattern)
+	if err != nil {
+		return rule, fmt.Errorf("%s: %v", where, err)
+	}
+	return compiled, nil
+}
+
+// compileRule traduce un pattern in stile gitignore in un'espressione regolare
+func compileRule(rule Rule, pattern string) (Rule, error) {
+	if strings.HasPrefix(pattern, "!") {
+		rule.Negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.DirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+
+	anchored := strings.HasPrefix(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "./")
+	if pattern == "" {
+		return rule, fmt.Errorf("pattern vuoto")
+	}
+	rule.Pattern = pattern
+	rule.anyPath = !anchored && !strings.Contains(pattern, "/")
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "/**") && i+3 == len(pattern):
+			expr.WriteString("(?:/.*)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				return rule, fmt.Errorf("classe di caratteri non chiusa in %q", pattern)
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			expr.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+
+	regex, err := regexp.Compile(expr.String())
+	if err != nil {
+		return rule, fmt.Errorf("pattern non valido %q: %v", pattern, err)
+	}
+	rule.regex = regex
+	return rule, nil
+}
+
+// matchesItself verifica se la regola corrisponde esattamente al percorso
+func (r *Rule) matchesItself(relPath string, isDir bool) bool {
+	if r.DirOnly && !isDir {
+		return false
+	}
+	if r.anyPath {
+		return r.regex.MatchString(path.Base(relPath))
+	}
+	return r.regex.MatchString(relPath)
+}
+
+// Matches verifica se la regola corrisponde al percorso o a una delle sue directory
+func (r *Rule) Matches(relPath string, isDir bool) bool {
+	relPath = filepath.ToSlash(relPath)
+	if r.matchesItself(relPath, isDir) {
+		return true
+	}
+	for dir := path.Dir(relPath); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if r.matchesItself(dir, true) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) String() string {
+	return fmt.Sprintf("%s:%d %q", r.Source, r.Line, r.Text)
+}
+
+// lastMatch restituisce l'ultima regola che corrisponde al percorso
+func lastMatch(rules []Rule, relPath string, isDir bool) *Rule {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].Matches(relPath, isDir) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// Match restituisce l'ultima regola che corrisponde al percorso, nil se nessuna.
+// Come in .isycontext il percorso è selezionato se la regola non è una negazione.
+func (rs *RuleSet) Match(relPath string, isDir bool) *Rule {
+	return lastMatch(rs.Rules, relPath, isDir)
+}
+
+// PruneDir indica se una directory può essere saltata durante la scansione
+func (rs *RuleSet) PruneDir(relPath string) (bool, string) {
+	name := filepath.Base(relPath)
+	if project.SkippedDir(name) {
+		return true, fmt.Sprintf("la directory %s non viene mai inclusa", name)
+	}
+	if rule := lastMatch(rs.gitignore, relPath, true); rule != nil && !rule.Negate {
+		return true, fmt.Sprintf("directory %s ignorata da %s", relPath, rule)
+	}
+	if rule := lastMatch(rs.Rules, relPath, true); rule != nil && rule.Negate {
+		return true, fmt.Sprintf("directory %s esclusa da %s", relPath, rule)
+	}
+	return false, ""
+}
+
+// Decide stabilisce se un file entra nel contesto e perché
+func (rs *RuleSet) Decide(relPath string, info os.FileInfo) Decision {
+	relPath = filepath.Clean(relPath)
+
+	// Una directory antenata esclusa esclude tutto ciò che contiene
+	for dir := filepath.Dir(relPath); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		if pruned, reason := rs.PruneDir(dir); pruned {
+			return Decision{Reason: reason}
+		}
+	}
+
+	if info.IsDir() {
+		if pruned, reason := rs.PruneDir(relPath); pruned {
+			return Decision{Reason: reason}
+		}
+		return Decision{Reason: "è una directory: vengono inclusi solo i file"}
+	}
+
+	if rule := lastMatch(rs.gitignore, relPath, false); rule != nil && !rule.Negate {
+		return Decision{Reason: fmt.Sprintf("ignorato da %s", rule), Rule: rule}
+	}
+
+	rule := lastMatch(rs.Rules, relPath, false)
+	if rule == nil {
+		return Decision{Reason: "nessuna regola corrisponde"}
+	}
+	if rule.Negate {
+		return Decision{Reason: fmt.Sprintf("escluso da %s", rule), Rule: rule}
+	}
+
+	maxSize := rule.MaxSize
+	if maxSize == 0 {
+		maxSize = rs.DefaultMaxSize
+	}
+	if maxSize > 0 && info.Size() > maxSize {
+		return Decision{
+			Reason: fmt.Sprintf("%s supera il limite di %s (%s)", FormatSize(info.Size()), FormatSize(maxSize), rule),
+			Rule:   rule,
+		}
+	}
+
+	if !rs.IncludeBinary {
+		binary, err := IsBinaryFile(relPath)
+		if err != nil {
+			return Decision{Reason: fmt.Sprintf("impossibile leggere il file: %v", err), Rule: rule}
+		}
+		if binary {
+			return Decision{Reason: fmt.Sprintf("file binario (corrisponde a %s)", rule), Rule: rule}
+		}
+	}
+
+	return Decision{Included: true, Reason: fmt.Sprintf("incluso da %s", rule), Rule: rule}
+}
+
+// Excluded indica se un percorso è escluso esplicitamente: sta in una directory
+// mai inclusa o esclusa, è ignorato da .gitignore oppure corrisponde a una regola
+// con "!". A differenza di Decide, un file che nessuna regola include non è escluso:
+// serve agli strumenti del modello, che possono leggere anche fuori dal contesto.
+func (rs *RuleSet) Excluded(relPath string, isDir bool) (bool, string) {
+	relPath = filepath.Clean(relPath)
+
+	dir := relPath
+	if !isDir {
+		dir = filepath.Dir(relPath)
+	}
+	for ; dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		if pruned, reason := rs.PruneDir(dir); pruned {
+			return true, reason
+		}
+	}
+	if isDir {
+		return false, ""
+	}
+
+	if rule := lastMatch(rs.gitignore, relPath, false); rule != nil && !rule.Negate {
+		return true, fmt.Sprintf("ignorato da %s", rule)
+	}
+	if rule := lastMatch(rs.Rules, relPath, false); rule != nil && rule.Negate {
+		return true, fmt.Sprintf("escluso da %s", rule)
+	}
+	return false, ""
+}
+
+// Walk restituisce i file inclusi sotto baseDir, saltando le directory escluse
+func (rs *RuleSet) Walk(baseDir string) ([]string, error) {
+	var matchedFiles []string
+
+	err := filepath.Walk(baseDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(baseDir, filePath)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+
+		if info.IsDir() {
+			if pruned, _ := rs.PruneDir(relPath); pruned {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if rs.Decide(relPath, info).Included {
+			matchedFiles = append(matchedFiles, filePath)
+		}
+		return nil
+	})
+
+	return matchedFiles, err
+}
+
+// IsBinaryFile considera binario un file con byte nulli o UTF-8 non valido nei primi 8KB
+func IsBinaryFile(filePath string) (bool, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, 8000)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	buf = buf[:n]
+
+	if bytes.IndexByte(buf, 0) >= 0 {
+		return true, nil
+	}
+	// Un carattere multibyte può essere tagliato alla fine del buffer
+	for i := 0; i < utf8.UTFMax && len(buf) > 0 && !utf8.Valid(buf); i++ {
+		buf = buf[:len(buf)-1]
+	}
+	return !utf8.Valid(buf), nil
+}
+
+// ParseSize interpreta dimensioni come 512, 64KB, 1.5MB
+func ParseSize(value string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper = strings.TrimSuffix(upper, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(strings.TrimSpace(upper), 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("dimensione non valida: %s", value)
+	}
+	return int64(number * float64(multiplier)), nil
+}
+
+// FormatSize rende una dimensione in byte leggibile
+func FormatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%dB", size)
+	}
+}
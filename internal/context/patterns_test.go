@@ -0,0 +1,367 @@
+package context
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// chdir sposta il processo in dir per la durata del test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+}
+
+// writeFiles crea i file indicati sotto dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRuleMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    []string
+		path     string
+		isDir    bool
+		included bool
+	}{
+		{"estensione a qualunque profondità", []string{"*.go"}, "cmd/isy/main.go", false, true},
+		{"negazione dopo l'inclusione", []string{"*.go", "!*_test.go"}, "main_test.go", false, false},
+		{"inclusione dopo la negazione", []string{"!*_test.go", "*.go"}, "main_test.go", false, true},
+		{"negazione che non riguarda il file", []string{"*.go", "!*_test.go"}, "main.go", false, true},
+		{"nessuna regola", []string{"*.go"}, "README.md", false, false},
+
+		{"/ iniziale: file nella radice", []string{"/main.go"}, "main.go", false, true},
+		{"/ iniziale: file in una sottodirectory", []string{"/main.go"}, "cmd/main.go", false, false},
+		{"senza / iniziale: file in una sottodirectory", []string{"main.go"}, "cmd/main.go", false, true},
+		{"/ interna ancora il pattern", []string{"cmd/*.go"}, "cmd/a.go", false, true},
+		{"/ interna: altra radice", []string{"cmd/*.go"}, "x/cmd/a.go", false, false},
+		{"* non attraversa le directory", []string{"cmd/*.go"}, "cmd/sub/a.go", false, false},
+		{"./ iniziale", []string{"./main.go"}, "main.go", false, true},
+
+		{"**/ iniziale: radice", []string{"**/foo.go"}, "foo.go", false, true},
+		{"**/ iniziale: in profondità", []string{"**/foo.go"}, "a/b/foo.go", false, true},
+		{"/** finale", []string{"docs/**"}, "docs/x/y.md", false, true},
+		{"/** finale: altra directory", []string{"docs/**"}, "src/docs.md", false, false},
+		{"/**/ interno: nessuna directory", []string{"a/**/b.go"}, "a/b.go", false, true},
+		{"/**/ interno: più directory", []string{"a/**/b.go"}, "a/x/y/b.go", false, true},
+		{"/**/ interno: altra radice", []string{"a/**/b.go"}, "c/a/b.go", false, false},
+		{"** da solo", []string{"**"}, "a/b/c.txt", false, true},
+
+		{"solo directory: file nella directory", []string{"build/"}, "build/out.txt", false, true},
+		{"solo directory: la directory", []string{"build/"}, "build", true, true},
+		{"solo directory: file con lo stesso nome", []string{"build/"}, "build", false, false},
+		{"solo directory esclusa", []string{"**", "!build/"}, "build/out.txt", false, false},
+
+		{`\! iniziale`, []string{`\!important.md`}, "!important.md", false, true},
+		{`\! iniziale non nega`, []string{"*.md", `\!important.md`}, "readme.md", false, true},
+		{`\# iniziale`, []string{`\#notes.md`}, "#notes.md", false, true},
+		{"? un solo carattere", []string{"file?.go"}, "file1.go", false, true},
+		{"? non due caratteri", []string{"file?.go"}, "file10.go", false, false},
+		{"classe negata", []string{"[!a]*.go"}, "a.go", false, false},
+		{"classe negata: altro file", []string{"[!a]*.go"}, "b.go", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ruleSet, err := NewRuleSet(tt.rules, "test")
+			if err != nil {
+				t.Fatalf("NewRuleSet: %v", err)
+			}
+			rule := ruleSet.Match(tt.path, tt.isDir)
+			if included := rule != nil && !rule.Negate; included != tt.included {
+				t.Fatalf("Match(%q) con %q: incluso=%v, atteso %v", tt.path, tt.rules, included, tt.included)
+			}
+		})
+	}
+}
+
+func TestRuleErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []string
+		message string
+	}{
+		{"classe non chiusa", []string{"[abc.go"}, "classe di caratteri non chiusa"},
+		{"pattern vuoto", []string{"!"}, "pattern vuoto"},
+		{"opzione sconosciuta", []string{"*.go size=1KB"}, "opzione sconosciuta"},
+		{"max-size non valido", []string{"*.go max-size=tanto"}, "dimensione non valida"},
+		{"direttiva sconosciuta", []string{"@exclude vendor"}, "direttiva sconosciuta"},
+		{"@max-size senza valore", []string{"@max-size"}, "richiede una dimensione"},
+		{"@budget senza valore", []string{"@budget"}, "richiede un valore"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRuleSet(tt.rules, "test")
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Fatalf("NewRuleSet(%q) = %v, atteso un errore con %q", tt.rules, err, tt.message)
+			}
+		})
+	}
+}
+
+func TestDecide(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.go":          "package main\n",
+		"big.go":           strings.Repeat("// riga di commento\n", 100),
+		"data.bin":         "dati\x00binari",
+		"docs/guide.md":    strings.Repeat("testo della guida\n", 150),
+		"docs/huge.md":     strings.Repeat("testo della guida\n", 300),
+		"vendor/lib/x.go":  "package lib\n",
+		"vendor/keep.go":   "package vendor\n",
+		"app.log":          "log\n",
+		"keep.log":         "log da tenere\n",
+		"out/gen.go":       "package out\n",
+		".isy/config.json": "{}\n",
+		".git/HEAD":        "ref: refs/heads/main\n",
+		".gitignore":       "*.log\n!keep.log\nout/\n",
+	})
+	chdir(t, dir)
+
+	ruleSet, err := NewRuleSet([]string{
+		"@gitignore",
+		"@max-size 1KB",
+		"**",
+		"!vendor/",
+		"vendor/keep.go",
+		"docs/** max-size=4KB",
+		"!.gitignore",
+	}, "test")
+	if err != nil {
+		t.Fatalf("NewRuleSet: %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		included bool
+		reason   string // Parte attesa della spiegazione
+	}{
+		{"main.go", true, "incluso da"},
+		{"big.go", false, "supera il limite di 1.0KB"},
+		{"docs/guide.md", true, "incluso da"},
+		{"docs/huge.md", false, "supera il limite di 4.0KB"},
+		{"data.bin", false, "file binario"},
+		{"vendor/lib/x.go", false, "esclusa da test:4"},
+		{"vendor/keep.go", false, "directory vendor esclusa da test:4"},
+		{"app.log", false, "ignorato da .gitignore"},
+		{"keep.log", true, "incluso da"},
+		{"out/gen.go", false, "directory out ignorata"},
+		{".isy/config.json", false, "non viene mai inclusa"},
+		{".git/HEAD", false, "non viene mai inclusa"},
+		{".gitignore", false, "escluso da"},
+	}
+
+	var want []string
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			info, err := os.Stat(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decision := ruleSet.Decide(tt.path, info)
+			if decision.Included != tt.included || !strings.Contains(decision.Reason, tt.reason) {
+				t.Fatalf("Decide(%q) = %v (%s), atteso %v con %q", tt.path, decision.Included, decision.Reason, tt.included, tt.reason)
+			}
+		})
+		if tt.included {
+			want = append(want, tt.path)
+		}
+	}
+
+	// Walk include gli stessi file di Decide
+	files, err := ruleSet.Walk(".")
+	if err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	for i := range files {
+		files[i] = filepath.ToSlash(files[i])
+	}
+	sort.Strings(files)
+	sort.Strings(want)
+	if strings.Join(files, ",") != strings.Join(want, ",") {
+		t.Fatalf("Walk = %v, atteso %v", files, want)
+	}
+}
+
+func TestPruneDir(t *testing.T) {
+	ruleSet, err := NewRuleSet([]string{"**", "!vendor/", "!**/testdata/", "!docs/**", "docs/api/"}, "test")
+	if err != nil {
+		t.Fatalf("NewRuleSet: %v", err)
+	}
+
+	tests := []struct {
+		dir    string
+		pruned bool
+	}{
+		{"cmd", false},
+		{"vendor", true},
+		{"internal/vendor", true},
+		{"internal/x/testdata", true},
+		{"docs", true},
+		{"docs/api", false},
+		{".git", true},
+		{"internal/.isy", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			if pruned, reason := ruleSet.PruneDir(tt.dir); pruned != tt.pruned {
+				t.Fatalf("PruneDir(%q) = %v (%s), atteso %v", tt.dir, pruned, reason, tt.pruned)
+			}
+		})
+	}
+}
+
+func TestLoadRuleSetInclude(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		rules   int
+		message string // Parte attesa dell'errore, "" se il caricamento riesce
+	}{
+		{
+			name: "include relativo al file",
+			files: map[string]string{
+				"main.rules":          "*.go\n@include shared/common.rules\n",
+				"shared/common.rules": "*.md\n@include more.rules\n",
+				"shared/more.rules":   "*.txt\n",
+			},
+			rules: 3,
+		},
+		{
+			name: "stesso file incluso due volte senza ciclo",
+			files: map[string]string{
+				"main.rules":   "@include a.rules\n@include b.rules\n",
+				"a.rules":      "@include common.rules\n",
+				"b.rules":      "@include common.rules\n",
+				"common.rules": "*.go\n",
+			},
+			rules: 2,
+		},
+		{
+			name: "include di se stesso",
+			files: map[string]string{
+				"main.rules": "*.go\n@include main.rules\n",
+			},
+			message: "@include ciclico",
+		},
+		{
+			name: "ciclo tra due file",
+			files: map[string]string{
+				"main.rules": "@include a.rules\n",
+				"a.rules":    "@include b.rules\n",
+				"b.rules":    "@include a.rules\n",
+			},
+			message: "@include ciclico",
+		},
+		{
+			name: "file incluso mancante",
+			files: map[string]string{
+				"main.rules": "@include missing.rules\n",
+			},
+			message: "main.rules:1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+
+			ruleSet, err := LoadRuleSet(filepath.Join(dir, "main.rules"))
+			if tt.message != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.message) {
+					t.Fatalf("LoadRuleSet = %v, atteso un errore con %q", err, tt.message)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadRuleSet: %v", err)
+			}
+			if len(ruleSet.Rules) != tt.rules {
+				t.Fatalf("LoadRuleSet: %d regole, attese %d", len(ruleSet.Rules), tt.rules)
+			}
+		})
+	}
+}
+
+func TestIsBinaryFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		binary  bool
+	}{
+		{"testo", "package main\n", false},
+		{"file vuoto", "", false},
+		{"UTF-8 multibyte", "città è già più\n", false},
+		{"byte nullo", "abc\x00def", true},
+		{"UTF-8 non valido", "abc\xff\xfedef", true},
+		{"carattere tagliato a fine buffer", strings.Repeat("a", 7999) + "è", false},
+		{"byte nullo dopo gli 8KB", strings.Repeat("a", 9000) + "\x00", false},
+	}
+
+	dir := t.TempDir()
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.Repeat("f", i+1))
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			binary, err := IsBinaryFile(path)
+			if err != nil {
+				t.Fatalf("IsBinaryFile: %v", err)
+			}
+			if binary != tt.binary {
+				t.Fatalf("IsBinaryFile = %v, atteso %v", binary, tt.binary)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value string
+		size  int64
+		valid bool
+	}{
+		{"512", 512, true},
+		{"512B", 512, true},
+		{"64KB", 64 << 10, true},
+		{"64kb", 64 << 10, true},
+		{"2k", 2 << 10, true},
+		{"1.5MB", 3 << 19, true},
+		{"1G", 1 << 30, true},
+		{"-1KB", 0, false},
+		{"tanto", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			size, err := ParseSize(tt.value)
+			if (err == nil) != tt.valid || size != tt.size {
+				t.Fatalf("ParseSize(%q) = %d, %v; atteso %d (valido=%v)", tt.value, size, err, tt.size, tt.valid)
+			}
+		})
+	}
+}
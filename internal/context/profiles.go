@@ -0,0 +1,220 @@
+package context
+
+import (
+	"fmt"
+	"isy-cli/internal/config"
+	"isy-cli/internal/project"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// I percorsi sono relativi alla radice del progetto, dove project.Setup sposta il processo
+const profilesDir = project.ContextFile + ".d"
+
+// profileNamePattern limita i nomi dei profili, che diventano nomi di file in
+// profilesDir: come per i comandi, niente separatori né percorsi relativi
+var profileNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Profile è un insieme nominato di regole e opzioni di resa del contesto.
+// Il profilo senza nome corrisponde a .isycontext.
+type Profile struct {
+	Name        string
+	Description string
+	Source      string
+	Rules       *RuleSet
+	Budget      int
+	Mode        string
+	LineNumbers *bool
+}
+
+// Settings è il risultato della combinazione di configurazione, profilo e opzioni
+type Settings struct {
+	Config      *config.Config
+	Profile     *Profile
+	Mode        string
+	Budget      int
+	LineNumbers bool
+}
+
+// ResolveSettings carica il profilo richiesto e calcola le opzioni effettive.
+// Precedenza: opzioni del comando, poi profilo, poi sezione context della configurazione.
+func ResolveSettings(opts Options) (*Settings, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("errore durante il caricamento della configurazione: %v", err)
+	}
+
+	name := opts.Profile
+	if name == "" {
+		name = cfg.Context.Profile
+	}
+
+	profile, err := LoadProfile(cfg, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Context.RespectGitignore {
+		if err := profile.Rules.EnableGitignore(); err != nil {
+			return nil, err
+		}
+	}
+
+	settings := &Settings{
+		Config:      cfg,
+		Profile:     profile,
+		Mode:        ModeFull,
+		Budget:      cfg.Context.Budget,
+		LineNumbers: true,
+	}
+
+	switch {
+	case opts.Mode != "":
+		settings.Mode = opts.Mode
+	case profile.Mode != "":
+		settings.Mode = profile.Mode
+	case cfg.Context.Mode != "":
+		settings.Mode = cfg.Context.Mode
+	}
+	if settings.Mode != ModeFull && settings.Mode != ModeOutline {
+		return nil, fmt.Errorf("modalità di contesto sconosciuta: %s", settings.Mode)
+	}
+
+	if profile.Budget > 0 {
+		settings.Budget = profile.Budget
+	}
+	if profile.LineNumbers != nil {
+		settings.LineNumbers = *profile.LineNumbers
+	}
+
+	return settings, nil
+}
+
+// LoadProfile carica un profilo da .isycontext.d/<name>.profile o dalla configurazione.
+// Con nome vuoto restituisce il profilo predefinito basato su .isycontext.
+func LoadProfile(cfg *config.Config, name string) (*Profile, error) {
+	if name == "" {
+		rules, err := LoadRuleSet(project.ContextFile)
+		if err != nil {
+			return nil, err
+		}
+		return profileFromRuleSet("", project.ContextFile, rules)
+	}
+
+	if !profileNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("nome di profilo non valido %q: usa solo lettere minuscole, cifre, - e _", name)
+	}
+
+	profileFile := filepath.Join(profilesDir, name+".profile")
+	_, fileErr := os.Stat(profileFile)
+	profileConfig, inConfig := cfg.Profiles[name]
+
+	switch {
+	case fileErr == nil && inConfig:
+		return nil, fmt.Errorf("il profilo %s è definito sia in %s sia nella configurazione", name, profileFile)
+	case fileErr == nil:
+		rules, err := LoadRuleSet(profileFile)
+		if err != nil {
+			return nil, err
+		}
+		return profileFromRuleSet(name, profileFile, rules)
+	case inConfig:
+		return profileFromConfig(name, profileConfig)
+	default:
+		return nil, fmt.Errorf("profilo sconosciuto: %s", name)
+	}
+}
+
+// ListProfiles restituisce tutti i profili disponibili, ordinati per nome
+func ListProfiles(cfg *config.Config) ([]*Profile, error) {
+	names := make(map[string]bool)
+
+	entries, err := os.ReadDir(profilesDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("errore durante la lettura di %s: %v", profilesDir, err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".profile") {
+			names[strings.TrimSuffix(entry.Name(), ".profile")] = true
+		}
+	}
+	for name := range cfg.Profiles {
+		names[name] = true
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var profiles []*Profile
+	for _, name := range sorted {
+		profile, err := LoadProfile(cfg, name)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, nil
+}
+
+func profileFromRuleSet(name, source string, rules *RuleSet) (*Profile, error) {
+	profile := &Profile{
+		Name:        name,
+		Source:      source,
+		Rules:       rules,
+		Description: rules.Settings["@description"],
+		Mode:        rules.Settings["@mode"],
+	}
+
+	if value, ok := rules.Settings["@budget"]; ok {
+		budget, err := strconv.Atoi(value)
+		if err != nil || budget < 0 {
+			return nil, fmt.Errorf("%s: @budget non valido: %s", source, value)
+		}
+		profile.Budget = budget
+	}
+
+	if value, ok := rules.Settings["@line-numbers"]; ok {
+		var lineNumbers bool
+		switch strings.ToLower(value) {
+		case "on", "true", "yes":
+			lineNumbers = true
+		case "off", "false", "no":
+			lineNumbers = false
+		default:
+			return nil, fmt.Errorf("%s: @line-numbers non valido: %s", source, value)
+		}
+		profile.LineNumbers = &lineNumbers
+	}
+
+	return profile, nil
+}
+
+func profileFromConfig(name string, profileConfig config.ProfileConfig) (*Profile, error) {
+	lines := append([]string{}, profileConfig.Include...)
+	for _, pattern := range profileConfig.Exclude {
+		lines = append(lines, "!"+strings.TrimPrefix(pattern, "!"))
+	}
+
+	source := fmt.Sprintf("config profiles.%s", name)
+	rules, err := NewRuleSet(lines, source)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Profile{
+		Name:        name,
+		Description: profileConfig.Description,
+		Source:      source,
+		Rules:       rules,
+		Budget:      profileConfig.Budget,
+		Mode:        profileConfig.Mode,
+		LineNumbers: profileConfig.LineNumbers,
+	}, nil
+}
@@ -0,0 +1,52 @@
+package context
+
+import (
+	"isy-cli/internal/config"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadProfileName(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"project/" + profilesDir + "/backend.profile": "*.go\n",
+		"outside.profile": "**\n",
+	})
+	chdir(t, filepath.Join(root, "project"))
+	cfg := &config.Config{Profiles: map[string]config.ProfileConfig{
+		"docs_v2": {Include: []string{"docs/**"}},
+	}}
+
+	tests := []struct {
+		name    string
+		message string // Parte attesa dell'errore, "" se il profilo si carica
+	}{
+		{"backend", ""},
+		{"docs_v2", ""},
+		{"frontend", "profilo sconosciuto"},
+		{"../../outside", "nome di profilo non valido"},
+		{"../backend", "nome di profilo non valido"},
+		{"sub/backend", "nome di profilo non valido"},
+		{"Backend", "nome di profilo non valido"},
+		{"-backend", "nome di profilo non valido"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, err := LoadProfile(cfg, tt.name)
+			if tt.message == "" {
+				if err != nil {
+					t.Fatalf("LoadProfile(%q): %v", tt.name, err)
+				}
+				if profile.Name != tt.name {
+					t.Fatalf("LoadProfile(%q) = profilo %q", tt.name, profile.Name)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Fatalf("LoadProfile(%q) = %v, atteso un errore con %q", tt.name, err, tt.message)
+			}
+		})
+	}
+}
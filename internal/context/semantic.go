@@ -0,0 +1,165 @@
+package context
+
+import (
+	"fmt"
+	"isy-cli/internal/embeddings"
+	"isy-cli/internal/project"
+	"os"
+	"sort"
+	"strings"
+)
+
+// UpdateEmbeddingIndex divide in chunk i file del profilo e aggiorna l'archivio
+// vettoriale, ricalcolando solo i chunk il cui contenuto è cambiato
+func UpdateEmbeddingIndex(opts Options) (embeddings.IndexStats, error) {
+	settings, err := ResolveSettings(opts)
+	if err != nil {
+		return embeddings.IndexStats{}, err
+	}
+
+	embedder, err := embeddings.New(settings.Config)
+	if err != nil {
+		return embeddings.IndexStats{}, err
+	}
+
+	return updateEmbeddingIndex(settings, embedder)
+}
+
+func updateEmbeddingIndex(settings *Settings, embedder embeddings.Embedder) (embeddings.IndexStats, error) {
+	cfg := settings.Config
+
+	filesFromContext, err := settings.Profile.Rules.Walk(".")
+	if err != nil {
+		return embeddings.IndexStats{}, fmt.Errorf("errore durante il recupero dei file del contesto: %v", err)
+	}
+
+	var chunks []embeddings.Chunk
+	for _, path := range filesFromContext {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return embeddings.IndexStats{}, fmt.Errorf("errore durante la lettura del file %s: %v", path, err)
+		}
+		chunks = append(chunks, embeddings.ChunkFile(path, string(content), cfg.Embeddings.ChunkLines)...)
+	}
+
+	store, err := embeddings.LoadStore()
+	if err != nil {
+		return embeddings.IndexStats{}, err
+	}
+
+	stats, err := store.Update(embedder, chunks)
+	if err != nil {
+		return stats, fmt.Errorf("errore durante il calcolo degli embedding: %v", err)
+	}
+
+	if err := store.Save(); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// Vantaggio di similarità dei chunk nella directory da cui è stato lanciato il comando
+const subdirBoost = 0.05
+
+// SemanticSearch aggiorna l'indice e restituisce i chunk più simili alla query
+func SemanticSearch(query string, k int, opts Options) ([]embeddings.SearchResult, error) {
+	settings, err := ResolveSettings(opts)
+	if err != nil {
+		return nil, err
+	}
+	cfg := settings.Config
+
+	embedder, err := embeddings.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := updateEmbeddingIndex(settings, embedder); err != nil {
+		return nil, err
+	}
+
+	store, err := embeddings.LoadStore()
+	if err != nil {
+		return nil, err
+	}
+
+	vectors, err := embedder.Embed([]string{query})
+	if err != nil {
+		return nil, fmt.Errorf("errore durante il calcolo dell'embedding della query: %v", err)
+	}
+
+	if k <= 0 {
+		k = cfg.Embeddings.TopK
+	}
+	if k <= 0 {
+		k = embeddings.DefaultTopK
+	}
+
+	// I chunk della directory corrente ricevono un piccolo vantaggio, a parità
+	// di rilevanza vengono preferiti
+	if project.Subdir() == "" {
+		return store.Search(vectors[0], k), nil
+	}
+	results := store.Search(vectors[0], 0)
+	for i := range results {
+		if project.InSubdir(results[i].Chunk.Path) {
+			results[i].Score += subdirBoost
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// BuildSemanticContext restituisce le porzioni di codice più rilevanti per la query,
+// con i numeri di riga originali così che le modifiche restino applicabili
+func BuildSemanticContext(query string, opts Options) (string, error) {
+	results, err := SemanticSearch(query, 0, opts)
+	if err != nil {
+		return "", err
+	}
+
+	// Raggruppa per file e ordina per riga, così il modello legge il codice in ordine
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Path != results[j].Path {
+			return results[i].Path < results[j].Path
+		}
+		return results[i].StartLine < results[j].StartLine
+	})
+
+	// Unisce i chunk sovrapposti dello stesso file per non ripetere righe
+	var merged []embeddings.SearchResult
+	for _, result := range results {
+		last := len(merged) - 1
+		if last >= 0 && merged[last].Path == result.Path && result.StartLine <= merged[last].EndLine+1 {
+			merged[last].EndLine = max(merged[last].EndLine, result.EndLine)
+			continue
+		}
+		merged = append(merged, result)
+	}
+
+	var builder strings.Builder
+	builder.WriteString("----- START RELEVANT CODE -----\n\n")
+
+	contents := make(map[string][]string)
+	for _, result := range merged {
+		lines, ok := contents[result.Path]
+		if !ok {
+			content, err := os.ReadFile(result.Path)
+			if err != nil {
+				continue // Il file potrebbe essere stato rimosso dopo l'indicizzazione
+			}
+			lines = strings.Split(string(content), "\n")
+			contents[result.Path] = lines
+		}
+
+		writeFileLines(&builder, result.Path, lines, result.StartLine, result.EndLine)
+	}
+
+	builder.WriteString("----- END RELEVANT CODE -----\n\n")
+	return builder.String(), nil
+}
@@ -0,0 +1,152 @@
+package context
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"isy-cli/internal/symbols"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Numero massimo di definizioni aggiunte a una singola richiesta
+const maxRelatedDefinitions = 20
+
+// FullyIncludedFiles restituisce i file che il contesto di sessione contiene per intero:
+// per questi non serve aggiungere definizioni a parte
+func FullyIncludedFiles(opts Options) (map[string]bool, error) {
+	settings, err := ResolveSettings(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	included := make(map[string]bool)
+	// Con il recupero semantico o un budget non è garantito che un file sia completo
+	if settings.Config.Embeddings.Enabled || settings.Budget > 0 {
+		return included, nil
+	}
+
+	filesFromContext, err := settings.Profile.Rules.Walk(".")
+	if err != nil {
+		return nil, fmt.Errorf("errore durante il recupero dei file del contesto: %v", err)
+	}
+
+	for _, path := range filesFromContext {
+		if settings.Mode == ModeOutline && filepath.Ext(path) == ".go" {
+			continue
+		}
+		included[path] = true
+	}
+	return included, nil
+}
+
+// SymbolIndex conserva l'indice dei simboli di una sessione. L'indice viene
+// ricostruito solo quando cambiano i file del contesto (elenco, dimensione o
+// data di modifica), come il contesto della sessione. Un SymbolIndex nil
+// ricostruisce l'indice a ogni richiesta.
+type SymbolIndex struct {
+	signature string
+	index     *symbols.Index
+}
+
+// get restituisce l'indice dei file indicati, riusando quello precedente se i
+// file non sono cambiati
+func (s *SymbolIndex) get(files []string) (*symbols.Index, error) {
+	signature := filesSignature(files)
+	if s != nil && s.index != nil && s.signature == signature {
+		return s.index, nil
+	}
+	index, err := symbols.BuildFromFiles(".", files)
+	if err != nil {
+		return nil, err
+	}
+	if s != nil {
+		s.signature = signature
+		s.index = index
+	}
+	return index, nil
+}
+
+// filesSignature riassume percorso, dimensione e data di modifica dei file
+func filesSignature(files []string) string {
+	hash := sha256.New()
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(hash, "%s\x00missing\n", path)
+			continue
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00%d\n", path, info.Size(), info.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// BuildRelatedDefinitions usa l'indice dei simboli per aggiungere le definizioni
+// citate nella richiesta e quelle da cui dipendono, così il modello vede i tipi
+// dietro al codice che modifica. L'indice copre solo i file selezionati dal
+// profilo (e da .gitignore, se rispettato). I file già inclusi per intero vengono
+// saltati, e le definizioni citate che stanno nel contesto sono già coperte da esso.
+func BuildRelatedDefinitions(query string, opts Options, cache *SymbolIndex) (string, error) {
+	filesFromContext, err := GetContextFiles(opts)
+	if err != nil {
+		return "", fmt.Errorf("errore durante il recupero dei file del contesto: %v", err)
+	}
+	inContext := make(map[string]bool)
+	for _, path := range filesFromContext {
+		inContext[path] = true
+	}
+
+	index, err := cache.get(filesFromContext)
+	if err != nil {
+		return "", err
+	}
+
+	included, err := FullyIncludedFiles(opts)
+	if err != nil {
+		return "", err
+	}
+
+	var selected []symbols.Symbol
+	seen := make(map[symbols.Symbol]bool)
+	add := func(symbol symbols.Symbol) {
+		if seen[symbol] || included[symbol.Path] || len(selected) >= maxRelatedDefinitions {
+			return
+		}
+		seen[symbol] = true
+		selected = append(selected, symbol)
+	}
+
+	for _, mentioned := range index.Mentioned(query) {
+		if !inContext[mentioned.Path] {
+			add(mentioned)
+		}
+		for _, dependency := range index.Dependencies(mentioned) {
+			add(dependency)
+		}
+	}
+
+	if len(selected) == 0 {
+		return "", nil
+	}
+
+	var builder strings.Builder
+	builder.WriteString("----- START RELATED DEFINITIONS -----\n\n")
+
+	contents := make(map[string][]string)
+	for _, symbol := range selected {
+		lines, ok := contents[symbol.Path]
+		if !ok {
+			content, err := os.ReadFile(symbol.Path)
+			if err != nil {
+				return "", fmt.Errorf("errore durante la lettura del file %s: %v", symbol.Path, err)
+			}
+			lines = strings.Split(string(content), "\n")
+			contents[symbol.Path] = lines
+		}
+		writeFileLines(&builder, symbol.Path, lines, symbol.StartLine, symbol.EndLine)
+	}
+
+	builder.WriteString("----- END RELATED DEFINITIONS -----\n\n")
+	return builder.String(), nil
+}
@@ -1,26 +1,19 @@
 package context
 
 import (
-	"bufio"
 	"fmt"
 	"io/ioutil"
-	"isy-cli/internal/config"
+	"isy-cli/internal/openai"
+	"isy-cli/internal/project"
 	"os"
 	"path/filepath"
 	"strings"
-
-	"github.com/zabawaba99/go-gitignore"
 )
 
-func GenerateTree() (string, error) {
+// GenerateTree disegna l'albero delle directory che contengono i file indicati
+func GenerateTree(filesFromContext []string) (string, error) {
 	baseDir := "."
 
-	// Ottieni i file da includere dalla funzione GetFilesFromIsyContext
-	filesFromContext, err := GetFilesFromIsyContext()
-	if err != nil {
-		return "", fmt.Errorf("errore durante il recupero dei file da .isycontext: %v", err)
-	}
-
 	// Usa una mappa per verifiche veloci
 	fileSet := make(map[string]bool)
 	for _, file := range filesFromContext {
@@ -85,7 +78,7 @@ func GenerateTree() (string, error) {
 
 	// Aggiungi la directory di base
 	treeBuilder.WriteString(fmt.Sprintf("%s/\n", filepath.Base(baseDir)))
-	err = buildTree(baseDir, "")
+	err := buildTree(baseDir, "")
 	if err != nil {
 		return "", err
 	}
@@ -93,17 +86,17 @@ func GenerateTree() (string, error) {
 	return treeBuilder.String(), nil
 }
 
-func MergeFiles() (string, error) {
-
-	// Ottieni la lista dei file da GetFilesFromIsyContext
-	filesFromContext, err := GetFilesFromIsyContext()
-	if err != nil {
-		return "", fmt.Errorf("errore durante il recupero dei file da .isycontext: %v", err)
-	}
+// MergeFiles unisce i file indicati. In modalità outline i file Go vengono
+// ridotti allo scheletro delle dichiarazioni, gli altri restano completi.
+// Con un budget di token, i file che non ci stanno vengono prima ridotti
+// a outline (se Go) e poi omessi, elencandoli in fondo.
+func MergeFiles(settings *Settings, files []string) (string, error) {
 
 	var mergedContent strings.Builder
+	var omitted []string
+	usedTokens := 0
 
-	for _, path := range filesFromContext {
+	for _, path := range files {
 		info, err := os.Stat(path)
 		if err != nil || info.IsDir() {
 			continue // Ignora file non validi o directory
@@ -115,118 +108,159 @@ func MergeFiles() (string, error) {
 			return "", fmt.Errorf("errore durante la lettura del file %s: %v", path, err)
 		}
 
-		lines := strings.Split(string(content), "\n")
-
-		mergedContent.WriteString("----- START FILE -----\n")
-		mergedContent.WriteString(fmt.Sprintf("FILE: %s\n", path))
-		mergedContent.WriteString("----- CONTENT -----\n")
+		section := renderFile(path, content, settings.Mode, settings.LineNumbers)
 
-		for i, line := range lines {
-			mergedContent.WriteString(fmt.Sprintf("%d: %s\n", i+1, line))
+		if settings.Budget > 0 {
+			tokens := openai.CountTokens(section)
+			if usedTokens+tokens > settings.Budget && settings.Mode == ModeFull && filepath.Ext(path) == ".go" {
+				section = renderFile(path, content, ModeOutline, settings.LineNumbers)
+				tokens = openai.CountTokens(section)
+			}
+			if usedTokens+tokens > settings.Budget {
+				omitted = append(omitted, path)
+				continue
+			}
+			usedTokens += tokens
 		}
 
-		mergedContent.WriteString("----- END FILE -----\n\n")
+		mergedContent.WriteString(section)
+	}
+
+	if len(omitted) > 0 {
+		mergedContent.WriteString(fmt.Sprintf("----- OMITTED FILES (token budget %d) -----\n", settings.Budget))
+		for _, path := range omitted {
+			mergedContent.WriteString(path + "\n")
+		}
+		mergedContent.WriteString("----- END OMITTED FILES -----\n\n")
 	}
 
 	return mergedContent.String(), nil
 }
 
-func readPatternsFromFile(filePath string) ([]string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("errore durante l'apertura del file: %v", err)
-	}
-	defer file.Close()
-
-	var patterns []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		// Ignore comments and empty lines
-		if line == "" || line[0] == '#' {
-			continue
+// renderFile rende un file nel formato del contesto
+func renderFile(path string, content []byte, mode string, lineNumbers bool) string {
+	var builder strings.Builder
+
+	if mode == ModeOutline && filepath.Ext(path) == ".go" {
+		outline, err := GoOutline(path, content)
+		if err == nil {
+			builder.WriteString("----- START FILE -----\n")
+			builder.WriteString(fmt.Sprintf("FILE: %s (outline)\n", path))
+			builder.WriteString("----- CONTENT -----\n")
+			builder.WriteString(outline)
+			builder.WriteString("----- END FILE -----\n\n")
+			return builder.String()
 		}
-		patterns = append(patterns, line)
+		// Se il file non compila viene incluso per intero
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("errore durante la lettura del file: %v", err)
+	lines := strings.Split(string(content), "\n")
+	if lineNumbers {
+		writeFileLines(&builder, path, lines, 1, len(lines))
+		return builder.String()
 	}
 
-	return patterns, nil
+	builder.WriteString("----- START FILE -----\n")
+	builder.WriteString(fmt.Sprintf("FILE: %s\n", path))
+	builder.WriteString("----- CONTENT -----\n")
+	builder.WriteString(string(content))
+	if !strings.HasSuffix(string(content), "\n") {
+		builder.WriteString("\n")
+	}
+	builder.WriteString("----- END FILE -----\n\n")
+	return builder.String()
 }
 
 func GetFilesFromIsyContext() ([]string, error) {
+	return GetContextFiles(Options{})
+}
+
+// GetContextFiles restituisce i file selezionati dal profilo indicato nelle opzioni
+func GetContextFiles(opts Options) ([]string, error) {
 	baseDir := "."
-	isyContextPath := filepath.Join(baseDir, ".isycontext")
 
-	// Legge i pattern dal file
-	filePatterns, err := readPatternsFromFile(isyContextPath)
+	settings, err := ResolveSettings(opts)
 	if err != nil {
 		return nil, err
 	}
-	var matchedFiles []string
-
-	// Scansiona i file nella directory
-	err = filepath.Walk(baseDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Salta la directory ".isy"
-		if info.IsDir() && info.Name() == ".isy" {
-			return filepath.SkipDir
-		}
 
-		// Salta la directory ".isy"
-		if info.IsDir() && info.Name() == ".git" {
-			return filepath.SkipDir
-		}
+	// Scansiona i file nella directory, saltando quelle escluse
+	matchedFiles, err := settings.Profile.Rules.Walk(baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("errore durante il matching dei file: %v", err)
+	}
 
-		// Salta directory
-		if info.IsDir() {
-			return nil
-		}
+	return matchedFiles, nil
+}
 
-		// Confronta i glob pattern
-		for _, pattern := range filePatterns {
-			// Usa il pattern per confrontare
-			matched := gitignore.Match(pattern, path)
-			if matched {
-				matchedFiles = append(matchedFiles, path)
-				break
-			}
-		}
-		return nil
-	})
+// ExplainPath spiega quale regola del profilo include o esclude un percorso
+func ExplainPath(path string, opts Options) (Decision, error) {
+	settings, err := ResolveSettings(opts)
+	if err != nil {
+		return Decision{}, err
+	}
 
+	info, err := os.Stat(path)
 	if err != nil {
-		return nil, fmt.Errorf("errore durante il matching dei file: %v", err)
+		return Decision{}, fmt.Errorf("impossibile accedere a %s: %v", path, err)
 	}
 
-	return matchedFiles, nil
+	return settings.Profile.Rules.Decide(filepath.Clean(path), info), nil
+}
+
+// Options personalizza la costruzione del contesto
+type Options struct {
+	Mode    string // "full" o "outline"; se vuoto decidono profilo e configurazione
+	Profile string // Profilo di contesto; se vuoto si usa context.profile o .isycontext
 }
 
 func BuildContext() (string, error) {
+	return BuildContextWithOptions(Options{})
+}
+
+// BuildContextWithOptions genera il contesto completo con le opzioni indicate
+func BuildContextWithOptions(opts Options) (string, error) {
+	return buildContext(opts, true)
+}
+
+// BuildBaseContext genera il contesto con le sole informazioni di progetto e l'albero dei file.
+// Si usa con il recupero semantico, dove i file vengono scelti a ogni richiesta.
+func BuildBaseContext(opts Options) (string, error) {
+	return buildContext(opts, false)
+}
+
+func buildContext(opts Options, includeFiles bool) (string, error) {
 
-	// Carica la configurazione del progetto
-	cfg, err := config.LoadConfig()
+	// Carica configurazione e profilo
+	settings, err := ResolveSettings(opts)
 	if err != nil {
-		return "", fmt.Errorf("errore durante il caricamento della configurazione: %v", err)
+		return "", err
+	}
+	cfg := settings.Config
+
+	files, err := settings.Profile.Rules.Walk(".")
+	if err != nil {
+		return "", fmt.Errorf("errore durante il recupero dei file del contesto: %v", err)
 	}
 
+	// I file della directory corrente vengono resi per primi: con un budget di
+	// token sono gli ultimi a essere omessi
+	files = prioritizeSubdir(files)
+
 	// Genera l'albero dei file
-	projectTree, err := GenerateTree()
+	projectTree, err := GenerateTree(files)
 	if err != nil {
 		return "", fmt.Errorf("errore durante la generazione dell'albero del progetto: %v", err)
 	}
 
 	// Unisce i contenuti dei file specificati
-	mergedContent, err := MergeFiles()
-	if err != nil {
-		return "", fmt.Errorf("errore durante la generazione del contesto dei file: %v", err)
+	var mergedContent string
+	if includeFiles {
+		mergedContent, err = MergeFiles(settings, files)
+		if err != nil {
+			return "", fmt.Errorf("errore durante la generazione del contesto dei file: %v", err)
+		}
 	}
-
 	// Costruisce il contesto come stringa
 	var contextBuilder strings.Builder
 
@@ -235,6 +269,9 @@ func BuildContext() (string, error) {
 	contextBuilder.WriteString("----- PROJECT INFO -----\n\n")
 	contextBuilder.WriteString(fmt.Sprintf("Project Name: %s\n", cfg.ProjectName))
 	contextBuilder.WriteString(fmt.Sprintf("Description: %s\n", cfg.Description))
+	if subdir := project.Subdir(); subdir != "" {
+		contextBuilder.WriteString(fmt.Sprintf("Current Directory: %s\n", subdir))
+	}
 	contextBuilder.WriteString("\n----- END PROJECT INFO -----\n\n")
 
 	// Aggiungi l'albero dei file
@@ -248,3 +285,21 @@ func BuildContext() (string, error) {
 
 	return contextBuilder.String(), nil
 }
+
+// prioritizeSubdir sposta in testa i file della directory da cui è stato
+// lanciato il comando, mantenendo l'ordine relativo degli altri
+func prioritizeSubdir(files []string) []string {
+	if project.Subdir() == "" {
+		return files
+	}
+	prioritized := make([]string, 0, len(files))
+	var others []string
+	for _, path := range files {
+		if project.InSubdir(path) {
+			prioritized = append(prioritized, path)
+		} else {
+			others = append(others, path)
+		}
+	}
+	return append(prioritized, others...)
+}
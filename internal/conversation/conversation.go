@@ -0,0 +1,221 @@
+package conversation
+
+import (
+	"fmt"
+	localOpenAI "isy-cli/internal/openai"
+	"isy-cli/internal/sessions"
+
+	"github.com/openai/openai-go"
+)
+
+const (
+	DefaultThreshold = 60000 // Token oltre i quali la conversazione viene compattata
+	DefaultKeepTurns = 4     // Scambi recenti mai riassunti
+)
+
+// Turn è un messaggio della conversazione
+type Turn struct {
+	Role    string // "user" oppure "assistant"
+	Content string // Testo della richiesta o della risposta
+	Extra   string // Codice recuperato per la richiesta, anteposto al testo
+}
+
+// Options controlla la compattazione automatica
+type Options struct {
+	Disabled  bool
+	Threshold int // Token oltre i quali compattare (0 = DefaultThreshold)
+	KeepTurns int // Scambi recenti da lasciare intatti (0 = DefaultKeepTurns)
+}
+
+// Conversation tiene i messaggi di una sessione in forma testuale, così da
+// poterli compattare prima di convertirli nei messaggi per il modello
+type Conversation struct {
+	System      string
+	Context     string
+	ContextHash string
+	Summary     string // Riassunto dei turni già compattati
+	Turns       []Turn
+	Options     Options
+}
+
+func New(system, context string, opts Options) *Conversation {
+	return &Conversation{
+		System:      system,
+		Context:     context,
+		ContextHash: sessions.ContextHash(context),
+		Options:     opts,
+	}
+}
+
+func (c *Conversation) AddUser(content, extra string) {
+	c.Turns = append(c.Turns, Turn{Role: "user", Content: content, Extra: extra})
+}
+
+func (c *Conversation) AddAssistant(content string) {
+	c.Turns = append(c.Turns, Turn{Role: "assistant", Content: content})
+}
+
+// AppendExtra aggiunge codice recuperato all'ultima richiesta, ad esempio i
+// risultati delle funzioni chiamate dal modello: la compattazione lo toglie per primo
+func (c *Conversation) AppendExtra(extra string) {
+	for i := len(c.Turns) - 1; i >= 0; i-- {
+		if c.Turns[i].Role == "user" {
+			c.Turns[i].Extra += extra
+			return
+		}
+	}
+}
+
+// DropLast rimuove l'ultimo turno, ad esempio una richiesta fallita
+func (c *Conversation) DropLast() {
+	if len(c.Turns) > 0 {
+		c.Turns = c.Turns[:len(c.Turns)-1]
+	}
+}
+
+// RefreshContext sostituisce il contesto se è cambiato e lo segnala
+func (c *Conversation) RefreshContext(context string) bool {
+	hash := sessions.ContextHash(context)
+	if hash == c.ContextHash {
+		return false
+	}
+	c.Context = context
+	c.ContextHash = hash
+	return true
+}
+
+// Messages converte la conversazione nei messaggi da inviare al modello
+func (c *Conversation) Messages() []openai.ChatCompletionMessageParamUnion {
+	messages := []openai.ChatCompletionMessageParamUnion{
+		openai.SystemMessage(c.System),
+		openai.UserMessage(c.Context),
+	}
+	if c.Summary != "" {
+		messages = append(messages, openai.UserMessage(summaryBlock(c.Summary)))
+	}
+	for _, turn := range c.Turns {
+		switch turn.Role {
+		case "user":
+			messages = append(messages, openai.UserMessage(turn.Extra+turn.Content))
+		case "assistant":
+			messages = append(messages, openai.AssistantMessage(turn.Content))
+		}
+	}
+	return messages
+}
+
+func summaryBlock(summary string) string {
+	return "----- CONVERSATION SUMMARY (earlier turns) -----\n\n" + summary + "\n\n----- END CONVERSATION SUMMARY -----\n"
+}
+
+// Tokens stima i token che la conversazione occupa nella richiesta
+func (c *Conversation) Tokens() int {
+	tokens := localOpenAI.CountTokens(c.System) + localOpenAI.CountTokens(c.Context)
+	if c.Summary != "" {
+		tokens += localOpenAI.CountTokens(summaryBlock(c.Summary))
+	}
+	for _, turn := range c.Turns {
+		tokens += localOpenAI.CountTokens(turn.Extra) + localOpenAI.CountTokens(turn.Content)
+	}
+	return tokens
+}
+
+// Threshold restituisce i token oltre i quali la conversazione viene compattata
+func (c *Conversation) Threshold() int {
+	if c.Options.Threshold > 0 {
+		return c.Options.Threshold
+	}
+	return DefaultThreshold
+}
+
+func (c *Conversation) keepTurns() int {
+	if c.Options.KeepTurns > 0 {
+		return c.Options.KeepTurns
+	}
+	return DefaultKeepTurns
+}
+
+// Summarizer riassume i turni più vecchi insieme al riassunto precedente
+type Summarizer func(previousSummary string, turns []Turn) (string, error)
+
+// Report descrive una compattazione, da mostrare all'utente
+type Report struct {
+	Before        int // Token prima della compattazione
+	After         int // Token dopo la compattazione
+	DroppedBlocks int // Blocchi di codice recuperato rimossi dai turni vecchi
+	Summarized    int // Messaggi sostituiti dal riassunto
+}
+
+func (r Report) String() string {
+	result := fmt.Sprintf("Conversazione compattata: %d -> %d token", r.Before, r.After)
+	if r.DroppedBlocks > 0 {
+		result += fmt.Sprintf(", %d blocchi di codice superati rimossi", r.DroppedBlocks)
+	}
+	if r.Summarized > 0 {
+		result += fmt.Sprintf(", %d messaggi riassunti", r.Summarized)
+	}
+	return result
+}
+
+// Compact riduce la conversazione quando supera la soglia di token. Prima toglie
+// il codice recuperato per le richieste passate, ormai superato dal contesto
+// attuale; se non basta riassume gli scambi più vecchi, lasciando intatti i
+// più recenti. Restituisce nil se non è stato necessario compattare.
+func (c *Conversation) Compact(summarize Summarizer) (*Report, error) {
+	if c.Options.Disabled {
+		return nil, nil
+	}
+	before := c.Tokens()
+	if before <= c.Threshold() {
+		return nil, nil
+	}
+	report := &Report{Before: before}
+
+	// Il codice recuperato serve solo alla richiesta più recente
+	lastUser := -1
+	for i := len(c.Turns) - 1; i >= 0; i-- {
+		if c.Turns[i].Role == "user" {
+			lastUser = i
+			break
+		}
+	}
+	for i := range c.Turns {
+		if i != lastUser && c.Turns[i].Extra != "" {
+			c.Turns[i].Extra = ""
+			report.DroppedBlocks++
+		}
+	}
+
+	if c.Tokens() > c.Threshold() {
+		split := c.keepFrom()
+		if split > 0 {
+			summary, err := summarize(c.Summary, c.Turns[:split])
+			if err != nil {
+				return nil, fmt.Errorf("errore durante il riassunto della conversazione: %v", err)
+			}
+			c.Summary = summary
+			c.Turns = append([]Turn(nil), c.Turns[split:]...)
+			report.Summarized = split
+		}
+	}
+
+	if report.DroppedBlocks == 0 && report.Summarized == 0 {
+		return nil, nil
+	}
+	report.After = c.Tokens()
+	return report, nil
+}
+
+// keepFrom restituisce l'indice del primo turno tra gli scambi recenti da conservare
+func (c *Conversation) keepFrom() int {
+	kept := 0
+	for i := len(c.Turns) - 1; i >= 0; i-- {
+		if c.Turns[i].Role == "user" {
+			kept++
+			if kept == c.keepTurns() {
+				return i
+			}
+		}
+	}
+	return 0
+}
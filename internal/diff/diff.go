@@ -0,0 +1,300 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kind è il tipo di una riga in un confronto
+type Kind int
+
+const (
+	Equal Kind = iota
+	Delete
+	Insert
+)
+
+// Op è una riga del confronto tra due testi
+type Op struct {
+	Kind Kind
+	Line string
+}
+
+// Lines confronta due sequenze di righe con l'algoritmo di Myers e restituisce
+// la sequenza minima di righe uguali, rimosse e aggiunte
+func Lines(a, b []string) []Op {
+	// Il prefisso e il suffisso comuni non servono all'algoritmo
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []Op
+	for _, line := range a[:prefix] {
+		ops = append(ops, Op{Kind: Equal, Line: line})
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, Op{Kind: Equal, Line: line})
+	}
+	return ops
+}
+
+// myers calcola il confronto in spazio lineare: invece di conservare gli stati di
+// ogni passo per ricostruire il percorso, divide il problema sul "middle snake"
+// (la diagonale in cui si incontrano la ricerca in avanti e quella all'indietro)
+// e risolve ricorsivamente le due metà
+func myers(a, b []string) []Op {
+	var ops []Op
+	compare(a, b, &ops)
+	return ops
+}
+
+func compare(a, b []string, ops *[]Op) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	for _, line := range a[:prefix] {
+		*ops = append(*ops, Op{Kind: Equal, Line: line})
+	}
+	middleA, middleB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	switch {
+	case len(middleA) == 0:
+		for _, line := range middleB {
+			*ops = append(*ops, Op{Kind: Insert, Line: line})
+		}
+	case len(middleB) == 0:
+		for _, line := range middleA {
+			*ops = append(*ops, Op{Kind: Delete, Line: line})
+		}
+	default:
+		// Senza prefisso e suffisso comuni servono almeno due modifiche, quindi
+		// entrambe le metà sono più corte del problema di partenza
+		x, y, u, v := middleSnake(middleA, middleB)
+		compare(middleA[:x], middleB[:y], ops)
+		for _, line := range middleA[x:u] {
+			*ops = append(*ops, Op{Kind: Equal, Line: line})
+		}
+		compare(middleA[u:], middleB[v:], ops)
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		*ops = append(*ops, Op{Kind: Equal, Line: line})
+	}
+}
+
+// middleSnake restituisce inizio (x, y) e fine (u, v) della sequenza di righe
+// uguali che sta a metà di un percorso minimo. La ricerca all'indietro usa le
+// coordinate dalla fine dei testi: la diagonale k in avanti corrisponde alla
+// diagonale delta-k all'indietro.
+func middleSnake(a, b []string) (int, int, int, int) {
+	n, m := len(a), len(b)
+	limit := (n + m + 1) / 2
+	offset := limit + 1
+	forward := make([]int, 2*limit+3)
+	backward := make([]int, 2*limit+3)
+	delta := n - m
+	odd := delta%2 != 0
+
+	for d := 0; d <= limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			if back := delta - k; odd && back >= -(d-1) && back <= d-1 && x+backward[offset+back] >= n {
+				return startX, startY, x, y
+			}
+		}
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			if front := delta - k; !odd && front >= -d && front <= d && x+forward[offset+front] >= n {
+				return n - x, m - y, n - startX, m - startY
+			}
+		}
+	}
+	// Non raggiungibile: i due percorsi si incontrano entro (n+m+1)/2 passi
+	return 0, 0, 0, 0
+}
+
+// SplitLines divide un testo in righe senza il terminatore e indica se l'ultima
+// riga termina con un a capo
+func SplitLines(text string) ([]string, bool) {
+	if text == "" {
+		return nil, true
+	}
+	newline := strings.HasSuffix(text, "\n")
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n"), newline
+}
+
+// Unified restituisce le differenze tra due testi nel formato unified diff, con
+// context righe di contesto attorno a ogni modifica. Restituisce "" se i testi
+// coincidono.
+func Unified(oldName, newName, oldText, newText string, context int) string {
+	if oldText == newText {
+		return ""
+	}
+	a, aNewline := SplitLines(oldText)
+	b, bNewline := SplitLines(newText)
+
+	// Un'ultima riga senza a capo è diversa dalla stessa riga con l'a capo: la
+	// si marca durante il confronto, così risulta modificata se cambia solo l'a capo
+	ops := Lines(markLastLine(a, aNewline), markLastLine(b, bNewline))
+	for i := range ops {
+		ops[i].Line = strings.TrimSuffix(ops[i].Line, noNewlineMarker)
+	}
+
+	var builder strings.Builder
+	builder.WriteString("--- " + oldName + "\n")
+	builder.WriteString("+++ " + newName + "\n")
+
+	for _, hunk := range hunks(ops, context) {
+		oldStart, oldCount, newStart, newCount := hunk.ranges(ops)
+		builder.WriteString(fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount)))
+
+		oldLine, newLine := hunk.oldLine, hunk.newLine
+		for _, op := range ops[hunk.start:hunk.end] {
+			switch op.Kind {
+			case Equal:
+				builder.WriteString(" " + op.Line + "\n")
+				oldLine++
+				newLine++
+				if (oldLine == len(a) && !aNewline) || (newLine == len(b) && !bNewline) {
+					builder.WriteString("\\ No newline at end of file\n")
+				}
+			case Delete:
+				builder.WriteString("-" + op.Line + "\n")
+				oldLine++
+				if oldLine == len(a) && !aNewline {
+					builder.WriteString("\\ No newline at end of file\n")
+				}
+			case Insert:
+				builder.WriteString("+" + op.Line + "\n")
+				newLine++
+				if newLine == len(b) && !bNewline {
+					builder.WriteString("\\ No newline at end of file\n")
+				}
+			}
+		}
+	}
+	return builder.String()
+}
+
+// noNewlineMarker distingue durante il confronto un'ultima riga senza a capo
+const noNewlineMarker = "\x00no-newline"
+
+func markLastLine(lines []string, newline bool) []string {
+	if newline || len(lines) == 0 {
+		return lines
+	}
+	marked := append([]string(nil), lines...)
+	marked[len(marked)-1] += noNewlineMarker
+	return marked
+}
+
+// hunk è un intervallo di ops con le modifiche vicine e il loro contesto
+type hunk struct {
+	start, end       int // Intervallo in ops
+	oldLine, newLine int // Righe (da 0) dei due testi all'inizio dell'intervallo
+}
+
+func (h hunk) ranges(ops []Op) (oldStart, oldCount, newStart, newCount int) {
+	for _, op := range ops[h.start:h.end] {
+		if op.Kind != Insert {
+			oldCount++
+		}
+		if op.Kind != Delete {
+			newCount++
+		}
+	}
+	return h.oldLine + 1, oldCount, h.newLine + 1, newCount
+}
+
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprintf("%d", start)
+	default:
+		return fmt.Sprintf("%d,%d", start, count)
+	}
+}
+
+// hunks raggruppa le modifiche separate da al più 2*context righe uguali
+func hunks(ops []Op, context int) []hunk {
+	var result []hunk
+	oldLine, newLine := 0, 0
+	positions := make([][2]int, len(ops)+1)
+	for i, op := range ops {
+		positions[i] = [2]int{oldLine, newLine}
+		if op.Kind != Insert {
+			oldLine++
+		}
+		if op.Kind != Delete {
+			newLine++
+		}
+	}
+	positions[len(ops)] = [2]int{oldLine, newLine}
+
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == Equal {
+			i++
+			continue
+		}
+		start := max(i-context, 0)
+		end := i
+		for end < len(ops) {
+			if ops[end].Kind != Equal {
+				end++
+				continue
+			}
+			// Conta le righe uguali che seguono: se sono poche il blocco continua
+			equal := end
+			for equal < len(ops) && ops[equal].Kind == Equal {
+				equal++
+			}
+			if equal < len(ops) && equal-end <= 2*context {
+				end = equal
+				continue
+			}
+			end = min(end+context, len(ops))
+			break
+		}
+		result = append(result, hunk{start: start, end: end, oldLine: positions[start][0], newLine: positions[start][1]})
+		i = end
+	}
+	return result
+}
@@ -0,0 +1,557 @@
+package diff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxFuzz è il numero massimo di righe di contesto che si possono ignorare
+// all'inizio e alla fine di un hunk, come l'opzione --fuzz di patch
+const maxFuzz = 2
+
+// FilePatch è la parte di una patch che riguarda un file
+type FilePatch struct {
+	OldPath string // "" per un file creato
+	NewPath string // "" per un file rimosso
+	Hunks   []Hunk
+	Binary  bool
+}
+
+// Hunk è un blocco di modifiche di una patch
+type Hunk struct {
+	OldStart, OldCount int
+	NewStart, NewCount int
+	Lines              []Op
+	OldNoNewline       bool // L'ultima riga del lato vecchio non termina con un a capo
+	NewNoNewline       bool // L'ultima riga del lato nuovo non termina con un a capo
+	Line               int  // Riga dell'intestazione nella patch, per gli errori
+}
+
+// Path restituisce il percorso del file dopo la patch (prima, se viene rimosso)
+func (p FilePatch) Path() string {
+	if p.NewPath != "" {
+		return p.NewPath
+	}
+	return p.OldPath
+}
+
+// Status descrive la modifica: "added", "deleted", "renamed" oppure "modified"
+func (p FilePatch) Status() string {
+	switch {
+	case p.OldPath == "":
+		return "added"
+	case p.NewPath == "":
+		return "deleted"
+	case p.OldPath != p.NewPath:
+		return "renamed"
+	default:
+		return "modified"
+	}
+}
+
+// Stat riassume le righe aggiunte e rimosse, es. "+12 -3"
+func (p FilePatch) Stat() string {
+	if p.Binary {
+		return "binary"
+	}
+	added, removed := 0, 0
+	for _, hunk := range p.Hunks {
+		for _, op := range hunk.Lines {
+			switch op.Kind {
+			case Insert:
+				added++
+			case Delete:
+				removed++
+			}
+		}
+	}
+	return fmt.Sprintf("+%d -%d", added, removed)
+}
+
+func (h Hunk) header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldCount, h.NewStart, h.NewCount)
+}
+
+// Parse legge una patch in formato unified diff, anche con le intestazioni di git
+// (file creati, rimossi e rinominati). Il testo attorno alla patch, come una
+// spiegazione o i delimitatori ``` di Markdown, viene ignorato. I conteggi delle
+// righe negli hunk possono essere sbagliati: conta il contenuto.
+func Parse(text string) ([]FilePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	var patches []FilePatch
+	var current *FilePatch
+	headers := false // Il file corrente ha già le righe ---/+++
+
+	start := func(patch FilePatch) {
+		patches = append(patches, patch)
+		current = &patches[len(patches)-1]
+		headers = false
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			oldPath, newPath := parseGitPaths(strings.TrimPrefix(line, "diff --git "))
+			start(FilePatch{OldPath: oldPath, NewPath: newPath})
+
+		case current != nil && len(current.Hunks) == 0 && !headers && isGitExtendedHeader(line):
+			switch {
+			case strings.HasPrefix(line, "new file mode"):
+				current.OldPath = ""
+			case strings.HasPrefix(line, "deleted file mode"):
+				current.NewPath = ""
+			case strings.HasPrefix(line, "rename from "):
+				current.OldPath = strings.TrimPrefix(line, "rename from ")
+			case strings.HasPrefix(line, "rename to "):
+				current.NewPath = strings.TrimPrefix(line, "rename to ")
+			}
+
+		case strings.HasPrefix(line, "Binary files ") && current != nil:
+			current.Binary = true
+
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			oldPath := parseHeaderPath(strings.TrimPrefix(line, "--- "), "a/")
+			newPath := parseHeaderPath(strings.TrimPrefix(lines[i+1], "+++ "), "b/")
+			// Le righe ---/+++ seguono "diff --git" oppure aprono un nuovo file
+			if current == nil || headers || len(current.Hunks) > 0 {
+				start(FilePatch{})
+			}
+			current.OldPath, current.NewPath = oldPath, newPath
+			headers = true
+			i++
+
+		case strings.HasPrefix(line, "@@"):
+			if current == nil {
+				return nil, fmt.Errorf("riga %d: hunk senza l'intestazione del file (--- e +++)", i+1)
+			}
+			hunk, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			current.Hunks = append(current.Hunks, hunk)
+			i = next - 1
+		}
+	}
+
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("nessuna patch trovata: attese le intestazioni --- e +++ seguite da hunk @@")
+	}
+	for _, patch := range patches {
+		if patch.OldPath == "" && patch.NewPath == "" {
+			return nil, fmt.Errorf("patch senza percorso del file")
+		}
+		if len(patch.Hunks) == 0 && !patch.Binary && patch.Status() == "modified" {
+			return nil, fmt.Errorf("la patch di %s non contiene modifiche", patch.Path())
+		}
+	}
+	return patches, nil
+}
+
+func isGitExtendedHeader(line string) bool {
+	for _, prefix := range []string{"new file mode", "deleted file mode", "rename from ", "rename to ",
+		"similarity index", "dissimilarity index", "index ", "old mode", "new mode", "copy from ", "copy to "} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseGitPaths legge i percorsi di "diff --git a/vecchio b/nuovo"
+func parseGitPaths(paths string) (string, string) {
+	if index := strings.LastIndex(paths, " b/"); index >= 0 {
+		return strings.TrimPrefix(paths[:index], "a/"), paths[index+len(" b/"):]
+	}
+	fields := strings.Fields(paths)
+	if len(fields) == 2 {
+		return strings.TrimPrefix(fields[0], "a/"), strings.TrimPrefix(fields[1], "b/")
+	}
+	return "", ""
+}
+
+// parseHeaderPath legge il percorso di una riga --- o +++, senza data né prefisso
+func parseHeaderPath(path, prefix string) string {
+	if index := strings.IndexByte(path, '\t'); index >= 0 {
+		path = path[:index]
+	}
+	path = strings.TrimSpace(path)
+	if path == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(path, prefix)
+}
+
+// parseHunk legge un hunk a partire dalla sua intestazione e restituisce anche
+// l'indice della prima riga successiva
+func parseHunk(lines []string, start int) (Hunk, int, error) {
+	hunk := Hunk{Line: start + 1}
+	if err := parseHunkHeader(lines[start], &hunk); err != nil {
+		return Hunk{}, 0, fmt.Errorf("riga %d: %v", start+1, err)
+	}
+
+	i := start + 1
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if line == "" {
+			// Molti generatori tolgono lo spazio dalle righe di contesto vuote
+			hunk.Lines = append(hunk.Lines, Op{Kind: Equal})
+			continue
+		}
+		switch line[0] {
+		case ' ':
+			hunk.Lines = append(hunk.Lines, Op{Kind: Equal, Line: line[1:]})
+		case '-':
+			if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+				return finishHunk(hunk), i, nil
+			}
+			hunk.Lines = append(hunk.Lines, Op{Kind: Delete, Line: line[1:]})
+		case '+':
+			hunk.Lines = append(hunk.Lines, Op{Kind: Insert, Line: line[1:]})
+		case '\\':
+			// "\ No newline at end of file" si riferisce alla riga precedente
+			if len(hunk.Lines) > 0 {
+				switch hunk.Lines[len(hunk.Lines)-1].Kind {
+				case Delete:
+					hunk.OldNoNewline = true
+				case Insert:
+					hunk.NewNoNewline = true
+				default:
+					hunk.OldNoNewline, hunk.NewNoNewline = true, true
+				}
+			}
+		default:
+			return finishHunk(hunk), i, nil
+		}
+	}
+	return finishHunk(hunk), i, nil
+}
+
+// finishHunk toglie le righe vuote finali che separano l'hunk dal testo
+// successivo e non fanno parte del contesto dichiarato nell'intestazione
+func finishHunk(hunk Hunk) Hunk {
+	for len(hunk.Lines) > 0 {
+		last := hunk.Lines[len(hunk.Lines)-1]
+		oldCount, newCount := hunk.counts()
+		if last.Kind != Equal || last.Line != "" || (oldCount <= hunk.OldCount && newCount <= hunk.NewCount) {
+			break
+		}
+		hunk.Lines = hunk.Lines[:len(hunk.Lines)-1]
+	}
+	return hunk
+}
+
+func (h Hunk) counts() (oldCount, newCount int) {
+	for _, op := range h.Lines {
+		if op.Kind != Insert {
+			oldCount++
+		}
+		if op.Kind != Delete {
+			newCount++
+		}
+	}
+	return oldCount, newCount
+}
+
+// parseHunkHeader legge "@@ -a,b +c,d @@"; i conteggi possono mancare
+func parseHunkHeader(line string, hunk *Hunk) error {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return fmt.Errorf("intestazione dell'hunk non valida: %q", line)
+	}
+	var err error
+	if hunk.OldStart, hunk.OldCount, err = parseRange(fields[1][1:]); err != nil {
+		return fmt.Errorf("intestazione dell'hunk non valida %q: %v", line, err)
+	}
+	if hunk.NewStart, hunk.NewCount, err = parseRange(fields[2][1:]); err != nil {
+		return fmt.Errorf("intestazione dell'hunk non valida %q: %v", line, err)
+	}
+	return nil
+}
+
+func parseRange(value string) (int, int, error) {
+	startText, countText, hasCount := strings.Cut(value, ",")
+	start, err := strconv.Atoi(startText)
+	if err != nil {
+		return 0, 0, err
+	}
+	count := 1
+	if hasCount {
+		if count, err = strconv.Atoi(countText); err != nil {
+			return 0, 0, err
+		}
+	}
+	return start, count, nil
+}
+
+// Apply applica gli hunk al contenuto del file. Ogni hunk viene cercato prima
+// nella posizione indicata, poi a distanza crescente (offset), poi ignorando gli
+// spazi e infine ignorando fino a due righe di contesto agli estremi (fuzz).
+// Restituisce anche una nota per ogni hunk applicato in modo approssimato; se
+// qualche hunk non si applica, l'errore li elenca tutti.
+func (p FilePatch) Apply(content string) (string, []string, error) {
+	lines, newline := SplitLines(content)
+	if len(lines) == 0 {
+		newline = true
+	}
+
+	var result, notes, failures []string
+	cursor, offset := 0, 0
+	for i, hunk := range p.Hunks {
+		oldSide, newSide := hunk.sides()
+		base := hunk.OldStart - 1
+		if len(oldSide) == 0 {
+			// Inserimento puro: -N,0 indica l'inserimento dopo la riga N
+			base = hunk.OldStart
+		}
+		expected := base + offset
+
+		position, skipped, note, ok := locateHunk(lines, cursor, expected, hunk)
+		if !ok {
+			failures = append(failures, fmt.Sprintf("hunk %d (%s, riga %d della patch): %s",
+				i+1, hunk.header(), hunk.Line, describeMissing(lines, expected, oldSide)))
+			continue
+		}
+		if note != "" {
+			notes = append(notes, fmt.Sprintf("hunk %d applicato %s", i+1, note))
+		}
+
+		// Con il fuzz le righe di contesto ignorate restano quelle del file
+		oldSide = oldSide[skipped[0] : len(oldSide)-skipped[1]]
+		newSide = newSide[skipped[0] : len(newSide)-skipped[1]]
+
+		result = append(result, lines[cursor:position]...)
+		result = append(result, newSide...)
+		cursor = position + len(oldSide)
+		offset = position - skipped[0] - base
+
+		// L'a capo finale cambia solo se l'hunk arriva alla fine del file
+		if cursor == len(lines) && skipped[1] == 0 {
+			switch {
+			case hunk.NewNoNewline:
+				newline = false
+			case hunk.OldNoNewline:
+				newline = true
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return "", notes, fmt.Errorf("%s", strings.Join(failures, "; "))
+	}
+
+	result = append(result, lines[cursor:]...)
+	if len(result) == 0 {
+		return "", notes, nil
+	}
+	text := strings.Join(result, "\n")
+	if newline {
+		text += "\n"
+	}
+	return text, notes, nil
+}
+
+// sides restituisce le righe dell'hunk prima e dopo la modifica
+func (h Hunk) sides() (oldSide, newSide []string) {
+	for _, op := range h.Lines {
+		if op.Kind != Insert {
+			oldSide = append(oldSide, op.Line)
+		}
+		if op.Kind != Delete {
+			newSide = append(newSide, op.Line)
+		}
+	}
+	return oldSide, newSide
+}
+
+// locateHunk cerca la posizione dell'hunk a partire da cursor. skipped indica
+// le righe di contesto ignorate all'inizio e alla fine; note descrive lo
+// scostamento dalla posizione attesa, se c'è.
+func locateHunk(lines []string, cursor, expected int, hunk Hunk) (int, [2]int, string, bool) {
+	oldSide, _ := hunk.sides()
+	if len(oldSide) == 0 {
+		return min(max(expected, cursor), len(lines)), [2]int{}, "", true
+	}
+
+	leading, trailing := 0, 0
+	for _, op := range hunk.Lines {
+		if op.Kind != Equal {
+			break
+		}
+		leading++
+	}
+	for i := len(hunk.Lines) - 1; i >= 0 && hunk.Lines[i].Kind == Equal; i-- {
+		trailing++
+	}
+
+	comparisons := []struct {
+		name  string
+		equal func(a, b string) bool
+	}{
+		{"", func(a, b string) bool { return a == b }},
+		{"ignorando gli spazi", func(a, b string) bool {
+			return strings.Join(strings.Fields(a), " ") == strings.Join(strings.Fields(b), " ")
+		}},
+	}
+
+	for fuzz := 0; fuzz <= maxFuzz; fuzz++ {
+		skipStart, skipEnd := min(fuzz, leading), min(fuzz, trailing)
+		if fuzz > 0 && skipStart+skipEnd == 0 {
+			break
+		}
+		if skipStart+skipEnd >= len(oldSide) {
+			break
+		}
+		target := oldSide[skipStart : len(oldSide)-skipEnd]
+
+		for _, comparison := range comparisons {
+			position, ok := nearest(lines, target, cursor, expected+skipStart, comparison.equal)
+			if !ok {
+				continue
+			}
+			var details []string
+			if shift := position - (expected + skipStart); shift != 0 {
+				details = append(details, fmt.Sprintf("con offset %+d righe", shift))
+			}
+			if comparison.name != "" {
+				details = append(details, comparison.name)
+			}
+			if fuzz > 0 {
+				details = append(details, fmt.Sprintf("con fuzz %d", fuzz))
+			}
+			return position, [2]int{skipStart, skipEnd}, strings.Join(details, ", "), true
+		}
+	}
+	return 0, [2]int{}, "", false
+}
+
+// nearest cerca target in lines, non prima di cursor, alla minima distanza da expected
+func nearest(lines, target []string, cursor, expected int, equal func(a, b string) bool) (int, bool) {
+	matches := func(position int) bool {
+		if position < cursor || position+len(target) > len(lines) {
+			return false
+		}
+		for i := range target {
+			if !equal(lines[position+i], target[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// La posizione attesa può anche cadere oltre la fine del file
+	for distance := 0; distance <= max(expected, len(lines)-expected); distance++ {
+		if matches(expected - distance) {
+			return expected - distance, true
+		}
+		if distance > 0 && matches(expected+distance) {
+			return expected + distance, true
+		}
+	}
+	return 0, false
+}
+
+// describeMissing spiega quali righe dell'hunk non sono state trovate
+func describeMissing(lines []string, expected int, oldSide []string) string {
+	if expected >= len(lines) {
+		return fmt.Sprintf("le righe da sostituire non sono nel file, che ha %d righe (attese dalla riga %d)", len(lines), expected+1)
+	}
+	for i, line := range oldSide {
+		position := expected + i
+		if position < 0 || position >= len(lines) || strings.TrimSpace(lines[position]) != strings.TrimSpace(line) {
+			found := "fine del file"
+			if position >= 0 && position < len(lines) {
+				found = strconv.Quote(lines[position])
+			}
+			return fmt.Sprintf("le righe da sostituire non sono nel file; alla riga %d la patch si aspetta %q ma trova %s", position+1, line, found)
+		}
+	}
+	return fmt.Sprintf("le righe da sostituire non sono nel file dopo la riga %d", expected+1)
+}
+
+// Format riscrive una patch letta con Parse nel formato di git, ricalcolando le
+// intestazioni degli hunk e togliendo il testo che la circondava
+func Format(patches []FilePatch) string {
+	var builder strings.Builder
+	for _, patch := range patches {
+		oldPath, newPath := patch.OldPath, patch.NewPath
+		if oldPath == "" {
+			oldPath = newPath
+		}
+		if newPath == "" {
+			newPath = oldPath
+		}
+		builder.WriteString(fmt.Sprintf("diff --git a/%s b/%s\n", oldPath, newPath))
+		switch patch.Status() {
+		case "added":
+			builder.WriteString("new file mode 100644\n")
+		case "deleted":
+			builder.WriteString("deleted file mode 100644\n")
+		case "renamed":
+			builder.WriteString(fmt.Sprintf("rename from %s\nrename to %s\n", patch.OldPath, patch.NewPath))
+		}
+		if patch.Binary {
+			builder.WriteString(fmt.Sprintf("Binary files a/%s and b/%s differ\n", oldPath, newPath))
+			continue
+		}
+		if len(patch.Hunks) == 0 {
+			continue
+		}
+
+		oldName, newName := "a/"+patch.OldPath, "b/"+patch.NewPath
+		if patch.OldPath == "" {
+			oldName = "/dev/null"
+		}
+		if patch.NewPath == "" {
+			newName = "/dev/null"
+		}
+		builder.WriteString("--- " + oldName + "\n")
+		builder.WriteString("+++ " + newName + "\n")
+
+		for _, hunk := range patch.Hunks {
+			oldCount, newCount := hunk.counts()
+			builder.WriteString(fmt.Sprintf("@@ -%s +%s @@\n",
+				hunkRange(headerStart(hunk.OldStart, oldCount), oldCount), hunkRange(headerStart(hunk.NewStart, newCount), newCount)))
+			lastOld, lastNew := lastLines(hunk.Lines)
+			for i, op := range hunk.Lines {
+				prefix := " "
+				switch op.Kind {
+				case Delete:
+					prefix = "-"
+				case Insert:
+					prefix = "+"
+				}
+				builder.WriteString(prefix + op.Line + "\n")
+				if (i == lastOld && hunk.OldNoNewline) || (i == lastNew && hunk.NewNoNewline) {
+					builder.WriteString("\\ No newline at end of file\n")
+				}
+			}
+		}
+	}
+	return builder.String()
+}
+
+// headerStart converte l'inizio letto da un'intestazione nella riga (da 1) usata
+// da hunkRange: con zero righe l'intestazione indica la riga precedente
+func headerStart(start, count int) int {
+	if count == 0 {
+		return start + 1
+	}
+	return max(start, 1)
+}
+
+// lastLines restituisce l'indice dell'ultima riga del lato vecchio e del lato nuovo
+func lastLines(ops []Op) (lastOld, lastNew int) {
+	lastOld, lastNew = -1, -1
+	for i, op := range ops {
+		if op.Kind != Insert {
+			lastOld = i
+		}
+		if op.Kind != Delete {
+			lastNew = i
+		}
+	}
+	return lastOld, lastNew
+}
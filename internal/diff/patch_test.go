@@ -0,0 +1,196 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseApplyFormatRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+	}{
+		{"modifica in mezzo", "a\nb\nc\nd\ne\n", "a\nb\nC\nd\ne\n"},
+		{"inserimento all'inizio", "a\nb\n", "nuova\na\nb\n"},
+		{"inserimento alla fine", "a\nb\n", "a\nb\nc\n"},
+		{"rimozione di tutte le righe", "a\nb\n", ""},
+		{"file creato", "", "a\nb\n"},
+		{"hunk separati", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n", "uno\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ndodici\n"},
+		{"aggiunge l'a capo finale", "a\nb", "a\nb\n"},
+		{"toglie l'a capo finale", "a\nb\n", "a\nb"},
+		{"modifica l'ultima riga senza a capo", "a\nb", "a\nc"},
+		{"aggiunge righe dopo un'ultima riga senza a capo", "a\nb", "a\nb\nc\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldName := "a/file.txt"
+			if tt.old == "" {
+				oldName = "/dev/null"
+			}
+			text := Unified(oldName, "b/file.txt", tt.old, tt.new, 3)
+
+			patches, err := Parse(text)
+			if err != nil {
+				t.Fatalf("Parse: %v\n%s", err, text)
+			}
+			if len(patches) != 1 {
+				t.Fatalf("Parse: %d patch, attesa 1", len(patches))
+			}
+			got, _, err := patches[0].Apply(tt.old)
+			if err != nil {
+				t.Fatalf("Apply: %v\n%s", err, text)
+			}
+			if got != tt.new {
+				t.Fatalf("Apply = %q, atteso %q\n%s", got, tt.new, text)
+			}
+
+			// La patch riscritta da Format si rilegge e si applica allo stesso modo
+			formatted := Format(patches)
+			reparsed, err := Parse(formatted)
+			if err != nil {
+				t.Fatalf("Parse(Format): %v\n%s", err, formatted)
+			}
+			got, _, err = reparsed[0].Apply(tt.old)
+			if err != nil || got != tt.new {
+				t.Fatalf("Apply(Format) = %q, %v; atteso %q\n%s", got, err, tt.new, formatted)
+			}
+			if again := Format(reparsed); again != formatted {
+				t.Fatalf("Format non stabile:\n%s\n---\n%s", formatted, again)
+			}
+		})
+	}
+}
+
+func TestParseGitHeaders(t *testing.T) {
+	tests := []struct {
+		name             string
+		patch            string
+		status           string
+		oldPath, newPath string
+		hunks            int
+	}{
+		{
+			name: "rinomina con modifiche",
+			patch: "diff --git a/old.go b/new.go\nsimilarity index 90%\nrename from old.go\nrename to new.go\n" +
+				"--- a/old.go\n+++ b/new.go\n@@ -1,2 +1,2 @@\n package main\n-var x = 1\n+var x = 2\n",
+			status: "renamed", oldPath: "old.go", newPath: "new.go", hunks: 1,
+		},
+		{
+			name:   "rinomina senza modifiche",
+			patch:  "diff --git a/docs/a.md b/docs/b.md\nsimilarity index 100%\nrename from docs/a.md\nrename to docs/b.md\n",
+			status: "renamed", oldPath: "docs/a.md", newPath: "docs/b.md", hunks: 0,
+		},
+		{
+			name:   "file creato",
+			patch:  "diff --git a/n.txt b/n.txt\nnew file mode 100644\n--- /dev/null\n+++ b/n.txt\n@@ -0,0 +1 @@\n+ciao\n",
+			status: "added", oldPath: "", newPath: "n.txt", hunks: 1,
+		},
+		{
+			name:   "file rimosso",
+			patch:  "diff --git a/n.txt b/n.txt\ndeleted file mode 100644\n--- a/n.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-ciao\n",
+			status: "deleted", oldPath: "n.txt", newPath: "", hunks: 1,
+		},
+		{
+			name:   "testo attorno alla patch",
+			patch:  "Ecco la modifica:\n```diff\n--- a/f.txt\n+++ b/f.txt\n@@ -1 +1 @@\n-a\n+b\n```\nFatto.\n",
+			status: "modified", oldPath: "f.txt", newPath: "f.txt", hunks: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patches, err := Parse(tt.patch)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if len(patches) != 1 {
+				t.Fatalf("Parse: %d patch, attesa 1", len(patches))
+			}
+			patch := patches[0]
+			if patch.Status() != tt.status || patch.OldPath != tt.oldPath || patch.NewPath != tt.newPath || len(patch.Hunks) != tt.hunks {
+				t.Fatalf("Parse = %s %q -> %q con %d hunk, atteso %s %q -> %q con %d hunk",
+					patch.Status(), patch.OldPath, patch.NewPath, len(patch.Hunks), tt.status, tt.oldPath, tt.newPath, tt.hunks)
+			}
+
+			// Format conserva tipo e percorsi
+			reparsed, err := Parse(Format(patches))
+			if err != nil {
+				t.Fatalf("Parse(Format): %v\n%s", err, Format(patches))
+			}
+			if reparsed[0].Status() != tt.status || reparsed[0].OldPath != tt.oldPath || reparsed[0].NewPath != tt.newPath {
+				t.Fatalf("Parse(Format) = %s %q -> %q\n%s", reparsed[0].Status(), reparsed[0].OldPath, reparsed[0].NewPath, Format(patches))
+			}
+		})
+	}
+}
+
+func TestApplyApproximate(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		patch   string
+		want    string
+		note    string // Parte attesa della nota, "" se l'hunk si applica esattamente
+	}{
+		{
+			name:    "offset",
+			content: "x\ny\na\nb\nc\n",
+			patch:   "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			want:    "x\ny\na\nB\nc\n",
+			note:    "offset +2",
+		},
+		{
+			name:    "spazi diversi",
+			content: "func f() {\n\treturn 1\n}\n",
+			patch:   "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n func f() {\n-    return 1\n+\treturn 2\n }\n",
+			want:    "func f() {\n\treturn 2\n}\n",
+			note:    "ignorando gli spazi",
+		},
+		{
+			name:    "fuzz",
+			content: "uno\ndue\ntre\nquattro\n",
+			patch:   "--- a/f\n+++ b/f\n@@ -1,4 +1,4 @@\n UNO\n due\n-tre\n+TRE\n quattro\n",
+			want:    "uno\ndue\nTRE\nquattro\n",
+			note:    "fuzz 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patches, err := Parse(tt.patch)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			got, notes, err := patches[0].Apply(tt.content)
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("Apply = %q, atteso %q", got, tt.want)
+			}
+			if joined := strings.Join(notes, "; "); !strings.Contains(joined, tt.note) {
+				t.Fatalf("note = %q, attesa una nota con %q", joined, tt.note)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+	}{
+		{"nessuna patch", "Non ci sono modifiche da fare.\n"},
+		{"hunk senza intestazione", "@@ -1 +1 @@\n-a\n+b\n"},
+		{"file senza modifiche", "--- a/f.txt\n+++ b/f.txt\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.patch); err == nil {
+				t.Fatalf("Parse(%q) non ha restituito errori", tt.patch)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"isy-cli/internal/project"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// File è un file diverso tra due directory
+type File struct {
+	Path      string // Relativo alle directory confrontate, con separatori "/"
+	OldPath   string // Percorso precedente, se il file è stato rinominato
+	Old       string
+	New       string
+	OldExists bool
+	NewExists bool
+	Binary    bool
+}
+
+// Status descrive la modifica: "added", "deleted" oppure "modified"
+func (f File) Status() string {
+	switch {
+	case !f.OldExists:
+		return "added"
+	case !f.NewExists:
+		return "deleted"
+	case f.OldPath != "":
+		return "renamed"
+	default:
+		return "modified"
+	}
+}
+
+// Unified restituisce il file nel formato unified diff, con i prefissi a/ e b/ di git
+func (f File) Unified(context int) string {
+	oldName, newName := "a/"+f.Path, "b/"+f.Path
+	if f.OldPath != "" {
+		oldName = "a/" + f.OldPath
+	}
+	if !f.OldExists {
+		oldName = "/dev/null"
+	}
+	if !f.NewExists {
+		newName = "/dev/null"
+	}
+	if f.Binary {
+		return fmt.Sprintf("Binary files %s and %s differ\n", oldName, newName)
+	}
+	return Unified(oldName, newName, f.Old, f.New, context)
+}
+
+// Trees confronta due directory (ignorando .isy) e restituisce i file aggiunti,
+// rimossi o modificati nella seconda, ordinati per percorso
+func Trees(oldRoot, newRoot string) ([]File, error) {
+	oldFiles, err := readTree(oldRoot)
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := readTree(newRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]bool)
+	for path := range oldFiles {
+		paths[path] = true
+	}
+	for path := range newFiles {
+		paths[path] = true
+	}
+
+	var files []File
+	for path := range paths {
+		oldContent, oldExists := oldFiles[path]
+		newContent, newExists := newFiles[path]
+		if oldExists && newExists && bytes.Equal(oldContent, newContent) {
+			continue
+		}
+		files = append(files, File{
+			Path:      path,
+			Old:       string(oldContent),
+			New:       string(newContent),
+			OldExists: oldExists,
+			NewExists: newExists,
+			Binary:    isBinary(oldContent) || isBinary(newContent),
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return detectRenames(files), nil
+}
+
+// detectRenames unisce un file rimosso e uno aggiunto con lo stesso contenuto
+// in un unico file rinominato
+func detectRenames(files []File) []File {
+	deleted := make(map[string]int)
+	for i, file := range files {
+		if file.Status() == "deleted" && file.Old != "" {
+			if _, found := deleted[file.Old]; !found {
+				deleted[file.Old] = i
+			}
+		}
+	}
+
+	renamed := make(map[int]bool)
+	for i, file := range files {
+		if file.Status() != "added" || file.New == "" {
+			continue
+		}
+		j, found := deleted[file.New]
+		if !found {
+			continue
+		}
+		delete(deleted, file.New)
+		renamed[j] = true
+		files[i].OldPath = files[j].Path
+		files[i].Old = files[j].Old
+		files[i].OldExists = true
+	}
+
+	result := files[:0]
+	for i, file := range files {
+		if !renamed[i] {
+			result = append(result, file)
+		}
+	}
+	return result
+}
+
+func readTree(root string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != root && project.SkippedDir(entry.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = content
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("errore durante la lettura di %s: %v", root, err)
+	}
+	return files, nil
+}
+
+// isBinary considera binario un contenuto con byte nulli nei primi 8KB, come git
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0
+}
+
+// Stat riassume le righe aggiunte e rimosse, es. "+12 -3"
+func (f File) Stat() string {
+	if f.Binary {
+		return "binary"
+	}
+	a, _ := SplitLines(f.Old)
+	b, _ := SplitLines(f.New)
+	added, removed := 0, 0
+	for _, op := range Lines(a, b) {
+		switch op.Kind {
+		case Insert:
+			added++
+		case Delete:
+			removed++
+		}
+	}
+	return fmt.Sprintf("+%d -%d", added, removed)
+}
+
+// Summary descrive un elenco di file modificati, una riga per file
+func Summary(files []File) string {
+	var builder strings.Builder
+	for _, file := range files {
+		path := file.Path
+		if file.OldPath != "" {
+			path = file.OldPath + " -> " + file.Path
+		}
+		builder.WriteString(fmt.Sprintf("  %-8s %-10s %s\n", file.Status(), file.Stat(), path))
+	}
+	return builder.String()
+}
+
+// Patch restituisce le differenze come una patch nel formato di git, con le
+// intestazioni dei file creati, rimossi e rinominati: si applica con
+// "git apply" o "patch -p1", e il modello può rispondere nello stesso formato
+func Patch(files []File, context int) string {
+	var builder strings.Builder
+	for _, file := range files {
+		oldPath := file.Path
+		if file.OldPath != "" {
+			oldPath = file.OldPath
+		}
+		builder.WriteString(fmt.Sprintf("diff --git a/%s b/%s\n", oldPath, file.Path))
+		switch file.Status() {
+		case "added":
+			builder.WriteString("new file mode 100644\n")
+		case "deleted":
+			builder.WriteString("deleted file mode 100644\n")
+		case "renamed":
+			// Le rinomine vengono riconosciute solo a contenuto invariato
+			builder.WriteString(fmt.Sprintf("similarity index 100%%\nrename from %s\nrename to %s\n", file.OldPath, file.Path))
+			continue
+		}
+		builder.WriteString(file.Unified(context))
+	}
+	return builder.String()
+}
@@ -0,0 +1,90 @@
+package embeddings
+
+import (
+	"fmt"
+	"isy-cli/internal/config"
+	"isy-cli/internal/redact"
+	"math"
+)
+
+const (
+	DefaultDimensions = 256
+	DefaultTopK       = 8
+	DefaultChunkLines = 40
+	DefaultModel      = "text-embedding-3-small"
+)
+
+// Embedder trasforma testi in vettori confrontabili tramite similarità coseno
+type Embedder interface {
+	// Embed restituisce un vettore per ogni testo, nello stesso ordine
+	Embed(texts []string) ([][]float32, error)
+	// Name identifica il modello, così da invalidare i vettori se cambia
+	Name() string
+}
+
+// New costruisce l'Embedder indicato nella configurazione
+func New(cfg *config.Config) (Embedder, error) {
+	embCfg := cfg.Embeddings
+
+	switch embCfg.Provider {
+	case "", "openai":
+		apiKey := embCfg.APIKey
+		if apiKey == "" {
+			apiKey = cfg.APIKey
+		}
+		apiKey, err := cfg.ResolveSecret(apiKey)
+		if err != nil {
+			return nil, err
+		}
+		model := embCfg.Model
+		if model == "" {
+			model = DefaultModel
+		}
+		redactor, err := redact.New(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return NewOpenAIEmbedder(embCfg.BaseURL, apiKey, model, redactor), nil
+	case "hash":
+		dims := embCfg.Dimensions
+		if dims <= 0 {
+			dims = DefaultDimensions
+		}
+		return NewHashEmbedder(dims), nil
+	default:
+		return nil, fmt.Errorf("provider di embedding sconosciuto: %s", embCfg.Provider)
+	}
+}
+
+// CosineSimilarity calcola la similarità coseno tra due vettori
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+func normalize(vec []float32) []float32 {
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		return vec
+	}
+	norm = math.Sqrt(norm)
+	for i := range vec {
+		vec[i] = float32(float64(vec[i]) / norm)
+	}
+	return vec
+}
@@ -0,0 +1,88 @@
+package embeddings
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+// HashEmbedder è un embedder deterministico basato sul feature hashing dei token.
+// Non richiede rete: serve per i test offline e come fallback locale.
+type HashEmbedder struct {
+	Dimensions int
+}
+
+func NewHashEmbedder(dimensions int) *HashEmbedder {
+	return &HashEmbedder{Dimensions: dimensions}
+}
+
+func (h *HashEmbedder) Name() string {
+	return fmt.Sprintf("hash-%d", h.Dimensions)
+}
+
+func (h *HashEmbedder) Embed(texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = h.embedOne(text)
+	}
+	return vectors, nil
+}
+
+func (h *HashEmbedder) embedOne(text string) []float32 {
+	vec := make([]float32, h.Dimensions)
+	tokens := tokenize(text)
+
+	for i, token := range tokens {
+		addFeature(vec, token, 1)
+		// I bigrammi catturano un minimo di ordine tra i token
+		if i > 0 {
+			addFeature(vec, tokens[i-1]+" "+token, 0.5)
+		}
+	}
+
+	return normalize(vec)
+}
+
+func addFeature(vec []float32, feature string, weight float32) {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(feature))
+	sum := hasher.Sum64()
+
+	index := int(sum % uint64(len(vec)))
+	// Il bit più alto decide il segno, riducendo l'effetto delle collisioni
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	vec[index] += weight
+}
+
+// tokenize divide il testo in parole minuscole, spezzando anche camelCase e snake_case
+func tokenize(text string) []string {
+	var tokens []string
+	var current []rune
+
+	flush := func() {
+		if len(current) > 1 {
+			tokens = append(tokens, strings.ToLower(string(current)))
+		}
+		current = current[:0]
+	}
+
+	var prev rune
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if unicode.IsUpper(r) && unicode.IsLower(prev) {
+				flush()
+			}
+			current = append(current, r)
+		default:
+			flush()
+		}
+		prev = r
+	}
+	flush()
+
+	return tokens
+}
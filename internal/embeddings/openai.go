@@ -0,0 +1,79 @@
+package embeddings
+
+import (
+	"context"
+	"fmt"
+	"isy-cli/internal/redact"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// Numero massimo di testi inviati in una singola richiesta
+const openAIBatchSize = 64
+
+// OpenAIEmbedder usa un endpoint /embeddings compatibile con OpenAI
+type OpenAIEmbedder struct {
+	BaseURL  string
+	APIKey   string
+	Model    string
+	Redactor *redact.Redactor // Rimuove i segreti dai testi inviati (nil = nessuna redazione)
+}
+
+func NewOpenAIEmbedder(baseURL, apiKey, model string, redactor *redact.Redactor) *OpenAIEmbedder {
+	return &OpenAIEmbedder{BaseURL: baseURL, APIKey: apiKey, Model: model, Redactor: redactor}
+}
+
+func (o *OpenAIEmbedder) Name() string {
+	return o.Model
+}
+
+func (o *OpenAIEmbedder) Embed(texts []string) ([][]float32, error) {
+	opts := []option.RequestOption{option.WithAPIKey(o.APIKey)}
+	if o.BaseURL != "" {
+		opts = append(opts, option.WithBaseURL(o.BaseURL))
+	}
+	client := openai.NewClient(opts...)
+
+	// I testi lasciano la macchina: i segreti vengono sostituiti prima dell'invio
+	if o.Redactor != nil {
+		redacted := make([]string, len(texts))
+		for i, text := range texts {
+			redacted[i] = o.Redactor.Redact(text)
+		}
+		texts = redacted
+		o.Redactor.Report("embeddings")
+	}
+
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += openAIBatchSize {
+		end := min(start+openAIBatchSize, len(texts))
+		batch := texts[start:end]
+
+		response, err := client.Embeddings.New(context.Background(), openai.EmbeddingNewParams{
+			Input: openai.F[openai.EmbeddingNewParamsInputUnion](openai.EmbeddingNewParamsInputArrayOfStrings(batch)),
+			Model: openai.F(o.Model),
+		}, option.WithMaxRetries(5))
+		if err != nil {
+			return nil, fmt.Errorf("errore durante la richiesta di embedding: %v", err)
+		}
+		if len(response.Data) != len(batch) {
+			return nil, fmt.Errorf("l'endpoint ha restituito %d embedding invece di %d", len(response.Data), len(batch))
+		}
+
+		batchVectors := make([][]float32, len(batch))
+		for _, item := range response.Data {
+			if item.Index < 0 || int(item.Index) >= len(batch) {
+				return nil, fmt.Errorf("indice di embedding non valido: %d", item.Index)
+			}
+			vec := make([]float32, len(item.Embedding))
+			for i, v := range item.Embedding {
+				vec[i] = float32(v)
+			}
+			batchVectors[item.Index] = vec
+		}
+		vectors = append(vectors, batchVectors...)
+	}
+
+	return vectors, nil
+}
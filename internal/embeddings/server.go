@@ -0,0 +1,77 @@
+package embeddings
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type embeddingRequest struct {
+	Input json.RawMessage `json:"input"`
+	Model string          `json:"model"`
+}
+
+type embeddingData struct {
+	Object    string    `json:"object"`
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+type embeddingResponse struct {
+	Object string          `json:"object"`
+	Data   []embeddingData `json:"data"`
+	Model  string          `json:"model"`
+	Usage  struct {
+		PromptTokens int `json:"prompt_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// NewServer espone un Embedder tramite un endpoint compatibile con OpenAI.
+// Serve come sostituto locale dell'API per provare l'intero flusso offline.
+func NewServer(embedder Embedder) http.Handler {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "metodo non supportato", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var request embeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, fmt.Sprintf("richiesta non valida: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		// L'input può essere una stringa singola o una lista di stringhe
+		var texts []string
+		if err := json.Unmarshal(request.Input, &texts); err != nil {
+			var single string
+			if err := json.Unmarshal(request.Input, &single); err != nil {
+				http.Error(w, "input deve essere una stringa o una lista di stringhe", http.StatusBadRequest)
+				return
+			}
+			texts = []string{single}
+		}
+
+		vectors, err := embedder.Embed(texts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := embeddingResponse{Object: "list", Model: request.Model}
+		for i, vec := range vectors {
+			response.Data = append(response.Data, embeddingData{Object: "embedding", Index: i, Embedding: vec})
+			response.Usage.PromptTokens += len(tokenize(texts[i]))
+		}
+		response.Usage.TotalTokens = response.Usage.PromptTokens
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/embeddings", handler)
+	mux.HandleFunc("/embeddings", handler)
+	return mux
+}
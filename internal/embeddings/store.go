@@ -0,0 +1,168 @@
+package embeddings
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"isy-cli/internal/project"
+	"os"
+	"sort"
+	"strings"
+)
+
+const storeFile = "embeddings.json"
+
+// Chunk è una porzione di file con il relativo vettore
+type Chunk struct {
+	Path      string    `json:"path"`
+	StartLine int       `json:"start_line"`
+	EndLine   int       `json:"end_line"`
+	Hash      string    `json:"hash"`
+	Vector    []float32 `json:"vector"`
+	Text      string    `json:"-"`
+}
+
+// Store è l'archivio vettoriale locale salvato in .isy
+type Store struct {
+	Model  string  `json:"model"`
+	Chunks []Chunk `json:"chunks"`
+}
+
+// SearchResult è un chunk restituito da una ricerca, con il punteggio di similarità
+type SearchResult struct {
+	Chunk
+	Score float64
+}
+
+// IndexStats riassume un aggiornamento dell'indice
+type IndexStats struct {
+	Files    int
+	Chunks   int
+	Embedded int
+	Reused   int
+}
+
+// LoadStore legge l'archivio da disco; se non esiste ne restituisce uno vuoto
+func LoadStore() (*Store, error) {
+	store := &Store{}
+	data, err := os.ReadFile(project.StatePath(storeFile))
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore durante la lettura dell'archivio degli embedding: %v", err)
+	}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("errore durante il parsing dell'archivio degli embedding: %v", err)
+	}
+	return store, nil
+}
+
+// Save scrive l'archivio su disco
+func (s *Store) Save() error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("errore durante la serializzazione dell'archivio degli embedding: %v", err)
+	}
+	return os.WriteFile(project.StatePath(storeFile), data, 0644)
+}
+
+// Update sostituisce i chunk dell'archivio con quelli passati. I vettori dei chunk
+// con lo stesso hash di contenuto vengono riutilizzati, gli altri ricalcolati.
+func (s *Store) Update(embedder Embedder, chunks []Chunk) (IndexStats, error) {
+	stats := IndexStats{Chunks: len(chunks)}
+
+	// Se il modello è cambiato i vettori esistenti non sono confrontabili
+	known := make(map[string][]float32)
+	if s.Model == embedder.Name() {
+		for _, chunk := range s.Chunks {
+			known[chunk.Hash] = chunk.Vector
+		}
+	}
+
+	files := make(map[string]bool)
+	var pending []int
+	for i := range chunks {
+		files[chunks[i].Path] = true
+		if vec, ok := known[chunks[i].Hash]; ok {
+			chunks[i].Vector = vec
+			stats.Reused++
+			continue
+		}
+		pending = append(pending, i)
+	}
+	stats.Files = len(files)
+
+	if len(pending) > 0 {
+		texts := make([]string, len(pending))
+		for i, index := range pending {
+			texts[i] = chunks[index].Text
+		}
+		vectors, err := embedder.Embed(texts)
+		if err != nil {
+			return stats, err
+		}
+		if len(vectors) != len(pending) {
+			return stats, fmt.Errorf("l'embedder %s ha restituito %d vettori invece di %d", embedder.Name(), len(vectors), len(pending))
+		}
+		for i, index := range pending {
+			chunks[index].Vector = vectors[i]
+		}
+		stats.Embedded = len(pending)
+	}
+
+	s.Model = embedder.Name()
+	s.Chunks = chunks
+	return stats, nil
+}
+
+// Search restituisce i k chunk più vicini al vettore della query
+func (s *Store) Search(query []float32, k int) []SearchResult {
+	results := make([]SearchResult, 0, len(s.Chunks))
+	for _, chunk := range s.Chunks {
+		results = append(results, SearchResult{Chunk: chunk, Score: CosineSimilarity(query, chunk.Vector)})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if k > 0 && len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// ChunkFile divide il contenuto di un file in chunk di chunkLines righe.
+// I chunk si sovrappongono per un quarto, così una funzione a cavallo
+// di due chunk resta recuperabile.
+func ChunkFile(path string, content string, chunkLines int) []Chunk {
+	if chunkLines <= 0 {
+		chunkLines = DefaultChunkLines
+	}
+	lines := strings.Split(content, "\n")
+	step := max(chunkLines-chunkLines/4, 1)
+
+	var chunks []Chunk
+	for start := 0; start < len(lines); start += step {
+		end := min(start+chunkLines, len(lines))
+		text := strings.Join(lines[start:end], "\n")
+		if strings.TrimSpace(text) != "" {
+			// Il percorso fa parte del testo embeddato: aiuta a trovare i file per nome
+			embedText := fmt.Sprintf("%s\n%s", path, text)
+			sum := sha256.Sum256([]byte(embedText))
+			chunks = append(chunks, Chunk{
+				Path:      path,
+				StartLine: start + 1,
+				EndLine:   end,
+				Hash:      hex.EncodeToString(sum[:]),
+				Text:      embedText,
+			})
+		}
+		if end == len(lines) {
+			break
+		}
+	}
+	return chunks
+}
@@ -0,0 +1,149 @@
+package embeddings
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// countingEmbedder conta i testi che gli vengono chiesti
+type countingEmbedder struct {
+	Embedder
+	mu    sync.Mutex
+	texts []string
+}
+
+func (c *countingEmbedder) Embed(texts []string) ([][]float32, error) {
+	c.mu.Lock()
+	c.texts = append(c.texts, texts...)
+	c.mu.Unlock()
+	return c.Embedder.Embed(texts)
+}
+
+func (c *countingEmbedder) take() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	texts := c.texts
+	c.texts = nil
+	return texts
+}
+
+// shortEmbedder restituisce un vettore in meno di quelli richiesti
+type shortEmbedder struct{ HashEmbedder }
+
+func (s *shortEmbedder) Embed(texts []string) ([][]float32, error) {
+	vectors, _ := s.HashEmbedder.Embed(texts)
+	return vectors[:len(vectors)-1], nil
+}
+
+func chunksOf(files map[string]string) []Chunk {
+	var chunks []Chunk
+	for _, path := range []string{"a.go", "b.go", "c.go"} {
+		if content, ok := files[path]; ok {
+			chunks = append(chunks, ChunkFile(path, content, 4)...)
+		}
+	}
+	return chunks
+}
+
+func TestUpdateThroughServer(t *testing.T) {
+	backend := &countingEmbedder{Embedder: NewHashEmbedder(64)}
+	server := httptest.NewServer(NewServer(backend))
+	defer server.Close()
+	embedder := NewOpenAIEmbedder(server.URL+"/v1/", "test", "test-model", nil)
+
+	files := map[string]string{
+		"a.go": "package a\n\nfunc Parse() {}\n",
+		"b.go": "package b\n\nfunc Format() {}\n",
+	}
+	store := &Store{}
+	stats, err := store.Update(embedder, chunksOf(files))
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if stats.Embedded != 2 || stats.Reused != 0 || stats.Files != 2 {
+		t.Fatalf("primo Update = %+v, attesi 2 chunk calcolati su 2 file", stats)
+	}
+	if got := len(backend.take()); got != 2 {
+		t.Fatalf("il server ha ricevuto %d testi, attesi 2", got)
+	}
+	for _, chunk := range store.Chunks {
+		if len(chunk.Vector) != 64 {
+			t.Fatalf("%s: vettore di %d dimensioni, attese 64", chunk.Path, len(chunk.Vector))
+		}
+	}
+
+	// Cambia b.go e si aggiunge c.go: a.go resta com'è
+	files["b.go"] = "package b\n\nfunc Format(x int) {}\n"
+	files["c.go"] = "package c\n"
+	stats, err = store.Update(embedder, chunksOf(files))
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if stats.Embedded != 2 || stats.Reused != 1 || stats.Chunks != 3 {
+		t.Fatalf("secondo Update = %+v, attesi 2 chunk calcolati e 1 riutilizzato", stats)
+	}
+	sent := backend.take()
+	if len(sent) != 2 || !strings.HasPrefix(sent[0], "b.go\n") || !strings.HasPrefix(sent[1], "c.go\n") {
+		t.Fatalf("testi inviati = %q, attesi solo b.go e c.go", sent)
+	}
+
+	// Con un altro modello i vettori non sono confrontabili e si ricalcola tutto
+	other := NewOpenAIEmbedder(server.URL+"/v1/", "test", "other-model", nil)
+	stats, err = store.Update(other, chunksOf(files))
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if stats.Embedded != 3 || stats.Reused != 0 {
+		t.Fatalf("Update con un altro modello = %+v, attesi 3 chunk calcolati", stats)
+	}
+}
+
+func TestUpdateMissingVectors(t *testing.T) {
+	store := &Store{}
+	chunks := chunksOf(map[string]string{"a.go": "package a\n", "b.go": "package b\n"})
+	if _, err := store.Update(&shortEmbedder{HashEmbedder{Dimensions: 16}}, chunks); err == nil {
+		t.Fatal("Update non ha segnalato i vettori mancanti")
+	}
+	if len(store.Chunks) != 0 {
+		t.Fatalf("l'archivio è stato aggiornato con %d chunk nonostante l'errore", len(store.Chunks))
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	embedder := NewHashEmbedder(DefaultDimensions)
+	files := map[string]string{
+		"a.go": "func ParseConfig(path string) (*Config, error) {\n\treturn loadConfig(path)\n}\n",
+		"b.go": "func RenderTemplate(name string) string {\n\treturn templates[name]\n}\n",
+		"c.go": "func OpenDatabase(url string) (*DB, error) {\n\treturn connect(url)\n}\n",
+	}
+	store := &Store{}
+	if _, err := store.Update(embedder, chunksOf(files)); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"parse config", "a.go"},
+		{"render template name", "b.go"},
+		{"open database connect", "c.go"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			vectors, _ := embedder.Embed([]string{tt.query})
+			results := store.Search(vectors[0], 2)
+			if len(results) != 2 {
+				t.Fatalf("Search: %d risultati, attesi 2", len(results))
+			}
+			if results[0].Path != tt.want {
+				t.Fatalf("primo risultato = %s, atteso %s", results[0].Path, tt.want)
+			}
+			if results[0].Score < results[1].Score {
+				t.Fatalf("risultati non ordinati: %.3f < %.3f", results[0].Score, results[1].Score)
+			}
+		})
+	}
+}
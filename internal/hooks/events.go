@@ -0,0 +1,42 @@
+package hooks
+
+import "isy-cli/internal/openai/schemas/code"
+
+// ContextData sono i dati di before_context: l'hook può cambiare profilo e modalità
+type ContextData struct {
+	Profile string `json:"profile"`
+	Mode    string `json:"mode"`
+}
+
+// RequestData sono i dati di before_request: l'hook può riscrivere la richiesta
+type RequestData struct {
+	Prompt string `json:"prompt"`
+}
+
+// ResponseData sono i dati di after_response: l'hook può riscrivere la risposta
+// del modello prima che venga letta
+type ResponseData struct {
+	Model    string `json:"model"`
+	Response string `json:"response"`
+}
+
+// ApplyData sono i dati di before_apply: l'hook può cambiare le modifiche, che
+// vengono controllate di nuovo prima di applicarle
+type ApplyData struct {
+	Branch   string                        `json:"branch"`
+	Files    []string                      `json:"files"`
+	Response code.CodeModificationResponse `json:"response"`
+}
+
+// AppliedData sono i dati di after_apply: se l'hook blocca l'operazione le
+// modifiche vengono annullate
+type AppliedData struct {
+	Branch string   `json:"branch"`
+	Files  []string `json:"files"`
+	Notes  []string `json:"notes,omitempty"`
+}
+
+// RunData sono i dati di after_run, che non si possono modificare
+type RunData struct {
+	Args []string `json:"args"`
+}
@@ -0,0 +1,251 @@
+package hooks
+
+import (
+	"bytes"
+	gocontext "context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"isy-cli/internal/config"
+	"isy-cli/internal/project"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Event è un punto di estensione in cui vengono eseguiti gli hook
+type Event string
+
+const (
+	BeforeContext Event = "before_context"
+	BeforeRequest Event = "before_request"
+	AfterResponse Event = "after_response"
+	BeforeApply   Event = "before_apply"
+	AfterApply    Event = "after_apply"
+	AfterRun      Event = "after_run"
+)
+
+const (
+	DefaultTimeout = 30 // Secondi per ogni hook
+	vetoExitCode   = 2  // Codice di uscita con cui un hook blocca l'operazione
+	maxStderrChars = 2000
+)
+
+// Payload è il JSON che un hook riceve su stdin
+type Payload struct {
+	Event   Event       `json:"event"`
+	Command string      `json:"command"` // Comando di isy in esecuzione, es. code
+	Root    string      `json:"root"`    // Radice del progetto
+	Data    interface{} `json:"data"`    // Dati dell'operazione, diversi per ogni evento
+}
+
+// Reply è il JSON che un hook può scrivere su stdout. Tutti i campi sono facoltativi.
+type Reply struct {
+	Data    json.RawMessage `json:"data"`    // Campi di data da sostituire
+	Veto    bool            `json:"veto"`    // Blocca l'operazione
+	Reason  string          `json:"reason"`  // Motivo del blocco
+	Message string          `json:"message"` // Messaggio da mostrare all'utente
+}
+
+// VetoError indica che un hook ha bloccato l'operazione
+type VetoError struct {
+	Event  Event
+	Hook   string
+	Reason string
+}
+
+func (e *VetoError) Error() string {
+	return fmt.Sprintf("operazione bloccata dall'hook %s (%s): %s", e.Hook, e.Event, e.Reason)
+}
+
+// Runner esegue gli hook configurati per un comando di isy. Un Runner nil non
+// esegue nulla.
+type Runner struct {
+	cfg     config.HooksConfig
+	command string
+	out     io.Writer // Messaggi degli hook e avvisi sugli hook falliti
+}
+
+// New crea un Runner per il comando indicato, es. "code"
+func New(cfg config.HooksConfig, command string, out io.Writer) *Runner {
+	return &Runner{cfg: cfg, command: command, out: out}
+}
+
+// Load crea un Runner dalla configurazione del progetto
+func Load(command string, out io.Writer) (*Runner, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("errore durante il caricamento della configurazione: %v", err)
+	}
+	return New(cfg.Hooks, command, out), nil
+}
+
+// hooksFor restituisce gli hook configurati per un evento
+func (r *Runner) hooksFor(event Event) []config.HookConfig {
+	switch event {
+	case BeforeContext:
+		return r.cfg.BeforeContext
+	case BeforeRequest:
+		return r.cfg.BeforeRequest
+	case AfterResponse:
+		return r.cfg.AfterResponse
+	case BeforeApply:
+		return r.cfg.BeforeApply
+	case AfterApply:
+		return r.cfg.AfterApply
+	case AfterRun:
+		return r.cfg.AfterRun
+	}
+	return nil
+}
+
+// Run esegue in ordine gli hook di un evento. data è un puntatore ai dati
+// dell'operazione: ogni hook li riceve con le modifiche dei precedenti e può
+// sostituirne dei campi. Restituisce un *VetoError se un hook blocca
+// l'operazione. Un hook che fallisce (timeout, codice di uscita inatteso,
+// risposta non valida) viene ignorato con un avviso, a meno che sia required.
+func (r *Runner) Run(event Event, data interface{}) error {
+	if r == nil {
+		return nil
+	}
+	for _, hook := range r.hooksFor(event) {
+		if len(hook.Commands) > 0 && !contains(hook.Commands, r.command) {
+			continue
+		}
+		err := r.runHook(event, hook, data)
+		var veto *VetoError
+		switch {
+		case err == nil:
+		case errors.As(err, &veto):
+			return err
+		case hook.Required:
+			return fmt.Errorf("hook %s (%s) non riuscito: %v", hookName(hook), event, err)
+		default:
+			fmt.Fprintf(r.out, "Hook %s (%s) ignorato: %v\n", hookName(hook), event, err)
+		}
+	}
+	return nil
+}
+
+func (r *Runner) runHook(event Event, hook config.HookConfig, data interface{}) error {
+	if strings.TrimSpace(hook.Command) == "" {
+		return fmt.Errorf("l'hook non ha un comando")
+	}
+	input, err := json.Marshal(Payload{Event: event, Command: r.command, Root: project.Root(), Data: data})
+	if err != nil {
+		return fmt.Errorf("errore durante la serializzazione dei dati: %v", err)
+	}
+
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = r.cfg.Timeout
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	command := exec.CommandContext(ctx, "sh", "-c", hook.Command)
+	command.Dir = project.Root()
+	command.Env = append(os.Environ(), "ISY_HOOK_EVENT="+string(event), "ISY_COMMAND="+r.command)
+	command.Stdin = bytes.NewReader(input)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	command.WaitDelay = 2 * time.Second
+	err = command.Run()
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		return fmt.Errorf("interrotto dopo %d secondi", timeout)
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == vetoExitCode:
+		reason := strings.TrimSpace(stdout.String())
+		if reason == "" {
+			reason = strings.TrimSpace(stderr.String())
+		}
+		if reason == "" {
+			reason = "nessun motivo indicato"
+		}
+		return &VetoError{Event: event, Hook: hookName(hook), Reason: reason}
+	case err != nil:
+		return fmt.Errorf("%v%s", err, stderrTail(stderr.String()))
+	}
+
+	output := bytes.TrimSpace(stdout.Bytes())
+	if len(output) == 0 {
+		return nil
+	}
+	var reply Reply
+	if err := json.Unmarshal(output, &reply); err != nil {
+		return fmt.Errorf("la risposta su stdout non è un JSON valido: %v", err)
+	}
+	if reply.Message != "" {
+		fmt.Fprintf(r.out, "[%s] %s\n", hookName(hook), reply.Message)
+	}
+	if reply.Veto {
+		reason := reply.Reason
+		if reason == "" {
+			reason = "nessun motivo indicato"
+		}
+		return &VetoError{Event: event, Hook: hookName(hook), Reason: reason}
+	}
+	if len(reply.Data) > 0 && string(reply.Data) != "null" && data != nil {
+		return replaceData(data, reply.Data)
+	}
+	return nil
+}
+
+// replaceData sostituisce in data i campi indicati dall'hook. Le modifiche
+// vengono decodificate su una copia: una risposta non valida non cambia nulla.
+func replaceData(data interface{}, changes json.RawMessage) error {
+	target := reflect.ValueOf(data)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return fmt.Errorf("i dati di questo evento non si possono modificare")
+	}
+	current, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("errore durante la serializzazione dei dati: %v", err)
+	}
+	updated := reflect.New(target.Elem().Type())
+	if err := json.Unmarshal(current, updated.Interface()); err != nil {
+		return fmt.Errorf("errore durante la copia dei dati: %v", err)
+	}
+	if err := json.Unmarshal(changes, updated.Interface()); err != nil {
+		return fmt.Errorf("data non valido nella risposta: %v", err)
+	}
+	target.Elem().Set(updated.Elem())
+	return nil
+}
+
+func hookName(hook config.HookConfig) string {
+	if hook.Name != "" {
+		return hook.Name
+	}
+	return strings.Fields(hook.Command + " ?")[0]
+}
+
+// stderrTail restituisce la parte finale dello stderr di un hook fallito
+func stderrTail(stderr string) string {
+	stderr = strings.TrimSpace(stderr)
+	if stderr == "" {
+		return ""
+	}
+	if len(stderr) > maxStderrChars {
+		stderr = "..." + stderr[len(stderr)-maxStderrChars:]
+	}
+	return ": " + stderr
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
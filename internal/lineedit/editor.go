@@ -0,0 +1,166 @@
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	continuationPrompt = "... "
+	blockDelimiter     = `"""` // Apre e chiude un blocco di più righe
+)
+
+// ErrInterrupted indica che l'utente ha annullato la riga con Ctrl+C
+var ErrInterrupted = errors.New("input annullato")
+
+// Editor legge l'input dell'utente. Su un terminale offre la modifica della
+// riga, la cronologia e l'incolla di più righe; altrimenti legge riga per riga.
+// In entrambi i casi una riga che termina con "\" continua sulla successiva e
+// le righe tra due """ formano un unico messaggio.
+type Editor struct {
+	history  *History
+	terminal bool
+	reader   *bufio.Reader
+}
+
+// New crea un editor che salva la cronologia nel file indicato ("" = nessun file)
+func New(historyPath string) *Editor {
+	return &Editor{
+		history:  LoadHistory(historyPath),
+		terminal: isTerminal(os.Stdin),
+		reader:   bufio.NewReader(os.Stdin),
+	}
+}
+
+// ReadInput legge un messaggio completo, eventualmente su più righe.
+// Restituisce io.EOF con Ctrl+D su una riga vuota o alla fine dell'input.
+func (e *Editor) ReadInput(prompt string) (string, error) {
+	var lines []string
+	inBlock := false
+	currentPrompt := prompt
+
+	for {
+		line, err := e.readLine(currentPrompt)
+		if err != nil {
+			// Alla fine di un input rediretto consegna quanto letto finora
+			if err == io.EOF && len(lines) > 0 && !e.terminal {
+				return strings.Join(lines, "\n"), nil
+			}
+			return "", err
+		}
+		currentPrompt = continuationPrompt
+
+		switch {
+		case inBlock && strings.TrimSpace(line) == blockDelimiter:
+			return e.remember(strings.Join(lines, "\n")), nil
+		case inBlock:
+			lines = append(lines, line)
+		case len(lines) == 0 && strings.TrimSpace(line) == blockDelimiter:
+			inBlock = true
+		case strings.HasSuffix(line, `\`):
+			lines = append(lines, strings.TrimSuffix(line, `\`))
+		default:
+			lines = append(lines, line)
+			return e.remember(strings.Join(lines, "\n")), nil
+		}
+	}
+}
+
+// Confirm chiede una conferma sì/no; qualunque risposta diversa da "s", "si"
+// o "y" (o la fine dell'input) vale come no. La risposta non entra nella cronologia.
+func (e *Editor) Confirm(question string) bool {
+	answer, err := e.readLine(question + " [s/N] ")
+	if err != nil {
+		if !e.terminal {
+			fmt.Println()
+		}
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "s", "si", "sì", "y", "yes":
+		return true
+	}
+	return false
+}
+
+func (e *Editor) remember(input string) string {
+	if strings.TrimSpace(input) != "" {
+		e.history.Add(input)
+	}
+	return input
+}
+
+// readLine legge una riga (che può contenere a capo incollati) senza terminatore
+func (e *Editor) readLine(prompt string) (string, error) {
+	if !e.terminal {
+		fmt.Print(prompt)
+		line, err := e.reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	restore, err := enableRawMode()
+	if err != nil {
+		// Senza stty si ripiega sulla lettura semplice
+		e.terminal = false
+		return e.readLine(prompt)
+	}
+	defer restore()
+
+	state := newLineState(prompt, terminalWidth(), e.history)
+	state.refresh()
+	return state.edit(e.reader)
+}
+
+// isTerminal indica se il file è un terminale interattivo
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// enableRawMode disattiva la modalità canonica, l'eco e i segnali del terminale
+// con stty e restituisce la funzione che ripristina lo stato precedente
+func enableRawMode() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("-icanon", "-echo", "-isig", "-ixon", "min", "1"); err != nil {
+		return nil, err
+	}
+	// Attiva il bracketed paste, per distinguere il testo incollato dai tasti
+	fmt.Print("\x1b[?2004h")
+	return func() {
+		fmt.Print("\x1b[?2004l")
+		_, _ = stty(strings.TrimSpace(saved))
+	}, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	output, err := cmd.Output()
+	return string(output), err
+}
+
+// terminalWidth restituisce il numero di colonne del terminale (80 se ignoto)
+func terminalWidth() int {
+	output, err := stty("size")
+	if err == nil {
+		fields := strings.Fields(output)
+		if len(fields) == 2 {
+			if cols, err := strconv.Atoi(fields[1]); err == nil && cols > 0 {
+				return cols
+			}
+		}
+	}
+	return 80
+}
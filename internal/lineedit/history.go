@@ -0,0 +1,89 @@
+package lineedit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const historyLimit = 1000 // Voci conservate nel file della cronologia
+
+// History è la cronologia degli input, salvata con una stringa JSON per riga
+// così che anche i messaggi su più righe occupino una sola riga del file
+type History struct {
+	path    string
+	entries []string
+}
+
+// LoadHistory carica la cronologia dal file indicato; se il file manca o non è
+// leggibile la cronologia parte vuota
+func LoadHistory(path string) *History {
+	history := &History{path: path}
+	if path == "" {
+		return history
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return history
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry string
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil && entry != "" {
+			history.entries = append(history.entries, entry)
+		}
+	}
+	history.trim()
+	return history
+}
+
+// Add aggiunge una voce (se diversa dall'ultima) e salva la cronologia
+func (h *History) Add(entry string) {
+	if len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry {
+		return
+	}
+	h.entries = append(h.entries, entry)
+	h.trim()
+	h.save()
+}
+
+// Len restituisce il numero di voci
+func (h *History) Len() int {
+	return len(h.entries)
+}
+
+// At restituisce la voce i-esima, dalla più vecchia
+func (h *History) At(i int) string {
+	return h.entries[i]
+}
+
+func (h *History) trim() {
+	if len(h.entries) > historyLimit {
+		h.entries = h.entries[len(h.entries)-historyLimit:]
+	}
+}
+
+// save riscrive il file; un errore non deve interrompere la sessione e viene ignorato
+func (h *History) save() {
+	if h.path == "" {
+		return
+	}
+	var builder strings.Builder
+	for _, entry := range h.entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			continue
+		}
+		builder.Write(data)
+		builder.WriteString("\n")
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return
+	}
+	_ = os.WriteFile(h.path, []byte(builder.String()), 0600)
+}
@@ -0,0 +1,306 @@
+package lineedit
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// Tasti di controllo gestiti dall'editor
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// lineState è la riga in modifica. La riga può contenere a capo incollati o
+// richiamati dalla cronologia: vengono mostrati come "↵" e il testo va a capo
+// sulle righe successive del terminale, come in linenoise.
+type lineState struct {
+	prompt  string
+	buf     []rune
+	pos     int
+	cols    int
+	oldRow  int // Riga del cursore rispetto all'inizio del prompt
+	history *History
+	index   int    // Voce della cronologia mostrata (Len() = riga nuova)
+	draft   []rune // Riga nuova, conservata mentre si scorre la cronologia
+	pasting bool
+}
+
+func newLineState(prompt string, cols int, history *History) *lineState {
+	return &lineState{prompt: prompt, cols: cols, history: history, index: history.Len()}
+}
+
+// edit legge i tasti fino a Invio e restituisce il testo della riga
+func (s *lineState) edit(reader *bufio.Reader) (string, error) {
+	for {
+		key, _, err := reader.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case '\r', '\n':
+			if s.pasting {
+				s.insert('\n')
+				continue
+			}
+			s.pos = len(s.buf)
+			s.refresh()
+			s.newline()
+			return string(s.buf), nil
+		case keyCtrlC:
+			s.pos = len(s.buf)
+			s.refresh()
+			fmt.Print("^C")
+			s.newline()
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(s.buf) == 0 {
+				fmt.Print("\n")
+				return "", io.EOF
+			}
+			s.deleteAt(s.pos)
+		case keyBackspace, keyCtrlH:
+			if s.pos > 0 {
+				s.pos--
+				s.deleteAt(s.pos)
+			}
+		case keyCtrlA:
+			s.moveTo(0)
+		case keyCtrlE:
+			s.moveTo(len(s.buf))
+		case keyCtrlB:
+			s.moveTo(s.pos - 1)
+		case keyCtrlF:
+			s.moveTo(s.pos + 1)
+		case keyCtrlK:
+			s.buf = s.buf[:s.pos]
+			s.refresh()
+		case keyCtrlU:
+			s.buf = append([]rune(nil), s.buf[s.pos:]...)
+			s.pos = 0
+			s.refresh()
+		case keyCtrlW:
+			start := s.wordStart()
+			s.buf = append(s.buf[:start], s.buf[s.pos:]...)
+			s.pos = start
+			s.refresh()
+		case keyCtrlL:
+			fmt.Print("\x1b[H\x1b[2J")
+			s.oldRow = 0
+			s.refresh()
+		case keyCtrlP:
+			s.recall(-1)
+		case keyCtrlN:
+			s.recall(1)
+		case keyTab:
+			s.insert('\t')
+		case keyEscape:
+			if err := s.escape(reader); err != nil {
+				return "", err
+			}
+		default:
+			if key >= ' ' {
+				s.insert(key)
+			}
+		}
+	}
+}
+
+// escape interpreta le sequenze dei tasti speciali (frecce, Home, Canc, incolla)
+func (s *lineState) escape(reader *bufio.Reader) error {
+	next, _, err := reader.ReadRune()
+	if err != nil {
+		return err
+	}
+
+	switch next {
+	case 'b':
+		s.moveTo(s.wordStart())
+		return nil
+	case 'f':
+		s.moveTo(s.wordEnd())
+		return nil
+	case 'O':
+		final, _, err := reader.ReadRune()
+		if err != nil {
+			return err
+		}
+		s.sequence(string(final))
+		return nil
+	case '[':
+		var sequence strings.Builder
+		for {
+			r, _, err := reader.ReadRune()
+			if err != nil {
+				return err
+			}
+			sequence.WriteRune(r)
+			if r >= 0x40 && r <= 0x7e {
+				break
+			}
+		}
+		s.sequence(sequence.String())
+	}
+	return nil
+}
+
+func (s *lineState) sequence(sequence string) {
+	switch sequence {
+	case "A":
+		s.recall(-1)
+	case "B":
+		s.recall(1)
+	case "C":
+		s.moveTo(s.pos + 1)
+	case "D":
+		s.moveTo(s.pos - 1)
+	case "H", "1~", "7~":
+		s.moveTo(0)
+	case "F", "4~", "8~":
+		s.moveTo(len(s.buf))
+	case "3~":
+		s.deleteAt(s.pos)
+	case "1;5C":
+		s.moveTo(s.wordEnd())
+	case "1;5D":
+		s.moveTo(s.wordStart())
+	case "200~":
+		s.pasting = true
+	case "201~":
+		s.pasting = false
+		s.refresh()
+	}
+}
+
+func (s *lineState) insert(r rune) {
+	s.buf = append(s.buf[:s.pos], append([]rune{r}, s.buf[s.pos:]...)...)
+	s.pos++
+	// Durante l'incolla la riga viene ridisegnata solo alla fine
+	if !s.pasting {
+		s.refresh()
+	}
+}
+
+func (s *lineState) deleteAt(pos int) {
+	if pos < 0 || pos >= len(s.buf) {
+		return
+	}
+	s.buf = append(s.buf[:pos], s.buf[pos+1:]...)
+	s.refresh()
+}
+
+func (s *lineState) moveTo(pos int) {
+	if pos < 0 || pos > len(s.buf) {
+		return
+	}
+	s.pos = pos
+	s.refresh()
+}
+
+// recall mostra la voce precedente (-1) o successiva (+1) della cronologia
+func (s *lineState) recall(direction int) {
+	index := s.index + direction
+	if index < 0 || index > s.history.Len() {
+		return
+	}
+	if s.index == s.history.Len() {
+		s.draft = append([]rune(nil), s.buf...)
+	}
+	s.index = index
+	if index == s.history.Len() {
+		s.buf = append([]rune(nil), s.draft...)
+	} else {
+		s.buf = []rune(s.history.At(index))
+	}
+	s.pos = len(s.buf)
+	s.refresh()
+}
+
+func (s *lineState) wordStart() int {
+	pos := s.pos
+	for pos > 0 && unicode.IsSpace(s.buf[pos-1]) {
+		pos--
+	}
+	for pos > 0 && !unicode.IsSpace(s.buf[pos-1]) {
+		pos--
+	}
+	return pos
+}
+
+func (s *lineState) wordEnd() int {
+	pos := s.pos
+	for pos < len(s.buf) && unicode.IsSpace(s.buf[pos]) {
+		pos++
+	}
+	for pos < len(s.buf) && !unicode.IsSpace(s.buf[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// newline porta il cursore all'inizio della riga sotto il testo, a meno che
+// refresh non ci sia già andato perché il testo finisce sul bordo destro
+func (s *lineState) newline() {
+	total := len([]rune(s.prompt)) + len(s.buf)
+	if total == 0 || total%s.cols != 0 {
+		fmt.Print("\n")
+	}
+}
+
+// refresh ridisegna prompt e riga e riporta il cursore nella sua posizione
+func (s *lineState) refresh() {
+	var out strings.Builder
+	if s.oldRow > 0 {
+		out.WriteString(fmt.Sprintf("\x1b[%dA", s.oldRow))
+	}
+	out.WriteString("\r\x1b[J")
+	out.WriteString(s.prompt)
+	for _, r := range s.buf {
+		switch r {
+		case '\n':
+			out.WriteRune('↵')
+		case '\t':
+			out.WriteRune(' ')
+		default:
+			out.WriteRune(r)
+		}
+	}
+
+	promptLength := len([]rune(s.prompt))
+	total := promptLength + len(s.buf)
+	// Sul bordo destro il terminale non è ancora andato a capo: lo forza
+	if total > 0 && total%s.cols == 0 {
+		out.WriteString("\n")
+	}
+	endRow := total / s.cols
+	targetRow := (promptLength + s.pos) / s.cols
+	targetCol := (promptLength + s.pos) % s.cols
+	if endRow > targetRow {
+		out.WriteString(fmt.Sprintf("\x1b[%dA", endRow-targetRow))
+	}
+	out.WriteString("\r")
+	if targetCol > 0 {
+		out.WriteString(fmt.Sprintf("\x1b[%dC", targetCol))
+	}
+	s.oldRow = targetRow
+
+	fmt.Print(out.String())
+}
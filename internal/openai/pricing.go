@@ -0,0 +1,70 @@
+package openai
+
+import (
+	"fmt"
+	"isy-cli/internal/config"
+	"os"
+	"path"
+	"regexp"
+	"sync"
+)
+
+// Price è il prezzo di un modello in USD per milione di token
+type Price struct {
+	Input  float64
+	Output float64
+}
+
+// Prezzi di listino dei modelli di chat più comuni. Cambiano nel tempo: la chiave
+// pricing della configurazione li sostituisce e copre i modelli non elencati.
+var modelPrices = map[string]Price{
+	"gpt-4o":        {Input: 2.50, Output: 10},
+	"gpt-4o-mini":   {Input: 0.15, Output: 0.60},
+	"gpt-4.1":       {Input: 2, Output: 8},
+	"gpt-4.1-mini":  {Input: 0.40, Output: 1.60},
+	"gpt-4.1-nano":  {Input: 0.10, Output: 0.40},
+	"gpt-5":         {Input: 1.25, Output: 10},
+	"gpt-5-mini":    {Input: 0.25, Output: 2},
+	"gpt-5-nano":    {Input: 0.05, Output: 0.40},
+	"gpt-4-turbo":   {Input: 10, Output: 30},
+	"gpt-3.5-turbo": {Input: 0.50, Output: 1.50},
+	"o1":            {Input: 15, Output: 60},
+	"o1-mini":       {Input: 1.10, Output: 4.40},
+	"o3":            {Input: 2, Output: 8},
+	"o3-mini":       {Input: 1.10, Output: 4.40},
+	"o4-mini":       {Input: 1.10, Output: 4.40},
+}
+
+// Data delle versioni fissate di un modello, es. gpt-4o-2024-08-06
+var snapshotSuffix = regexp.MustCompile(`-\d{4}-\d{2}-\d{2}$`)
+
+var unpricedWarnings sync.Map
+
+// ModelPrice restituisce il prezzo di un modello: prima quello indicato nella
+// configurazione, poi quello di listino, anche per le versioni fissate con la
+// data. Restituisce false se il prezzo non è noto.
+func ModelPrice(cfg *config.Config, model string) (Price, bool) {
+	for _, pricing := range cfg.Pricing {
+		if matched, err := path.Match(pricing.Model, model); err == nil && matched {
+			return Price{Input: pricing.Input, Output: pricing.Output}, true
+		}
+	}
+	if price, ok := modelPrices[model]; ok {
+		return price, true
+	}
+	price, ok := modelPrices[snapshotSuffix.ReplaceAllString(model, "")]
+	return price, ok
+}
+
+// Cost calcola il costo in USD di una richiesta
+func (p Price) Cost(inputTokens, outputTokens int64) float64 {
+	return float64(inputTokens)/1_000_000*p.Input + float64(outputTokens)/1_000_000*p.Output
+}
+
+// warnUnpriced segnala una volta per modello che il costo non viene conteggiato.
+// Va su stderr per non toccare l'output di --output json.
+func warnUnpriced(model string) {
+	if _, warned := unpricedWarnings.LoadOrStore(model, true); !warned {
+		fmt.Fprintf(os.Stderr, "Prezzo del modello %s sconosciuto: il costo delle sue richieste non viene conteggiato (indicalo con la chiave pricing della configurazione).\n", model)
+	}
+}
@@ -0,0 +1,44 @@
+package openai
+
+import (
+	"isy-cli/internal/config"
+	"testing"
+)
+
+func TestModelPrice(t *testing.T) {
+	cfg := &config.Config{Pricing: []config.ModelPricing{
+		{Model: "gpt-4o-mini", Input: 0.2, Output: 0.8},
+		{Model: "llama-*", Input: 0, Output: 0},
+	}}
+
+	tests := []struct {
+		model string
+		price Price
+		known bool
+	}{
+		{"gpt-4o", Price{Input: 2.50, Output: 10}, true},
+		{"gpt-4o-2024-08-06", Price{Input: 2.50, Output: 10}, true},
+		{"gpt-4.1-mini-2025-04-14", Price{Input: 0.40, Output: 1.60}, true},
+		{"gpt-4o-mini", Price{Input: 0.2, Output: 0.8}, true},
+		{"gpt-4o-mini-2024-07-18", Price{Input: 0.15, Output: 0.60}, true},
+		{"llama-3-70b", Price{}, true},
+		{"modello-sconosciuto", Price{}, false},
+		{"gpt-4o-preview", Price{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			price, known := ModelPrice(cfg, tt.model)
+			if known != tt.known || price != tt.price {
+				t.Fatalf("ModelPrice(%q) = %+v, %v; atteso %+v, %v", tt.model, price, known, tt.price, tt.known)
+			}
+		})
+	}
+}
+
+func TestPriceCost(t *testing.T) {
+	price := Price{Input: 2.50, Output: 10}
+	if got := price.Cost(1_000_000, 500_000); got != 7.50 {
+		t.Fatalf("Cost = %v, atteso 7.50", got)
+	}
+}
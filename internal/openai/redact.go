@@ -0,0 +1,74 @@
+package openai
+
+import (
+	"encoding/json"
+	"isy-cli/internal/redact"
+
+	"github.com/openai/openai-go"
+)
+
+// redactMessages sostituisce i segreti nel testo di tutti i messaggi della richiesta
+func redactMessages(redactor *redact.Redactor, messages []openai.ChatCompletionMessageParamUnion) []openai.ChatCompletionMessageParamUnion {
+	if redactor == nil {
+		return messages
+	}
+
+	redacted := make([]openai.ChatCompletionMessageParamUnion, len(messages))
+	for i, message := range messages {
+		switch m := message.(type) {
+		case openai.ChatCompletionSystemMessageParam:
+			m.Content = openai.F(redactTextParts(redactor, m.Content.Value))
+			redacted[i] = m
+		case openai.ChatCompletionUserMessageParam:
+			parts := make([]openai.ChatCompletionContentPartUnionParam, len(m.Content.Value))
+			for j, part := range m.Content.Value {
+				if text, ok := part.(openai.ChatCompletionContentPartTextParam); ok {
+					text.Text = openai.F(redactor.Redact(text.Text.Value))
+					part = text
+				}
+				parts[j] = part
+			}
+			m.Content = openai.F(parts)
+			redacted[i] = m
+		case openai.ChatCompletionAssistantMessageParam:
+			parts := make([]openai.ChatCompletionAssistantMessageParamContentUnion, len(m.Content.Value))
+			for j, part := range m.Content.Value {
+				if text, ok := part.(openai.ChatCompletionContentPartTextParam); ok {
+					text.Text = openai.F(redactor.Redact(text.Text.Value))
+					part = text
+				}
+				parts[j] = part
+			}
+			if m.Content.Present {
+				m.Content = openai.F(parts)
+			}
+			redacted[i] = m
+		case openai.ChatCompletionToolMessageParam:
+			m.Content = openai.F(redactTextParts(redactor, m.Content.Value))
+			redacted[i] = m
+		default:
+			redacted[i] = message
+		}
+	}
+	return redacted
+}
+
+func redactTextParts(redactor *redact.Redactor, parts []openai.ChatCompletionContentPartTextParam) []openai.ChatCompletionContentPartTextParam {
+	result := make([]openai.ChatCompletionContentPartTextParam, len(parts))
+	for i, part := range parts {
+		part.Text = openai.F(redactor.Redact(part.Text.Value))
+		result[i] = part
+	}
+	return result
+}
+
+// restoreContent rimette nella risposta del modello i segreti che aveva visto come
+// segnaposto, prima che la risposta venga validata e applicata: vale per il testo,
+// le patch, i blocchi search e new_code. Se la risposta è JSON i segreti vengono
+// inseriti con l'escape delle stringhe.
+func restoreContent(redactor *redact.Redactor, content string) string {
+	if json.Valid([]byte(content)) {
+		return redactor.RestoreJSON(content)
+	}
+	return redactor.Restore(content)
+}
@@ -6,21 +6,27 @@ import (
 
 // CodeModificationStep represents a step with various operations to be performed.
 type CodeModificationStep struct {
-	OperationType string       `json:"operation_type" jsonschema:"description=Type of operation: create, delete, edit"`
+	OperationType string       `json:"operation_type" jsonschema:"description=Type of operation,enum=create,enum=delete,enum=edit,enum=rename,enum=move,enum=mkdir"`
 	FilePath      string       `json:"file_path" jsonschema:"description=The path to the file for the operation, type=string"`
+	NewPath       string       `json:"new_path" jsonschema:"description=The destination path of a rename or move (empty for the other operations), type=string"`
+	Mode          string       `json:"mode" jsonschema:"description=Octal permissions to set on the file such as 0755 (empty to keep the current ones), type=string"`
 	Edits         []EditDetail `json:"edits" jsonschema:"description=List of edits (optional, used when operation is edit), type=array"`
 }
 
-// EditDetail details a specific edit within a file.
+// EditDetail details a specific edit within a file. When Search is set the edit
+// is anchored to that original text and the line numbers are only a hint.
 type EditDetail struct {
 	StartLine int    `json:"start_line" jsonschema:"description=The starting line number for the edit, type=integer"`
 	EndLine   int    `json:"end_line" jsonschema:"description=The ending line number for the edit, type=integer"`
+	Search    string `json:"search" jsonschema:"description=The original lines to replace copied verbatim from the file (empty to use only the line numbers), type=string"`
 	NewCode   string `json:"new_code" jsonschema:"description=The new code to insert, type=string"`
 }
 
 // CodeModificationResponse represents a complete set of steps to be executed.
+// Models that answer in the diff format fill Patch instead of Steps.
 type CodeModificationResponse struct {
 	Steps []CodeModificationStep `json:"steps" jsonschema:"description=An ordered list of modification steps to perform, type=array"`
+	Patch string                 `json:"patch,omitempty" jsonschema:"-"`
 }
 
 var CodeModificationResponseSchema = openai.GenerateSchema[CodeModificationResponse]()
@@ -29,9 +35,21 @@ const SYSTEM_PROMPT = `You are an AI assistant for a CLI tool, assisting develop
 
 1. **Create**: Generate new files at specified paths with provided content.
 2. **Delete**: Remove files or specified content within files.
-3. **Edit**: Modify specific parts of files, described by line numbers and new content.
+3. **Edit**: Modify specific parts of files, described by the original text to replace and the new content.
+4. **Rename** (or **Move**): Move the file in "file_path" to "new_path", keeping its content. Never delete and re-create a file to move it: add an edit step on "new_path" after the rename if the content must change too.
+5. **Mkdir**: Create the directory in "file_path", e.g. an empty package directory. Directories of created files are created automatically.
 
-Each task should consist of an ordered list of steps. Each step can contain multiple operations. Particularly for edits, provide detailed line information (start and end lines) and the code to substitute.
+Set "mode" only to change the permissions of a file, e.g. "0755" for a script; leave it empty otherwise. Line endings, byte order marks and permissions of existing files are preserved automatically.
+
+Each task should consist of an ordered list of steps. Each step can contain multiple operations. For every edit:
+- Copy in "search" the complete original lines you are replacing, verbatim from the current file, including enough surrounding lines to make them unique in the file. To insert code, include the line next to the insertion point in "search" and repeat it in "new_code".
+- Set "start_line" and "end_line" to the lines of "search" in the file: they are used only to choose between identical snippets, so approximate numbers are fine.
+- Put in "new_code" the complete replacement for those lines (empty to delete them).
+- Locate every edit of a step on the file as it is before the step: edits must not overlap, and earlier edits do not shift the lines of later ones.
+- To append to the end of a file or to fill an empty file, leave "search" empty, set "start_line" to the line after the last one and "end_line" to "start_line" minus 1.
+- Use "create" only for files that do not exist yet and "edit" or "delete" only for existing files.
+
+Every response is checked before it is applied: if some step is invalid nothing is applied and you receive the list of problems, to be fixed in a new complete response.
 
 While engaging with the developer:
 - Provide clear steps that outline file paths and operations type.
@@ -40,3 +58,28 @@ While engaging with the developer:
 
 Maintain technical accuracy and clear communication to facilitate efficient and error-free code adjustments.
 `
+
+// DIFF_SYSTEM_PROMPT replaces SYSTEM_PROMPT for models configured to answer with a patch
+const DIFF_SYSTEM_PROMPT = `You are an AI assistant for a CLI tool, assisting developers with precise code modifications. You answer every request with the changes expressed as a unified diff.
+
+Reply with a short explanation of the changes, followed by a single fenced block:
+
+` + "```diff" + `
+diff --git a/path/to/file b/path/to/file
+--- a/path/to/file
++++ b/path/to/file
+@@ -10,7 +10,8 @@
+ unchanged line
+-removed line
++added line
+ unchanged line
+` + "```" + `
+
+Rules for the patch:
+- Paths are relative to the project root, with the a/ and b/ prefixes.
+- To create a file use "--- /dev/null" and a single hunk "@@ -0,0 +1,N @@" with every line added. To delete a file use "+++ /dev/null" with every line removed.
+- To rename a file, start its section with "diff --git a/old/path b/new/path" followed by "rename from old/path" and "rename to new/path", then add hunks only if the content also changes.
+- Copy context and removed lines exactly from the current file, with their indentation, and include three unchanged lines of context around each change.
+- Line numbers in the hunk headers may be approximate, but hunks of the same file must be in order and must not overlap.
+- Suggest any shell commands needed after the modifications in the explanation, never inside the patch.
+`
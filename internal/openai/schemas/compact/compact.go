@@ -0,0 +1,22 @@
+package compact
+
+import (
+	"isy-cli/internal/openai"
+)
+
+type ConversationSummary struct {
+	Summary string `json:"summary" jsonschema_description:"A concise summary of the earlier conversation that preserves every fact, decision and open question needed to continue it" jsonschema:"type=string"`
+}
+
+var ConversationSummaryResponseSchema = openai.GenerateSchema[ConversationSummary]()
+
+// SYSTEM_PROMPT rappresenta il prompt di sistema per riassumere i turni compattati
+const SYSTEM_PROMPT = `You compress the earlier part of a conversation between a developer and an AI coding assistant, so that the conversation can continue within a limited context window.
+
+You receive the previous summary (if any) followed by the turns to compress. Write a single updated summary that:
+1. Keeps the developer's goals, requirements and constraints.
+2. Keeps decisions taken, answers given and code changes proposed, naming the files, functions and symbols involved.
+3. Keeps open questions and anything the developer asked to do later.
+4. Drops greetings, repetitions and code that the project context already contains.
+
+Write in the same language the developer uses. Be concise but never drop information needed to continue the conversation.`
@@ -6,8 +6,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"isy-cli/internal/config"
+	"isy-cli/internal/project"
+	"isy-cli/internal/redact"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/invopop/jsonschema"
 	"github.com/openai/openai-go"
@@ -18,14 +21,15 @@ import (
 var mu sync.Mutex // Per gestire l'accesso concorrente ai token globali
 
 type TokenUsage struct {
-	TokenInput  int64   `json:"token_input"`
-	TokenOutput int64   `json:"token_output"`
-	TotalCost   float64 `json:"total_cost"`
+	TokenInput     int64   `json:"token_input"`
+	TokenOutput    int64   `json:"token_output"`
+	TotalCost      float64 `json:"total_cost"`                // Costo delle richieste a modelli con prezzo noto
+	UnpricedTokens int64   `json:"unpriced_tokens,omitempty"` // Token di modelli senza prezzo, esclusi da TotalCost
 }
 
 // Salva l'utilizzo dei token su disco
 func SaveTokenUsage(usage TokenUsage) error {
-	filePath := ".isy/token_usage.json"
+	filePath := project.StatePath("token_usage.json")
 	data, err := json.MarshalIndent(usage, "", "  ")
 	if err != nil {
 		return fmt.Errorf("errore durante la serializzazione dei dati token: %v", err)
@@ -36,7 +40,7 @@ func SaveTokenUsage(usage TokenUsage) error {
 // Carica l'utilizzo dei token da disco
 func LoadTokenUsage() (TokenUsage, error) {
 
-	filePath := ".isy/token_usage.json"
+	filePath := project.StatePath("token_usage.json")
 
 	var usage TokenUsage
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
@@ -80,53 +84,163 @@ func TokenizerCtx(ctx string) ([]int, error) {
 	return token, nil
 }
 
+// DefaultModel è il modello di chat usato se la configurazione non ne indica uno
+const DefaultModel = openai.ChatModelGPT4o
+
+// DefaultMaxRetries è il numero di tentativi usato se la configurazione non lo indica
+const DefaultMaxRetries = 5
+
+// ChatModel restituisce il modello di chat configurato
+func ChatModel(cfg *config.Config) string {
+	if cfg.Model != "" {
+		return cfg.Model
+	}
+	return DefaultModel
+}
+
+// ToolRunner esegue le funzioni che il modello può chiamare durante una richiesta
+type ToolRunner interface {
+	// Tools restituisce le definizioni delle funzioni offerte al modello
+	Tools() []openai.ChatCompletionToolParam
+	// Call esegue una chiamata e restituisce il testo da rimandare al modello
+	Call(name, arguments string) string
+	// Exhausted indica che il budget di chiamate della richiesta è esaurito
+	Exhausted() bool
+}
+
 func RunCompletion(params openai.ChatCompletionNewParams) (string, error) {
-	// Percorso al file di configurazione e al file di utilizzo dei token
+	return RunCompletionWithTools(params, nil)
+}
 
+// RunCompletionWithTools esegue una richiesta in cui il modello può chiamare le
+// funzioni di runner: i risultati gli vengono rimandati finché non risponde. Quando
+// il budget è esaurito le funzioni restano definite ma il modello deve rispondere.
+func RunCompletionWithTools(params openai.ChatCompletionNewParams, runner ToolRunner) (string, error) {
 	// Carica la configurazione
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		return "", fmt.Errorf("errore durante il caricamento della configurazione: %v", err)
 	}
 
-	// Carica l'utilizzo corrente dei token
-	currentUsage, err := LoadTokenUsage()
+	// Rimuove i segreti da tutti i messaggi prima che lascino la macchina
+	redactor, err := redact.New(cfg)
+	if err != nil {
+		return "", err
+	}
+	messages := redactMessages(redactor, params.Messages.Value)
+	redactor.Report("chat.completions")
+
+	// La chiave può essere un riferimento a un segreto del portachiavi o del file cifrato
+	apiKey, err := cfg.ResolveSecret(cfg.APIKey)
 	if err != nil {
-		return "", fmt.Errorf("errore durante il caricamento dell'utilizzo dei token: %v", err)
+		return "", err
 	}
 
 	client := openai.NewClient(
-		option.WithAPIKey(cfg.APIKey), // Imposta la chiave API
+		option.WithAPIKey(apiKey), // Imposta la chiave API
 	)
 
+	// Applica le impostazioni di esecuzione della configurazione
+	maxRetries := DefaultMaxRetries
+	if cfg.Run.MaxRetries > 0 {
+		maxRetries = cfg.Run.MaxRetries
+	}
+	if cfg.Run.Temperature != nil {
+		params.Temperature = openai.F(*cfg.Run.Temperature)
+	}
+
+	if runner != nil {
+		if tools := runner.Tools(); len(tools) > 0 {
+			params.Tools = openai.F(tools)
+		}
+	}
+
+	for {
+		params.Messages = openai.F(messages)
+		if runner != nil && runner.Exhausted() {
+			params.ToolChoice = openai.F[openai.ChatCompletionToolChoiceOptionUnionParam](openai.ChatCompletionToolChoiceOptionBehaviorNone)
+		}
+
+		chat, err := complete(client, params, cfg, maxRetries)
+		if err != nil {
+			return "", err
+		}
+
+		// Se non ci sono scelte nella risposta, ritorna stringa vuota e un errore
+		if len(chat.Choices) == 0 {
+			return "", fmt.Errorf("nessuna risposta disponibile dalla completion")
+		}
+		message := chat.Choices[0].Message
+
+		// Ritorna la risposta grezza, con i segreti al posto dei segnaposto
+		if runner == nil || len(message.ToolCalls) == 0 {
+			return restoreContent(redactor, message.Content), nil
+		}
+
+		// Esegue le chiamate richieste e ne rimanda i risultati, anch'essi redatti
+		messages = append(messages, message)
+		for _, call := range message.ToolCalls {
+			result := openai.ToolMessage(call.ID, runner.Call(call.Function.Name, restoreContent(redactor, call.Function.Arguments)))
+			messages = append(messages, redactMessages(redactor, []openai.ChatCompletionMessageParamUnion{result})...)
+		}
+		redactor.Report("chat.completions")
+	}
+}
+
+// complete invia una singola richiesta e aggiorna l'utilizzo dei token
+func complete(client *openai.Client, params openai.ChatCompletionNewParams, cfg *config.Config, maxRetries int) (*openai.ChatCompletion, error) {
 	ctx := context.Background()
+	if cfg.Run.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(cfg.Run.Timeout)*time.Second)
+		defer cancel()
+	}
 
 	// Esegui la richiesta di completamento
-	chat, err := client.Chat.Completions.New(ctx, params, option.WithMaxRetries(5))
+	chat, err := client.Chat.Completions.New(ctx, params, option.WithMaxRetries(maxRetries))
 	if err != nil {
-		return "", fmt.Errorf("errore durante la richiesta di completamento: %v", err)
+		return nil, fmt.Errorf("errore durante la richiesta di completamento: %v", err)
 	}
 
 	// Aggiorna i token globali e calcola i costi
 	mu.Lock()
+	defer mu.Unlock()
+
+	currentUsage, err := LoadTokenUsage()
+	if err != nil {
+		return nil, fmt.Errorf("errore durante il caricamento dell'utilizzo dei token: %v", err)
+	}
 	currentUsage.TokenInput += chat.Usage.PromptTokens
 	currentUsage.TokenOutput += chat.Usage.CompletionTokens
 
-	inputCost := float64(chat.Usage.PromptTokens) / 1_000_000 * 2.50
-	outputCost := float64(chat.Usage.CompletionTokens) / 1_000_000 * 10
-	currentUsage.TotalCost += inputCost + outputCost
-
-	err = SaveTokenUsage(currentUsage)
-	mu.Unlock()
-	if err != nil {
-		return "", fmt.Errorf("errore durante il salvataggio dell'utilizzo dei token: %v", err)
+	// Il costo dipende dal modello; senza un prezzo noto non viene stimato
+	model := string(params.Model.Value)
+	if price, ok := ModelPrice(cfg, model); ok {
+		currentUsage.TotalCost += price.Cost(chat.Usage.PromptTokens, chat.Usage.CompletionTokens)
+	} else {
+		currentUsage.UnpricedTokens += chat.Usage.PromptTokens + chat.Usage.CompletionTokens
+		warnUnpriced(model)
 	}
 
-	// Ritorna direttamente la risposta grezza
-	if len(chat.Choices) > 0 {
-		return chat.Choices[0].Message.Content, nil
+	if err := SaveTokenUsage(currentUsage); err != nil {
+		return nil, fmt.Errorf("errore durante il salvataggio dell'utilizzo dei token: %v", err)
 	}
+	return chat, nil
+}
 
-	// Se non ci sono scelte nella risposta, ritorna stringa vuota e un errore
-	return "", fmt.Errorf("nessuna risposta disponibile dalla completion")
+var (
+	countEncodingOnce sync.Once
+	countEncoding     *tiktoken.Tiktoken
+)
+
+// CountTokens conta i token di un testo. Se il tokenizzatore non è disponibile
+// (ad esempio offline) usa una stima di quattro caratteri per token.
+func CountTokens(text string) int {
+	countEncodingOnce.Do(func() {
+		countEncoding, _ = tiktoken.EncodingForModel("gpt-4o")
+	})
+	if countEncoding == nil {
+		return (len(text) + 3) / 4
+	}
+	return len(countEncoding.Encode(text, nil, nil))
 }
@@ -0,0 +1,258 @@
+package operations
+
+import (
+	"fmt"
+	"isy-cli/internal/openai/schemas/code"
+	"sort"
+	"strings"
+)
+
+// span è l'intervallo di righe (0-based, fine esclusa) sostituito da una modifica
+type span struct {
+	start, end int
+	lines      []string // Righe che prendono il posto dell'intervallo
+	edit       int      // Indice della modifica nel passo, per i messaggi
+}
+
+// editFailure è una modifica di un passo che non si può applicare
+type editFailure struct {
+	edit int // Indice della modifica nel passo, da 1
+	err  error
+}
+
+// spliceEdits applica a un contenuto le modifiche di un passo. Tutte le modifiche
+// vengono localizzate sul contenuto originale, così nessuna sposta le righe delle
+// altre; quelle senza testo usano i numeri di riga. Se qualche modifica non si
+// può localizzare, o si sovrappone a un'altra, restituisce tutti i problemi.
+func spliceEdits(content string, edits []code.EditDetail) (string, []editFailure) {
+	lines := strings.Split(content, "\n")
+
+	var spans []span
+	var failures []editFailure
+	for i, edit := range edits {
+		located, err := locateEdit(lines, edit)
+		if err != nil {
+			failures = append(failures, editFailure{edit: i + 1, err: err})
+			continue
+		}
+		located.edit = i + 1
+		spans = append(spans, located)
+	}
+
+	// Dal fondo del file; a parità di inizio prima le sostituzioni, poi gli
+	// inserimenti in ordine inverso, così restano nell'ordine del passo
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start > spans[j].start
+		}
+		if spans[i].end != spans[j].end {
+			return spans[i].end > spans[j].end
+		}
+		return spans[i].edit > spans[j].edit
+	})
+	for i := 1; i < len(spans); i++ {
+		if spans[i].end > spans[i-1].start {
+			first, second := spans[i], spans[i-1]
+			if first.edit > second.edit {
+				first, second = second, first
+			}
+			failures = append(failures, editFailure{edit: second.edit, err: fmt.Errorf("le righe %d-%d si sovrappongono a quelle della modifica %d (%d-%d)",
+				second.start+1, second.end, first.edit, first.start+1, first.end)})
+		}
+	}
+	if len(failures) > 0 {
+		sort.SliceStable(failures, func(i, j int) bool { return failures[i].edit < failures[j].edit })
+		return "", failures
+	}
+
+	for _, s := range spans {
+		lines = append(lines[:s.start], append(s.lines, lines[s.end:]...)...)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// locateEdit trova le righe che una modifica sostituisce
+func locateEdit(lines []string, edit code.EditDetail) (span, error) {
+	replacement := splitSnippet(edit.NewCode)
+
+	if edit.Search == "" {
+		count := lineCount(lines)
+		// Un intervallo vuoto inserisce prima di start_line, anche dopo l'ultima riga
+		if edit.EndLine == edit.StartLine-1 && edit.StartLine >= 1 && edit.StartLine <= count+1 {
+			return span{start: edit.StartLine - 1, end: edit.StartLine - 1, lines: replacement}, nil
+		}
+		if edit.StartLine < 1 || edit.EndLine > count || edit.StartLine > edit.EndLine {
+			return span{}, fmt.Errorf("intervallo di righe %d-%d non valido: il file ha %d righe (per inserire senza sostituire usa end_line = start_line - 1)",
+				edit.StartLine, edit.EndLine, count)
+		}
+		return span{start: edit.StartLine - 1, end: edit.EndLine, lines: replacement}, nil
+	}
+
+	search := splitSnippet(edit.Search)
+	search = trimBlankLines(search)
+	if len(search) == 0 {
+		return span{}, fmt.Errorf("il testo da sostituire contiene solo righe vuote")
+	}
+
+	// Prima il confronto esatto, poi quello che ignora gli spazi
+	matches := findSnippet(lines, search, func(a, b string) bool { return a == b })
+	fuzzy := false
+	if len(matches) == 0 {
+		matches = findSnippet(lines, search, func(a, b string) bool { return normalizeSpaces(a) == normalizeSpaces(b) })
+		fuzzy = true
+	}
+
+	switch {
+	case len(matches) == 0:
+		return span{}, notFoundError(lines, search)
+	case len(matches) > 1:
+		start, ok := nearestMatch(matches, edit.StartLine-1)
+		if !ok {
+			return span{}, ambiguousError(matches, len(search))
+		}
+		matches = []int{start}
+	}
+
+	start := matches[0]
+	if fuzzy {
+		replacement = reindent(replacement, search[0], lines[start])
+	}
+	return span{start: start, end: start + len(search), lines: replacement}, nil
+}
+
+// lineCount restituisce il numero di righe del file, senza contare la riga vuota
+// che segue l'a capo finale
+func lineCount(lines []string) int {
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		return len(lines) - 1
+	}
+	return len(lines)
+}
+
+// splitSnippet divide un frammento in righe, ignorando l'a capo finale
+func splitSnippet(snippet string) []string {
+	snippet = strings.ReplaceAll(snippet, "\r\n", "\n")
+	if snippet == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(snippet, "\n"), "\n")
+}
+
+// trimBlankLines toglie le righe vuote all'inizio e alla fine del testo da cercare,
+// che i modelli aggiungono o tolgono spesso
+func trimBlankLines(lines []string) []string {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// normalizeSpaces riduce ogni sequenza di spazi a uno solo e toglie quelli agli estremi
+func normalizeSpaces(line string) string {
+	return strings.Join(strings.Fields(line), " ")
+}
+
+// findSnippet restituisce le righe (0-based) da cui inizia il frammento
+func findSnippet(lines, search []string, equal func(a, b string) bool) []int {
+	var matches []int
+	for start := 0; start+len(search) <= len(lines); start++ {
+		found := true
+		for i := range search {
+			if !equal(lines[start+i], search[i]) {
+				found = false
+				break
+			}
+		}
+		if found {
+			matches = append(matches, start)
+		}
+	}
+	return matches
+}
+
+// nearestMatch sceglie tra più corrispondenze quella più vicina alla riga indicata
+// dal modello; senza indicazione, o a pari distanza, la scelta è ambigua
+func nearestMatch(matches []int, hint int) (int, bool) {
+	if hint < 0 {
+		return 0, false
+	}
+	best, bestDistance, tie := -1, -1, false
+	for _, start := range matches {
+		distance := start - hint
+		if distance < 0 {
+			distance = -distance
+		}
+		switch {
+		case bestDistance < 0 || distance < bestDistance:
+			best, bestDistance, tie = start, distance, false
+		case distance == bestDistance:
+			tie = true
+		}
+	}
+	return best, !tie
+}
+
+// reindent sposta l'indentazione della sostituzione quando il testo è stato
+// trovato con un'indentazione diversa da quella indicata dal modello
+func reindent(replacement []string, searchLine, fileLine string) []string {
+	from := leadingSpace(searchLine)
+	to := leadingSpace(fileLine)
+	if from == to {
+		return replacement
+	}
+	result := make([]string, len(replacement))
+	for i, line := range replacement {
+		if strings.TrimSpace(line) != "" && strings.HasPrefix(line, from) {
+			line = to + strings.TrimPrefix(line, from)
+		}
+		result[i] = line
+	}
+	return result
+}
+
+func leadingSpace(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// notFoundError segnala un testo non trovato indicando, se c'è, il punto più simile
+func notFoundError(lines, search []string) error {
+	best, bestScore := -1, 0
+	for start := 0; start+len(search) <= len(lines); start++ {
+		score := 0
+		for i := range search {
+			if normalizeSpaces(lines[start+i]) == normalizeSpaces(search[i]) {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore = start, score
+		}
+	}
+
+	message := fmt.Sprintf("il testo da sostituire (%d righe, da %q) non è nel file", len(search), firstLine(search))
+	if best >= 0 && bestScore*2 >= len(search) {
+		message += fmt.Sprintf("; il punto più simile sono le righe %d-%d (%d righe su %d uguali)", best+1, best+len(search), bestScore, len(search))
+	}
+	return fmt.Errorf("%s", message)
+}
+
+// ambiguousError segnala un testo che compare più volte
+func ambiguousError(matches []int, length int) error {
+	var positions []string
+	for _, start := range matches {
+		positions = append(positions, fmt.Sprintf("%d-%d", start+1, start+length))
+	}
+	return fmt.Errorf("il testo da sostituire compare %d volte (righe %s): aggiungi righe di contesto o indica start_line",
+		len(matches), strings.Join(positions, ", "))
+}
+
+func firstLine(lines []string) string {
+	line := strings.TrimSpace(lines[0])
+	if len(line) > 60 {
+		line = line[:60] + "..."
+	}
+	return line
+}
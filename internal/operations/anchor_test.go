@@ -0,0 +1,207 @@
+package operations
+
+import (
+	"isy-cli/internal/openai/schemas/code"
+	"strings"
+	"testing"
+)
+
+func TestSpliceEdits(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		edits   []code.EditDetail
+		want    string
+	}{
+		{
+			name:    "sostituzione per righe",
+			content: "a\nb\nc\nd\n",
+			edits:   []code.EditDetail{{StartLine: 2, EndLine: 3, NewCode: "B\nC\n"}},
+			want:    "a\nB\nC\nd\n",
+		},
+		{
+			name:    "rimozione per righe",
+			content: "a\nb\nc\n",
+			edits:   []code.EditDetail{{StartLine: 2, EndLine: 2, NewCode: ""}},
+			want:    "a\nc\n",
+		},
+		{
+			name:    "inserimento prima di una riga",
+			content: "a\nc\n",
+			edits:   []code.EditDetail{{StartLine: 2, EndLine: 1, NewCode: "b\n"}},
+			want:    "a\nb\nc\n",
+		},
+		{
+			name:    "inserimento dopo l'ultima riga",
+			content: "a\nb\n",
+			edits:   []code.EditDetail{{StartLine: 3, EndLine: 2, NewCode: "c\n"}},
+			want:    "a\nb\nc\n",
+		},
+		{
+			name:    "inserimenti nella stessa riga nell'ordine del passo",
+			content: "a\nd\n",
+			edits: []code.EditDetail{
+				{StartLine: 2, EndLine: 1, NewCode: "b\n"},
+				{StartLine: 2, EndLine: 1, NewCode: "c\n"},
+			},
+			want: "a\nb\nc\nd\n",
+		},
+		{
+			name:    "inserimento e sostituzione della stessa riga",
+			content: "a\nb\nc\n",
+			edits: []code.EditDetail{
+				{StartLine: 2, EndLine: 2, NewCode: "B\n"},
+				{StartLine: 2, EndLine: 1, NewCode: "nuova\n"},
+			},
+			want: "a\nnuova\nB\nc\n",
+		},
+		{
+			name:    "modifiche localizzate sul contenuto originale",
+			content: "1\n2\n3\n4\n5\n",
+			edits: []code.EditDetail{
+				{StartLine: 1, EndLine: 1, NewCode: "uno\nuno bis\n"},
+				{StartLine: 4, EndLine: 4, NewCode: "quattro\n"},
+			},
+			want: "uno\nuno bis\n2\n3\nquattro\n5\n",
+		},
+		{
+			name:    "testo esatto",
+			content: "func f() {\n\treturn 1\n}\n",
+			edits:   []code.EditDetail{{Search: "\treturn 1\n", NewCode: "\treturn 2\n"}},
+			want:    "func f() {\n\treturn 2\n}\n",
+		},
+		{
+			name:    "testo con righe vuote attorno",
+			content: "a\nb\nc\n",
+			edits:   []code.EditDetail{{Search: "\nb\n\n", NewCode: "B\n"}},
+			want:    "a\nB\nc\n",
+		},
+		{
+			name:    "testo ripetuto scelto con start_line",
+			content: "x\ny\nx\ny\n",
+			edits:   []code.EditDetail{{StartLine: 3, Search: "x\n", NewCode: "X\n"}},
+			want:    "x\ny\nX\ny\n",
+		},
+		{
+			name:    "testo trovato ignorando gli spazi con reindentazione",
+			content: "func f() {\n\tif ok {\n\t\treturn 1\n\t}\n}\n",
+			edits: []code.EditDetail{{
+				Search:  "    if ok {\n        return 1\n    }\n",
+				NewCode: "    if ok {\n        log()\n        return 2\n    }\n",
+			}},
+			want: "func f() {\n\tif ok {\n\t    log()\n\t    return 2\n\t}\n}\n",
+		},
+		{
+			name:    "testo trovato ignorando gli spazi con la stessa indentazione",
+			content: "a  =  1\n",
+			edits:   []code.EditDetail{{Search: "a = 1\n", NewCode: "a = 2\n"}},
+			want:    "a = 2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, failures := spliceEdits(tt.content, tt.edits)
+			if len(failures) > 0 {
+				t.Fatalf("spliceEdits: modifica %d: %v", failures[0].edit, failures[0].err)
+			}
+			if got != tt.want {
+				t.Fatalf("spliceEdits = %q, atteso %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpliceEditsFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		edits   []code.EditDetail
+		failed  []int  // Modifiche che non si possono applicare
+		message string // Parte attesa del primo errore
+	}{
+		{
+			name:    "righe sovrapposte",
+			content: "a\nb\nc\nd\n",
+			edits: []code.EditDetail{
+				{StartLine: 1, EndLine: 2, NewCode: "A\n"},
+				{StartLine: 2, EndLine: 3, NewCode: "B\n"},
+			},
+			failed:  []int{2},
+			message: "si sovrappongono a quelle della modifica 1",
+		},
+		{
+			name:    "testo sovrapposto a un intervallo",
+			content: "a\nb\nc\nd\n",
+			edits: []code.EditDetail{
+				{Search: "c\nd\n", NewCode: "C\n"},
+				{StartLine: 1, EndLine: 3, NewCode: "A\n"},
+			},
+			failed:  []int{2},
+			message: "si sovrappongono a quelle della modifica 1",
+		},
+		{
+			name:    "intervallo oltre la fine del file",
+			content: "a\nb\n",
+			edits:   []code.EditDetail{{StartLine: 2, EndLine: 5, NewCode: "B\n"}},
+			failed:  []int{1},
+			message: "intervallo di righe 2-5 non valido",
+		},
+		{
+			name:    "testo non trovato",
+			content: "a\nb\nc\n",
+			edits:   []code.EditDetail{{Search: "a\nx\nc\n", NewCode: "A\n"}},
+			failed:  []int{1},
+			message: "il punto più simile sono le righe 1-3",
+		},
+		{
+			name:    "testo ripetuto senza start_line",
+			content: "x\ny\nx\n",
+			edits:   []code.EditDetail{{Search: "x\n", NewCode: "X\n"}},
+			failed:  []int{1},
+			message: "compare 2 volte (righe 1-1, 3-3)",
+		},
+		{
+			name:    "tutti i problemi del passo",
+			content: "a\nb\n",
+			edits: []code.EditDetail{
+				{Search: "z\n", NewCode: "Z\n"},
+				{StartLine: 1, EndLine: 1, NewCode: "A\n"},
+				{StartLine: 0, EndLine: 1, NewCode: "B\n"},
+			},
+			failed:  []int{1, 3},
+			message: "non è nel file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, failures := spliceEdits(tt.content, tt.edits)
+			if len(failures) == 0 {
+				t.Fatalf("spliceEdits = %q, attesi errori nelle modifiche %v", got, tt.failed)
+			}
+			var failed []int
+			for _, failure := range failures {
+				failed = append(failed, failure.edit)
+			}
+			if !equalInts(failed, tt.failed) {
+				t.Fatalf("modifiche non applicate = %v, attese %v", failed, tt.failed)
+			}
+			if message := failures[0].err.Error(); !strings.Contains(message, tt.message) {
+				t.Fatalf("errore = %q, atteso un errore con %q", message, tt.message)
+			}
+		})
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
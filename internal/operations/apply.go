@@ -0,0 +1,234 @@
+package operations
+
+import (
+	"fmt"
+	"isy-cli/internal/openai/schemas/code"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+)
+
+// backup è lo stato di un file prima di una modifica
+type backup struct {
+	path    string
+	existed bool
+	content []byte
+	mode    os.FileMode
+}
+
+// Change è l'insieme delle modifiche applicate da una risposta, annullabile con Undo
+type Change struct {
+	Dir     string
+	Files   []string // File toccati, relativi a Dir
+	Notes   []string // Modifiche applicate in modo approssimato (offset, fuzz)
+	backups []backup
+	dirs    []string // Directory create, da rimuovere con Undo
+}
+
+// Apply esegue i passi di una risposta di code nella directory indicata (il
+// branch) come un'unica transazione. I passi vengono prima eseguiti in memoria:
+// se qualcuno non è valido restituisce un *PlanError con tutti i problemi e non
+// tocca nessun file. Poi i nuovi contenuti vengono preparati in file temporanei
+// e rinominati al loro posto; se qualcosa fallisce tutti i file tornano allo
+// stato precedente. Il journal in .isy permette di annullare con Recover
+// un'applicazione interrotta.
+func Apply(dir string, response code.CodeModificationResponse) (*Change, error) {
+	p, planErr := simulate(dir, response)
+	if planErr != nil {
+		return &Change{Dir: dir}, planErr
+	}
+
+	j, err := newJournal(dir)
+	if err != nil {
+		return &Change{Dir: dir}, err
+	}
+	change := &Change{Dir: dir, Notes: p.notes}
+	if err := change.commit(p, j); err != nil {
+		if rollbackErr := j.rollback(); rollbackErr != nil {
+			return &Change{Dir: dir}, fmt.Errorf("%v; ripristino non riuscito (%v): verrà ripetuto al prossimo avvio", err, rollbackErr)
+		}
+		j.remove()
+		return &Change{Dir: dir}, fmt.Errorf("%v: nessuna modifica è stata applicata", err)
+	}
+	j.remove()
+	return change, nil
+}
+
+// commit scrive le modifiche di un piano già validato, registrando ogni file nel
+// journal prima di toccarlo
+func (c *Change) commit(p *plan, j *journal) error {
+	var writes, removals []*plannedFile
+	for _, key := range p.order {
+		file := p.files[key]
+		switch {
+		case !file.changed():
+		case file.exists:
+			writes = append(writes, file)
+		default:
+			removals = append(removals, file)
+		}
+	}
+
+	for _, key := range p.dirs {
+		j.addDirs(filepath.Join(c.Dir, filepath.FromSlash(key)))
+	}
+	for _, file := range writes {
+		j.addDirs(filepath.Dir(file.path))
+		if err := j.add(file.path, true); err != nil {
+			return err
+		}
+	}
+	for _, file := range removals {
+		if err := j.add(file.path, false); err != nil {
+			return err
+		}
+	}
+	if err := j.save(); err != nil {
+		return err
+	}
+
+	// Ctrl+C durante la scrittura viene ignorato: la transazione si conclude comunque
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	for _, path := range j.Dirs {
+		if err := os.Mkdir(path, 0755); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("errore durante la creazione della directory %s: %v", path, err)
+		}
+	}
+	c.dirs = j.Dirs
+	for _, key := range p.dirs {
+		c.Files = append(c.Files, key+"/")
+	}
+
+	// Prima tutti i nuovi contenuti, poi le rinomine: un errore di scrittura
+	// non lascia nessun file a metà
+	for _, file := range writes {
+		staged := j.stagingPath(file.path)
+		if err := writeSynced(staged, []byte(file.format.encode(file.update)), file.mode); err != nil {
+			return fmt.Errorf("errore durante la scrittura di %s: %v", file.path, err)
+		}
+		if err := os.Chmod(staged, file.mode); err != nil {
+			return fmt.Errorf("errore durante la modifica dei permessi di %s: %v", file.path, err)
+		}
+	}
+	for _, file := range writes {
+		if err := c.save(file.path); err != nil {
+			return err
+		}
+		if err := os.Rename(j.stagingPath(file.path), file.path); err != nil {
+			return fmt.Errorf("errore durante la scrittura di %s: %v", file.path, err)
+		}
+	}
+	for _, file := range removals {
+		if err := c.save(file.path); err != nil {
+			return err
+		}
+		if err := DeleteFile(file.path); err != nil {
+			return fmt.Errorf("%s: %v", file.path, err)
+		}
+	}
+
+	j.Committed = true
+	return j.save()
+}
+
+// save registra lo stato di un file prima della sua prima modifica
+func (c *Change) save(path string) error {
+	for _, saved := range c.backups {
+		if saved.path == path {
+			return nil
+		}
+	}
+
+	saved := backup{path: path}
+	info, err := os.Stat(path)
+	switch {
+	case err == nil:
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("errore durante la lettura di %s: %v", path, err)
+		}
+		saved.existed = true
+		saved.content = content
+		saved.mode = info.Mode().Perm()
+	case !os.IsNotExist(err):
+		return fmt.Errorf("errore durante la lettura di %s: %v", path, err)
+	}
+	c.backups = append(c.backups, saved)
+
+	rel, _ := filepath.Rel(c.Dir, path)
+	c.Files = append(c.Files, filepath.ToSlash(rel))
+	return nil
+}
+
+// Undo riporta i file toccati allo stato precedente alla modifica
+func (c *Change) Undo() error {
+	for i := len(c.backups) - 1; i >= 0; i-- {
+		saved := c.backups[i]
+		if !saved.existed {
+			if err := os.Remove(saved.path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("errore durante la rimozione di %s: %v", saved.path, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(saved.path), 0755); err != nil {
+			return fmt.Errorf("errore durante la creazione della directory di %s: %v", saved.path, err)
+		}
+		if err := os.WriteFile(saved.path, saved.content, saved.mode); err != nil {
+			return fmt.Errorf("errore durante il ripristino di %s: %v", saved.path, err)
+		}
+		if err := os.Chmod(saved.path, saved.mode); err != nil {
+			return fmt.Errorf("errore durante il ripristino dei permessi di %s: %v", saved.path, err)
+		}
+	}
+	for i := len(c.dirs) - 1; i >= 0; i-- {
+		if err := os.Remove(c.dirs[i]); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("errore durante la rimozione di %s: %v", c.dirs[i], err)
+		}
+	}
+	return nil
+}
+
+// resolve converte il percorso indicato dal modello in un percorso dentro dir,
+// rifiutando quelli che ne escono
+func resolve(dir, path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("percorso del file mancante")
+	}
+	if filepath.IsAbs(path) {
+		return "", fmt.Errorf("il percorso %s deve essere relativo alla radice del progetto", path)
+	}
+	clean := filepath.Clean(filepath.FromSlash(path))
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("il percorso %s è fuori dal progetto", path)
+	}
+	if clean == ".isy" || strings.HasPrefix(clean, ".isy"+string(filepath.Separator)) {
+		return "", fmt.Errorf("il percorso %s è riservato a isy", path)
+	}
+	return filepath.Join(dir, clean), nil
+}
+
+// CreateFile crea un file (e le sue directory) con il contenuto indicato
+func CreateFile(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("errore durante la creazione della directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("errore durante la scrittura del file: %v", err)
+	}
+	return nil
+}
+
+// DeleteFile rimuove un file
+func DeleteFile(path string) error {
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("il file non esiste")
+		}
+		return fmt.Errorf("errore durante la rimozione del file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package operations
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const byteOrderMark = "\ufeff"
+
+// DefaultMode sono i permessi dei file creati senza un modo indicato
+const DefaultMode os.FileMode = 0644
+
+// textFormat è la forma in cui un file di testo è scritto su disco. Le modifiche
+// lavorano sul testo con i soli \n: il formato originale viene ripristinato
+// alla scrittura.
+type textFormat struct {
+	bom  bool // Il file inizia con il BOM UTF-8
+	crlf bool // Tutte le righe finiscono con \r\n
+}
+
+// decodeText toglie BOM e \r\n da un contenuto e restituisce il formato originale.
+// I file con terminatori misti restano invariati.
+func decodeText(content string) (string, textFormat) {
+	var format textFormat
+	if strings.HasPrefix(content, byteOrderMark) {
+		format.bom = true
+		content = strings.TrimPrefix(content, byteOrderMark)
+	}
+	if crlf := strings.Count(content, "\r\n"); crlf > 0 && crlf == strings.Count(content, "\n") {
+		format.crlf = true
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+	}
+	return content, format
+}
+
+// encode riporta un testo modificato nel formato originale del file
+func (f textFormat) encode(text string) string {
+	if f.crlf {
+		text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", "\r\n")
+	}
+	if f.bom && !strings.HasPrefix(text, byteOrderMark) {
+		text = byteOrderMark + text
+	}
+	return text
+}
+
+// parseMode legge i permessi indicati dal modello in ottale, es. "0755" o "644"
+func parseMode(mode string) (os.FileMode, error) {
+	value, err := strconv.ParseUint(strings.TrimSpace(mode), 8, 32)
+	if err != nil || value > 0777 {
+		return 0, fmt.Errorf("modo %q non valido: usa i permessi in ottale, es. 0644 o 0755", mode)
+	}
+	if value&0400 == 0 {
+		return 0, fmt.Errorf("modo %q non valido: il file deve restare leggibile dal proprietario", mode)
+	}
+	return os.FileMode(value), nil
+}
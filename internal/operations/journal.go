@@ -0,0 +1,255 @@
+package operations
+
+import (
+	"encoding/json"
+	"fmt"
+	"isy-cli/internal/project"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	journalDir  = "journal"      // Directory dei journal, dentro .isy
+	journalFile = "journal.json" // Descrizione dell'applicazione, nella directory del journal
+)
+
+// journal registra un'applicazione in corso: prima di toccare i file ne conserva
+// una copia, così che un'applicazione fallita, o interrotta da un crash o da
+// Ctrl+C, possa essere annullata del tutto. Al termine viene rimosso.
+type journal struct {
+	path      string         // Directory del journal
+	ID        string         `json:"id"`
+	PID       int            `json:"pid"` // Processo che sta applicando le modifiche
+	Dir       string         `json:"dir"`
+	Started   time.Time      `json:"started"`
+	Files     []journalEntry `json:"files"`
+	Dirs      []string       `json:"dirs"`      // Directory da creare, dalla più esterna
+	Committed bool           `json:"committed"` // Tutte le modifiche sono state scritte
+}
+
+// journalEntry è un file toccato dall'applicazione
+type journalEntry struct {
+	Path    string      `json:"path"`
+	Staged  string      `json:"staged,omitempty"` // Nuovo contenuto, da rinominare su Path
+	Existed bool        `json:"existed"`
+	Backup  string      `json:"backup,omitempty"` // Copia del contenuto originale, nel journal
+	Mode    os.FileMode `json:"mode"`
+}
+
+func newJournal(dir string) (*journal, error) {
+	id := fmt.Sprintf("%d-%d", time.Now().UnixNano(), os.Getpid())
+	j := &journal{path: project.StatePath(journalDir, id), ID: id, PID: os.Getpid(), Dir: dir, Started: time.Now()}
+	if err := os.MkdirAll(j.path, 0755); err != nil {
+		return nil, fmt.Errorf("errore durante la creazione del journal: %v", err)
+	}
+	return j, nil
+}
+
+// stagingPath restituisce il file in cui preparare il nuovo contenuto di path:
+// nella stessa directory, così che la rinomina sia atomica
+func (j *journal) stagingPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".isy-"+j.ID)
+}
+
+// add registra un file prima che venga toccato, copiandone il contenuto originale
+func (j *journal) add(path string, write bool) error {
+	entry := journalEntry{Path: path}
+	if write {
+		entry.Staged = j.stagingPath(path)
+	}
+
+	info, err := os.Stat(path)
+	switch {
+	case err == nil:
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("errore durante la lettura di %s: %v", path, err)
+		}
+		entry.Existed, entry.Mode = true, info.Mode().Perm()
+		entry.Backup = strconv.Itoa(len(j.Files))
+		if err := os.WriteFile(filepath.Join(j.path, entry.Backup), content, 0600); err != nil {
+			return fmt.Errorf("errore durante la copia di %s nel journal: %v", path, err)
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("errore durante la lettura di %s: %v", path, err)
+	}
+	j.Files = append(j.Files, entry)
+	return nil
+}
+
+// addDirs registra le directory di path che non esistono ancora
+func (j *journal) addDirs(path string) {
+	var missing []string
+	for current := path; ; current = filepath.Dir(current) {
+		if _, err := os.Stat(current); err == nil || filepath.Dir(current) == current {
+			break
+		}
+		missing = append(missing, current)
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if !containsPath(j.Dirs, missing[i]) {
+			j.Dirs = append(j.Dirs, missing[i])
+		}
+	}
+}
+
+// save scrive il journal su disco, prima di toccare qualsiasi file
+func (j *journal) save() error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return fmt.Errorf("errore durante la serializzazione del journal: %v", err)
+	}
+	// Scritto accanto e rinominato, così da non restare mai a metà
+	path := filepath.Join(j.path, journalFile)
+	if err := writeSynced(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("errore durante la scrittura del journal: %v", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("errore durante la scrittura del journal: %v", err)
+	}
+	return nil
+}
+
+// rollback riporta i file allo stato registrato nel journal. Va bene in
+// qualsiasi punto dell'applicazione: i file non ancora toccati restano uguali.
+func (j *journal) rollback() error {
+	var failures []string
+	for i := len(j.Files) - 1; i >= 0; i-- {
+		entry := j.Files[i]
+		if entry.Staged != "" {
+			if err := os.Remove(entry.Staged); err != nil && !os.IsNotExist(err) {
+				failures = append(failures, err.Error())
+			}
+		}
+		if !entry.Existed {
+			if err := os.Remove(entry.Path); err != nil && !os.IsNotExist(err) {
+				failures = append(failures, err.Error())
+			}
+			continue
+		}
+		if err := j.restore(entry); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	// Restano le directory che contengono altri file
+	for i := len(j.Dirs) - 1; i >= 0; i-- {
+		os.Remove(j.Dirs[i])
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// restore riscrive un file dalla sua copia nel journal
+func (j *journal) restore(entry journalEntry) error {
+	content, err := os.ReadFile(filepath.Join(j.path, entry.Backup))
+	if err != nil {
+		return fmt.Errorf("copia di %s non leggibile: %v", entry.Path, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(entry.Path), 0755); err != nil {
+		return fmt.Errorf("errore durante il ripristino di %s: %v", entry.Path, err)
+	}
+	if err := os.WriteFile(entry.Path, content, entry.Mode); err != nil {
+		return fmt.Errorf("errore durante il ripristino di %s: %v", entry.Path, err)
+	}
+	if err := os.Chmod(entry.Path, entry.Mode); err != nil {
+		return fmt.Errorf("errore durante il ripristino dei permessi di %s: %v", entry.Path, err)
+	}
+	return nil
+}
+
+// remove cancella il journal, ad applicazione conclusa o annullata
+func (j *journal) remove() {
+	os.RemoveAll(j.path)
+}
+
+// Recover annulla le applicazioni interrotte da un crash o da Ctrl+C, di cui è
+// rimasto il journal, e restituisce le directory ripristinate. I journal di un
+// processo ancora in esecuzione vengono lasciati.
+func Recover() ([]string, error) {
+	entries, err := os.ReadDir(project.StatePath(journalDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("errore durante la lettura dei journal: %v", err)
+	}
+
+	var recovered []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		path := project.StatePath(journalDir, entry.Name())
+		data, err := os.ReadFile(filepath.Join(path, journalFile))
+		if err != nil {
+			// Interrotto prima di scrivere il journal: nessun file è stato toccato
+			os.RemoveAll(path)
+			continue
+		}
+		j := &journal{path: path}
+		if err := json.Unmarshal(data, j); err != nil {
+			return recovered, fmt.Errorf("journal %s non valido: %v", path, err)
+		}
+		if j.PID != os.Getpid() && processRunning(j.PID) {
+			continue
+		}
+		if j.Committed {
+			// Interrotto dopo aver scritto tutto: resta solo da rimuovere il journal
+			j.remove()
+			continue
+		}
+		if _, err := os.Stat(j.Dir); os.IsNotExist(err) {
+			// La directory non c'è più, ad esempio quella di un'anteprima
+			j.remove()
+			continue
+		}
+		if err := j.rollback(); err != nil {
+			return recovered, fmt.Errorf("errore durante il ripristino di %s: %v", j.Dir, err)
+		}
+		j.remove()
+		recovered = append(recovered, j.Dir)
+	}
+	return recovered, nil
+}
+
+// processRunning indica se il processo esiste ancora
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+// writeSynced scrive un file e attende che sia su disco
+func writeSynced(path string, data []byte, mode os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func containsPath(paths []string, path string) bool {
+	for _, candidate := range paths {
+		if candidate == path {
+			return true
+		}
+	}
+	return false
+}
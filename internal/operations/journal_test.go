@@ -0,0 +1,268 @@
+package operations
+
+import (
+	"isy-cli/internal/project"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupProject crea un progetto vuoto e vi sposta il processo
+func setupProject(t *testing.T) string {
+	t.Helper()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, project.DirName), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := project.Setup(root, false); err != nil {
+		t.Fatal(err)
+	}
+	return project.Root()
+}
+
+// Contenuto dei file prima dell'applicazione; "" indica un file che non esiste
+var journalOriginal = map[string]string{
+	"a.txt":           "a originale\n",
+	"b.txt":           "b originale\n",
+	"gone.txt":        "da rimuovere\n",
+	"nuova/sub/c.txt": "",
+}
+
+// Contenuto dei file scritti dall'applicazione; gone.txt viene rimosso
+var journalUpdate = map[string]string{
+	"a.txt":           "a modificato\n",
+	"b.txt":           "b modificato\n",
+	"nuova/sub/c.txt": "c nuovo\n",
+}
+
+// Fasi di commit in cui l'applicazione può essere interrotta
+const (
+	stageJournal   = iota // Journal scritto, nessun file toccato
+	stageStaged           // Nuovi contenuti preparati accanto ai file
+	stageRenamed          // Solo a.txt rinominato al suo posto
+	stageWritten          // Tutti i file scritti e rimossi, journal non ancora concluso
+	stageCommitted        // Journal concluso, non ancora rimosso
+)
+
+// interruptedApply ripete i passi di commit fino alla fase indicata e lascia
+// il journal su disco, come dopo un crash
+func interruptedApply(t *testing.T, dir string, stage int) *journal {
+	t.Helper()
+	for name, content := range journalOriginal {
+		if content == "" {
+			continue
+		}
+		mode := os.FileMode(0644)
+		if name == "a.txt" {
+			mode = 0755
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	j, err := newJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writes := []string{"a.txt", "b.txt", "nuova/sub/c.txt"}
+	for _, name := range writes {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		j.addDirs(filepath.Dir(path))
+		if err := j.add(path, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gone := filepath.Join(dir, "gone.txt")
+	if err := j.add(gone, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.save(); err != nil {
+		t.Fatal(err)
+	}
+	if stage == stageJournal {
+		return j
+	}
+
+	for _, path := range j.Dirs {
+		if err := os.Mkdir(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range writes {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.WriteFile(j.stagingPath(path), []byte(journalUpdate[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stage == stageStaged {
+		return j
+	}
+
+	for i, name := range writes {
+		if stage == stageRenamed && i > 0 {
+			return j
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.Rename(j.stagingPath(path), path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Remove(gone); err != nil {
+		t.Fatal(err)
+	}
+	if stage == stageWritten {
+		return j
+	}
+
+	j.Committed = true
+	if err := j.save(); err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+// checkFiles controlla che i file della directory abbiano il contenuto atteso
+func checkFiles(t *testing.T, dir string, want map[string]string) {
+	t.Helper()
+	for name, content := range want {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		switch {
+		case content == "" && !os.IsNotExist(err):
+			t.Errorf("%s esiste ancora (%q, %v)", name, data, err)
+		case content != "" && err != nil:
+			t.Errorf("%s: %v", name, err)
+		case content != "" && string(data) != content:
+			t.Errorf("%s = %q, atteso %q", name, data, content)
+		}
+	}
+}
+
+// checkClean controlla che non siano rimasti file temporanei né journal
+func checkClean(t *testing.T, dir string) {
+	t.Helper()
+	matches, _ := filepath.Glob(filepath.Join(dir, ".*.isy-*"))
+	if len(matches) > 0 {
+		t.Errorf("file temporanei rimasti: %v", matches)
+	}
+	entries, _ := os.ReadDir(project.StatePath(journalDir))
+	if len(entries) > 0 {
+		t.Errorf("journal rimasti: %d", len(entries))
+	}
+}
+
+func TestRecoverInterruptedApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		stage int
+	}{
+		{"prima di toccare i file", stageJournal},
+		{"con i nuovi contenuti preparati", stageStaged},
+		{"a metà delle rinomine", stageRenamed},
+		{"con tutti i file scritti", stageWritten},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setupProject(t)
+			dir := filepath.Join(root, "branch")
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			interruptedApply(t, dir, tt.stage)
+
+			recovered, err := Recover()
+			if err != nil {
+				t.Fatalf("Recover: %v", err)
+			}
+			if len(recovered) != 1 || recovered[0] != dir {
+				t.Fatalf("Recover = %v, atteso [%s]", recovered, dir)
+			}
+
+			checkFiles(t, dir, journalOriginal)
+			if info, err := os.Stat(filepath.Join(dir, "a.txt")); err == nil && info.Mode().Perm() != 0755 {
+				t.Errorf("permessi di a.txt = %v, attesi 0755", info.Mode().Perm())
+			}
+			if _, err := os.Stat(filepath.Join(dir, "nuova")); !os.IsNotExist(err) {
+				t.Errorf("la directory creata dall'applicazione esiste ancora (%v)", err)
+			}
+			checkClean(t, dir)
+		})
+	}
+}
+
+func TestRecoverCommittedApply(t *testing.T) {
+	root := setupProject(t)
+	dir := filepath.Join(root, "branch")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	interruptedApply(t, dir, stageCommitted)
+
+	recovered, err := Recover()
+	if err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	if len(recovered) != 0 {
+		t.Fatalf("Recover = %v, nessun ripristino atteso", recovered)
+	}
+
+	// Le modifiche concluse restano; resta solo da togliere il journal
+	want := map[string]string{"gone.txt": ""}
+	for name, content := range journalUpdate {
+		want[name] = content
+	}
+	checkFiles(t, dir, want)
+	checkClean(t, dir)
+}
+
+func TestRecoverSkipsRunningProcess(t *testing.T) {
+	root := setupProject(t)
+	dir := filepath.Join(root, "branch")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	j := interruptedApply(t, dir, stageRenamed)
+	j.PID = os.Getppid() // Un processo diverso ancora in esecuzione
+	if err := j.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	recovered, err := Recover()
+	if err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	if len(recovered) != 0 {
+		t.Fatalf("Recover = %v, il journal di un processo in esecuzione va lasciato", recovered)
+	}
+	if _, err := os.Stat(filepath.Join(j.path, journalFile)); err != nil {
+		t.Fatalf("journal rimosso: %v", err)
+	}
+}
+
+func TestRecoverWithoutJournalFile(t *testing.T) {
+	root := setupProject(t)
+	dir := filepath.Join(root, "branch")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Interrotto dopo aver creato la directory del journal ma prima di scriverlo
+	if _, err := newJournal(dir); err != nil {
+		t.Fatal(err)
+	}
+	recovered, err := Recover()
+	if err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	if len(recovered) != 0 {
+		t.Fatalf("Recover = %v, nessun ripristino atteso", recovered)
+	}
+	checkClean(t, dir)
+}
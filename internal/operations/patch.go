@@ -0,0 +1,110 @@
+package operations
+
+import (
+	"fmt"
+	"isy-cli/internal/diff"
+	"isy-cli/internal/openai/schemas/code"
+	"strings"
+)
+
+// ApplyPatch applica una patch unified diff nella directory indicata (il branch).
+// La patch viene prima applicata in memoria: se un file non si applica non viene
+// toccato nulla. Le note del Change descrivono gli hunk applicati con offset o fuzz.
+func ApplyPatch(dir, patch string) (*Change, error) {
+	return Apply(dir, code.CodeModificationResponse{Patch: patch})
+}
+
+// patch applica in memoria una patch, file per file
+func (p *plan) patch(text string) []Problem {
+	patches, err := diff.Parse(text)
+	if err != nil {
+		return []Problem{{Operation: "patch", Message: err.Error()}}
+	}
+
+	var problems []Problem
+	for i, filePatch := range patches {
+		notes, err := p.filePatch(filePatch)
+		for _, note := range notes {
+			p.notes = append(p.notes, fmt.Sprintf("%s: %s", filePatch.Path(), note))
+		}
+		if err != nil {
+			problems = append(problems, Problem{Step: i + 1, Operation: filePatch.Status(), Path: filePatch.Path(), Message: err.Error()})
+		}
+	}
+	return problems
+}
+
+func (p *plan) filePatch(patch diff.FilePatch) ([]string, error) {
+	if patch.Binary {
+		return nil, fmt.Errorf("le patch di file binari non sono supportate")
+	}
+
+	var oldFile, newFile *plannedFile
+	var err error
+	if patch.OldPath != "" {
+		if oldFile, err = p.file(patch.OldPath); err != nil {
+			return nil, err
+		}
+		if !oldFile.exists {
+			return nil, fmt.Errorf("il file %s non esiste", patch.OldPath)
+		}
+	}
+	if patch.NewPath != "" {
+		if newFile, err = p.file(patch.NewPath); err != nil {
+			return nil, err
+		}
+		if newFile != oldFile && newFile.exists {
+			return nil, fmt.Errorf("il file %s esiste già", patch.NewPath)
+		}
+	}
+
+	// Il contenuto di partenza: vuoto per un file creato
+	content := ""
+	if oldFile != nil {
+		content = oldFile.update
+	}
+	updated, notes, err := patch.Apply(content)
+	if err != nil {
+		return notes, err
+	}
+
+	if newFile == nil {
+		// Un file rimosso deve corrispondere alla patch, senza righe rimaste
+		if strings.TrimSpace(updated) != "" {
+			return notes, fmt.Errorf("la patch non rimuove tutto il contenuto del file")
+		}
+		oldFile.remove()
+		return notes, nil
+	}
+
+	switch {
+	case oldFile == nil:
+		newFile.create(updated)
+	case oldFile == newFile:
+		newFile.update = updated
+	default:
+		// Nelle rinomine il file conserva permessi e formato, il vecchio viene rimosso
+		newFile.exists, newFile.update, newFile.mode, newFile.format = true, updated, oldFile.mode, oldFile.format
+		oldFile.remove()
+	}
+	return notes, nil
+}
+
+// PatchFiles restituisce i percorsi toccati da una patch, compresi quelli di
+// partenza dei file rinominati
+func PatchFiles(patch string) ([]string, error) {
+	patches, err := diff.Parse(patch)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, filePatch := range patches {
+		if filePatch.OldPath != "" {
+			files = append(files, filePatch.OldPath)
+		}
+		if filePatch.NewPath != "" && filePatch.NewPath != filePatch.OldPath {
+			files = append(files, filePatch.NewPath)
+		}
+	}
+	return files, nil
+}
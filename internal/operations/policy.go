@@ -0,0 +1,107 @@
+package operations
+
+import (
+	"fmt"
+	"isy-cli/internal/diff"
+	"isy-cli/internal/openai/schemas/code"
+	"isy-cli/internal/policy"
+	"path/filepath"
+)
+
+// Operazioni dei passi corrispondenti allo stato dei file di una patch
+var patchOperations = map[string]string{
+	"added":    "create",
+	"deleted":  "delete",
+	"renamed":  "rename",
+	"modified": "edit",
+}
+
+// Touched restituisce i file e le directory (con "/" finale) che una risposta
+// modificherebbe, senza toccarli, come in Change.Files
+func Touched(dir string, response code.CodeModificationResponse) ([]string, *PlanError) {
+	p, err := simulate(dir, response)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, key := range p.dirs {
+		paths = append(paths, key+"/")
+	}
+	for _, key := range p.order {
+		if p.files[key].changed() {
+			paths = append(paths, key)
+		}
+	}
+	return paths, nil
+}
+
+// checkPolicy controlla che un piano già eseguito in memoria rispetti la policy:
+// operazioni vietate, percorsi protetti e limiti per turno
+func (p *plan) checkPolicy(pol *policy.Policy, response code.CodeModificationResponse) []Problem {
+	if pol == nil {
+		return nil
+	}
+
+	var problems []Problem
+	check := func(where Problem, operation string, paths ...string) {
+		if pol.Forbids(operation) {
+			where.Message = fmt.Sprintf("l'operazione %s è vietata dalla policy del progetto", operation)
+			problems = append(problems, where)
+			return
+		}
+		for _, path := range paths {
+			if path == "" {
+				continue
+			}
+			key := filepath.ToSlash(filepath.Clean(filepath.FromSlash(path)))
+			if rule := pol.ProtectedBy(key, operation == "mkdir"); rule != nil {
+				where.Message = fmt.Sprintf("%s è protetto dalla policy del progetto (%s) e non può essere modificato", key, rule.Text)
+				problems = append(problems, where)
+				return
+			}
+		}
+	}
+
+	if response.Patch != "" {
+		patches, _ := diff.Parse(response.Patch)
+		for i, filePatch := range patches {
+			where := Problem{Step: i + 1, Operation: filePatch.Status(), Path: filePatch.Path()}
+			check(where, patchOperations[filePatch.Status()], filePatch.OldPath, filePatch.NewPath)
+		}
+	} else {
+		for i, step := range response.Steps {
+			where := Problem{Step: i + 1, Operation: step.OperationType, Path: step.FilePath}
+			check(where, step.OperationType, step.FilePath, step.NewPath)
+		}
+	}
+
+	files, lines := 0, 0
+	for _, key := range p.order {
+		file := p.files[key]
+		if !file.changed() {
+			continue
+		}
+		files++
+		lines += changedLines(file.original, file.update)
+	}
+	if pol.MaxFiles > 0 && files > pol.MaxFiles {
+		problems = append(problems, Problem{Message: fmt.Sprintf("modifica %d file, la policy del progetto ne consente al massimo %d per turno: limita le modifiche a quelle necessarie", files, pol.MaxFiles)})
+	}
+	if pol.MaxLines > 0 && lines > pol.MaxLines {
+		problems = append(problems, Problem{Message: fmt.Sprintf("aggiunge o rimuove %d righe, la policy del progetto ne consente al massimo %d per turno: limita le modifiche a quelle necessarie", lines, pol.MaxLines)})
+	}
+	return problems
+}
+
+// changedLines conta le righe aggiunte e rimosse tra due versioni di un file
+func changedLines(original, update string) int {
+	a, _ := diff.SplitLines(original)
+	b, _ := diff.SplitLines(update)
+	count := 0
+	for _, op := range diff.Lines(a, b) {
+		if op.Kind != diff.Equal {
+			count++
+		}
+	}
+	return count
+}
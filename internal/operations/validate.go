@@ -0,0 +1,299 @@
+package operations
+
+import (
+	"fmt"
+	"isy-cli/internal/openai/schemas/code"
+	"isy-cli/internal/policy"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Problem è un errore di una risposta trovato prima di toccare i file
+type Problem struct {
+	Step      int    // Passo (da 1); per le patch il file nella patch (da 1)
+	Operation string // Tipo di operazione, o lo stato del file per le patch
+	Path      string
+	Edit      int // Modifica nel passo (da 1), 0 se il problema riguarda tutto il passo
+	Message   string
+}
+
+// where descrive il punto della risposta a cui si riferisce il problema; in
+// inglese (english) per il resoconto destinato al modello
+func (p Problem) where(patch, english bool) string {
+	if p.Path == "" && p.Step == 0 {
+		if english {
+			return "the response"
+		}
+		return "la risposta"
+	}
+	if patch {
+		return fmt.Sprintf("%s %s", p.Operation, p.Path)
+	}
+	step, edit := "passo", "modifica"
+	if english {
+		step, edit = "step", "edit"
+	}
+	where := fmt.Sprintf("%s %d (%s %s)", step, p.Step, p.Operation, p.Path)
+	if p.Edit > 0 {
+		where += fmt.Sprintf(", %s %d", edit, p.Edit)
+	}
+	return where
+}
+
+// PlanError raccoglie tutti i problemi di una risposta: nessun file è stato toccato
+type PlanError struct {
+	Patch    bool // La risposta è una patch
+	Problems []Problem
+}
+
+func (e *PlanError) Error() string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("le modifiche proposte non sono valide (%d problemi):", len(e.Problems)))
+	for _, problem := range e.Problems {
+		builder.WriteString(fmt.Sprintf("\n  - %s: %s", problem.where(e.Patch, false), problem.Message))
+	}
+	return builder.String()
+}
+
+// Report descrive i problemi al modello, perché possa correggere la risposta
+func (e *PlanError) Report() string {
+	var builder strings.Builder
+	builder.WriteString("Your modifications were NOT applied because they have the following problems:\n")
+	for _, problem := range e.Problems {
+		builder.WriteString(fmt.Sprintf("- %s: %s\n", problem.where(e.Patch, true), problem.Message))
+	}
+	if e.Patch {
+		builder.WriteString("\nNo file was changed. Answer again with the complete corrected patch, based on the files as they are now.")
+	} else {
+		builder.WriteString("\nNo file was changed. Answer again with the complete corrected list of steps, including the steps without problems, based on the files as they are now.")
+	}
+	return builder.String()
+}
+
+// Validate controlla una risposta senza toccare i file: i passi vengono eseguiti
+// su una copia in memoria dei file coinvolti e il risultato viene confrontato con
+// la policy del progetto (nil = nessun limite). Restituisce nil se la risposta
+// si può applicare.
+func Validate(dir string, response code.CodeModificationResponse, pol *policy.Policy) *PlanError {
+	p, err := simulate(dir, response)
+	if err != nil {
+		return err
+	}
+	if problems := p.checkPolicy(pol, response); len(problems) > 0 {
+		return &PlanError{Patch: response.Patch != "", Problems: problems}
+	}
+	return nil
+}
+
+// plan è lo stato dei file toccati da una risposta, dopo averne eseguito i passi in memoria
+type plan struct {
+	dir   string
+	files map[string]*plannedFile
+	order []string // Percorsi nell'ordine in cui vengono toccati
+	dirs  []string // Directory da creare
+	notes []string // Modifiche applicate in modo approssimato
+}
+
+// plannedFile è un file toccato da una risposta, prima e dopo i passi. Il
+// contenuto è il testo con i soli \n; format ne conserva la forma su disco.
+type plannedFile struct {
+	path               string // Percorso nella directory
+	existed, exists    bool
+	original, update   string
+	originalMode, mode os.FileMode
+	format             textFormat
+}
+
+// changed indica se i passi hanno cambiato il file
+func (f *plannedFile) changed() bool {
+	return f.exists != f.existed || f.update != f.original || (f.exists && f.mode != f.originalMode)
+}
+
+// create rende il file un nuovo file di testo con il contenuto indicato
+func (f *plannedFile) create(content string) {
+	f.exists, f.update, f.mode, f.format = true, content, DefaultMode, textFormat{}
+}
+
+// remove rende il file rimosso
+func (f *plannedFile) remove() {
+	f.exists, f.update = false, ""
+}
+
+// simulate esegue i passi di una risposta in memoria e ne raccoglie tutti i problemi
+func simulate(dir string, response code.CodeModificationResponse) (*plan, *PlanError) {
+	p := &plan{dir: dir, files: make(map[string]*plannedFile)}
+	if response.Patch != "" {
+		problems := p.patch(response.Patch)
+		if len(problems) > 0 {
+			return p, &PlanError{Patch: true, Problems: problems}
+		}
+		return p, nil
+	}
+
+	var problems []Problem
+	for i, step := range response.Steps {
+		for _, problem := range p.step(step) {
+			problem.Step = i + 1
+			problem.Operation = step.OperationType
+			problem.Path = step.FilePath
+			problems = append(problems, problem)
+		}
+	}
+	if len(problems) > 0 {
+		return p, &PlanError{Problems: problems}
+	}
+	return p, nil
+}
+
+// step esegue in memoria un passo; un passo con problemi non cambia lo stato
+func (p *plan) step(step code.CodeModificationStep) []Problem {
+	switch step.OperationType {
+	case "create", "delete", "edit", "rename", "move", "mkdir":
+	default:
+		return []Problem{{Message: fmt.Sprintf("operazione sconosciuta %q (usa create, delete, edit, rename, move o mkdir)", step.OperationType)}}
+	}
+
+	var mode os.FileMode
+	if step.Mode != "" {
+		if step.OperationType == "delete" || step.OperationType == "mkdir" {
+			return []Problem{{Message: "mode si indica solo per create, edit, rename e move"}}
+		}
+		var err error
+		if mode, err = parseMode(step.Mode); err != nil {
+			return []Problem{{Message: err.Error()}}
+		}
+	}
+
+	if step.OperationType == "mkdir" {
+		if err := p.mkdir(step.FilePath); err != nil {
+			return []Problem{{Message: err.Error()}}
+		}
+		return nil
+	}
+
+	file, err := p.file(step.FilePath)
+	if err != nil {
+		return []Problem{{Message: err.Error()}}
+	}
+
+	switch step.OperationType {
+	case "create":
+		if file.exists {
+			return []Problem{{Message: "il file esiste già: usa edit per modificarlo"}}
+		}
+		var content strings.Builder
+		for _, edit := range step.Edits {
+			content.WriteString(edit.NewCode)
+		}
+		file.create(content.String())
+	case "delete":
+		if !file.exists {
+			return []Problem{{Message: "il file non esiste"}}
+		}
+		file.remove()
+	case "rename", "move":
+		if !file.exists {
+			return []Problem{{Message: "il file non esiste"}}
+		}
+		if step.NewPath == "" {
+			return []Problem{{Message: "manca new_path con la destinazione"}}
+		}
+		target, err := p.file(step.NewPath)
+		switch {
+		case err != nil:
+			return []Problem{{Message: fmt.Sprintf("destinazione non valida: %v", err)}}
+		case target == file:
+			return []Problem{{Message: "la destinazione coincide con il file"}}
+		case target.exists:
+			return []Problem{{Message: fmt.Sprintf("la destinazione %s esiste già", step.NewPath)}}
+		}
+		// Il file spostato conserva contenuto, permessi e formato
+		target.exists, target.update, target.mode, target.format = true, file.update, file.mode, file.format
+		file.remove()
+		file = target
+	case "edit":
+		if !file.exists {
+			return []Problem{{Message: "il file non esiste: usa create per crearlo"}}
+		}
+		if len(step.Edits) == 0 && step.Mode == "" {
+			return []Problem{{Message: "il passo non contiene modifiche"}}
+		}
+		updated, failures := spliceEdits(file.update, step.Edits)
+		if len(failures) > 0 {
+			problems := make([]Problem, 0, len(failures))
+			for _, failure := range failures {
+				problems = append(problems, Problem{Edit: failure.edit, Message: failure.err.Error()})
+			}
+			return problems
+		}
+		file.update = updated
+	}
+
+	if step.Mode != "" {
+		file.mode = mode
+	}
+	return nil
+}
+
+// mkdir registra una directory da creare; una directory che esiste già va bene
+func (p *plan) mkdir(relPath string) error {
+	path, err := resolve(p.dir, relPath)
+	if err != nil {
+		return err
+	}
+	key := filepath.ToSlash(filepath.Clean(filepath.FromSlash(relPath)))
+	if file, ok := p.files[key]; ok && file.exists {
+		return fmt.Errorf("esiste già un file %s", relPath)
+	}
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && info.IsDir():
+		return nil
+	case err == nil:
+		return fmt.Errorf("esiste già un file %s", relPath)
+	case !os.IsNotExist(err):
+		return fmt.Errorf("errore durante la lettura di %s: %v", relPath, err)
+	}
+	for _, dir := range p.dirs {
+		if dir == key {
+			return nil
+		}
+	}
+	p.dirs = append(p.dirs, key)
+	return nil
+}
+
+// file restituisce lo stato corrente di un file, leggendolo alla prima richiesta
+func (p *plan) file(relPath string) (*plannedFile, error) {
+	path, err := resolve(p.dir, relPath)
+	if err != nil {
+		return nil, err
+	}
+	key := filepath.ToSlash(filepath.Clean(filepath.FromSlash(relPath)))
+	if file, ok := p.files[key]; ok {
+		return file, nil
+	}
+
+	file := &plannedFile{path: path, originalMode: DefaultMode, mode: DefaultMode}
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && info.IsDir():
+		return nil, fmt.Errorf("%s è una directory", relPath)
+	case err == nil:
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("errore durante la lettura del file: %v", err)
+		}
+		text, format := decodeText(string(content))
+		file.existed, file.exists = true, true
+		file.original, file.update = text, text
+		file.originalMode, file.mode = info.Mode().Perm(), info.Mode().Perm()
+		file.format = format
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("errore durante la lettura del file: %v", err)
+	}
+	p.files[key] = file
+	p.order = append(p.order, key)
+	return file, nil
+}
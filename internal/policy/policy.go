@@ -0,0 +1,147 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"isy-cli/internal/context"
+	"isy-cli/internal/project"
+	"os"
+	"strings"
+)
+
+// File è il file della policy, dentro .isy
+const File = "policy.json"
+
+// Operazioni che si possono vietare, come nei passi delle risposte di code
+var Operations = []string{"create", "delete", "edit", "rename", "move", "mkdir"}
+
+// Policy limita le modifiche che isy code può applicare al branch. I percorsi
+// seguono la sintassi di .isycontext: vince l'ultima regola, "!" esclude.
+type Policy struct {
+	Protected           []string `json:"protected"`            // Percorsi che il modello non può toccare
+	Confirm             []string `json:"confirm"`              // Percorsi che si applicano solo dopo una conferma
+	MaxFiles            int      `json:"max_files"`            // File modificati per turno (0 = nessun limite)
+	MaxLines            int      `json:"max_lines"`            // Righe aggiunte e rimosse per turno (0 = nessun limite)
+	ForbiddenOperations []string `json:"forbidden_operations"` // Es. delete
+
+	protected *context.RuleSet
+	confirm   *context.RuleSet
+}
+
+// Load legge la policy del progetto; senza file la policy non pone limiti
+func Load() (*Policy, error) {
+	path := project.StatePath(File)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Parse(nil, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore durante la lettura della policy %s: %v", path, err)
+	}
+	return Parse(data, path)
+}
+
+// Parse decodifica e controlla una policy; source è il nome usato negli errori
+func Parse(data []byte, source string) (*Policy, error) {
+	p := &Policy{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, p); err != nil {
+			return nil, fmt.Errorf("errore durante la decodifica della policy %s: %v", source, err)
+		}
+	}
+
+	if p.MaxFiles < 0 || p.MaxLines < 0 {
+		return nil, fmt.Errorf("policy %s non valida: max_files e max_lines non possono essere negativi", source)
+	}
+	for _, operation := range p.ForbiddenOperations {
+		if !contains(Operations, operation) {
+			return nil, fmt.Errorf("policy %s non valida: operazione sconosciuta %q in forbidden_operations (usa %s)", source, operation, strings.Join(Operations, ", "))
+		}
+	}
+
+	var err error
+	if p.protected, err = context.NewRuleSet(p.Protected, source+" (protected)"); err != nil {
+		return nil, fmt.Errorf("policy %s non valida: %v", source, err)
+	}
+	if p.confirm, err = context.NewRuleSet(p.Confirm, source+" (confirm)"); err != nil {
+		return nil, fmt.Errorf("policy %s non valida: %v", source, err)
+	}
+	return p, nil
+}
+
+// Forbids indica se la policy vieta un'operazione
+func (p *Policy) Forbids(operation string) bool {
+	return p != nil && contains(p.ForbiddenOperations, operation)
+}
+
+// ProtectedBy restituisce la regola che protegge un percorso, nil se il
+// percorso si può modificare
+func (p *Policy) ProtectedBy(relPath string, isDir bool) *context.Rule {
+	if p == nil {
+		return nil
+	}
+	return selectedBy(p.protected, relPath, isDir)
+}
+
+// NeedsConfirmation restituisce i percorsi che richiedono una conferma prima di
+// essere modificati
+func (p *Policy) NeedsConfirmation(relPaths []string) []string {
+	if p == nil {
+		return nil
+	}
+	var paths []string
+	for _, relPath := range relPaths {
+		isDir := strings.HasSuffix(relPath, "/")
+		if selectedBy(p.confirm, strings.TrimSuffix(relPath, "/"), isDir) != nil {
+			paths = append(paths, relPath)
+		}
+	}
+	return paths
+}
+
+// Describe spiega al modello i limiti della policy, "" se non ce ne sono
+func (p *Policy) Describe() string {
+	if p == nil {
+		return ""
+	}
+	var lines []string
+	if len(p.Protected) > 0 {
+		lines = append(lines, "- Never modify these protected paths (.gitignore syntax): "+strings.Join(p.Protected, ", "))
+	}
+	if len(p.ForbiddenOperations) > 0 {
+		lines = append(lines, "- These operations are forbidden: "+strings.Join(p.ForbiddenOperations, ", "))
+	}
+	if p.MaxFiles > 0 {
+		lines = append(lines, fmt.Sprintf("- Modify at most %d files per answer", p.MaxFiles))
+	}
+	if p.MaxLines > 0 {
+		lines = append(lines, fmt.Sprintf("- Add or remove at most %d lines per answer", p.MaxLines))
+	}
+	if len(p.Confirm) > 0 {
+		lines = append(lines, "- Changes to these paths are applied only after the user confirms them: "+strings.Join(p.Confirm, ", "))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "Project policy for your modifications (answers that break it are rejected):\n" + strings.Join(lines, "\n")
+}
+
+// selectedBy restituisce l'ultima regola che seleziona il percorso
+func selectedBy(rules *context.RuleSet, relPath string, isDir bool) *context.Rule {
+	if rules == nil {
+		return nil
+	}
+	if rule := rules.Match(relPath, isDir); rule != nil && !rule.Negate {
+		return rule
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package project
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// DirName è la directory con lo stato di isy, che identifica la radice del progetto
+	DirName = ".isy"
+	// ContextFile è il file con le regole del contesto, nella radice del progetto
+	ContextFile = ".isycontext"
+)
+
+// Directory che isy non legge e non copia mai: il suo stato e quello di git
+var skippedDirs = map[string]bool{
+	DirName: true,
+	".git":  true,
+}
+
+var (
+	root   string // Radice del progetto (assoluta)
+	subdir string // Directory da cui è stato lanciato il comando, relativa alla radice
+	found  bool   // La radice contiene una directory .isy
+)
+
+// Discover risale da start fino alla directory più vicina che contiene .isy,
+// come fa git con .git
+func Discover(start string) (string, bool) {
+	dir, err := filepath.Abs(start)
+	if err != nil {
+		return start, false
+	}
+
+	for {
+		if info, err := os.Stat(filepath.Join(dir, DirName)); err == nil && info.IsDir() {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// Setup individua la radice del progetto e vi sposta il processo, così che i
+// percorsi relativi alla radice (file del contesto, branch) restino validi da
+// qualsiasi sottodirectory. Con override la radice è quella indicata; con
+// discover=false (come per init) è la directory corrente.
+func Setup(override string, discover bool) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("impossibile determinare la directory corrente: %v", err)
+	}
+
+	switch {
+	case override != "":
+		root, err = filepath.Abs(override)
+		if err != nil {
+			return fmt.Errorf("radice non valida %s: %v", override, err)
+		}
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			return fmt.Errorf("la radice %s non è una directory", override)
+		}
+		_, err := os.Stat(filepath.Join(root, DirName))
+		found = err == nil
+	case discover:
+		root, found = Discover(cwd)
+		if !found {
+			root = cwd
+		}
+	default:
+		root = cwd
+		_, err := os.Stat(filepath.Join(root, DirName))
+		found = err == nil
+	}
+
+	subdir = ""
+	if rel, err := filepath.Rel(root, cwd); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		subdir = filepath.ToSlash(rel)
+	}
+
+	if err := os.Chdir(root); err != nil {
+		return fmt.Errorf("impossibile spostarsi nella radice del progetto %s: %v", root, err)
+	}
+	return nil
+}
+
+// Root restituisce la radice del progetto. Prima di Setup è la directory corrente.
+func Root() string {
+	if root == "" {
+		if cwd, err := os.Getwd(); err == nil {
+			return cwd
+		}
+		return "."
+	}
+	return root
+}
+
+// Found indica se la radice contiene già una directory .isy
+func Found() bool {
+	return found
+}
+
+// SkippedDir indica se una directory con questo nome va sempre saltata, nel
+// contesto come nelle copie e nei confronti dei branch
+func SkippedDir(name string) bool {
+	return skippedDirs[name]
+}
+
+// Path restituisce un percorso relativo alla radice del progetto
+func Path(elem ...string) string {
+	return filepath.Join(append([]string{Root()}, elem...)...)
+}
+
+// StatePath restituisce un percorso dentro la directory .isy del progetto
+func StatePath(elem ...string) string {
+	return Path(append([]string{DirName}, elem...)...)
+}
+
+// Subdir restituisce la directory da cui è stato lanciato il comando, relativa
+// alla radice e con separatori "/", oppure "" se coincide con la radice
+func Subdir() string {
+	return subdir
+}
+
+// Rel converte un percorso indicato dall'utente, relativo alla directory da cui
+// è stato lanciato il comando, in un percorso relativo alla radice del progetto
+func Rel(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(Root(), filepath.FromSlash(subdir), path)
+	}
+	rel, err := filepath.Rel(Root(), path)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s è fuori dal progetto %s", path, Root())
+	}
+	return rel, nil
+}
+
+// InSubdir indica se un percorso relativo alla radice si trova nella directory
+// da cui è stato lanciato il comando
+func InSubdir(path string) bool {
+	if subdir == "" {
+		return false
+	}
+	path = filepath.ToSlash(path)
+	return path == subdir || strings.HasPrefix(path, subdir+"/")
+}
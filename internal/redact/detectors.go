@@ -0,0 +1,209 @@
+package redact
+
+import (
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Match è un segreto trovato in un testo, tra gli indici Start ed End
+type Match struct {
+	Start int
+	End   int
+	Kind  string
+}
+
+// Detector trova segreti in un testo
+type Detector interface {
+	Find(text string) []Match
+}
+
+// RegexDetector riconosce un segreto con un'espressione regolare. Se l'espressione
+// ha gruppi, viene sostituito solo il primo gruppo (ad esempio il valore di una
+// assegnazione e non il nome della variabile).
+type RegexDetector struct {
+	Kind  string
+	Regex *regexp.Regexp
+}
+
+func (d *RegexDetector) Find(text string) []Match {
+	var matches []Match
+	for _, loc := range d.Regex.FindAllStringSubmatchIndex(text, -1) {
+		start, end := loc[0], loc[1]
+		if len(loc) >= 4 && loc[2] >= 0 {
+			start, end = loc[2], loc[3]
+		}
+		if start < end {
+			matches = append(matches, Match{Start: start, End: end, Kind: d.Kind})
+		}
+	}
+	return matches
+}
+
+// LiteralDetector riconosce valori noti, come le chiavi presenti nella configurazione
+type LiteralDetector struct {
+	Kind   string
+	Values []string
+}
+
+func (d *LiteralDetector) Find(text string) []Match {
+	var matches []Match
+	for _, value := range d.Values {
+		if len(value) < 8 {
+			continue // Valori troppo corti darebbero falsi positivi
+		}
+		for offset := 0; ; {
+			index := strings.Index(text[offset:], value)
+			if index < 0 {
+				break
+			}
+			start := offset + index
+			matches = append(matches, Match{Start: start, End: start + len(value), Kind: d.Kind})
+			offset = start + len(value)
+		}
+	}
+	return matches
+}
+
+// EntropyDetector riconosce stringhe lunghe e casuali, tipiche di token e chiavi.
+// Identificatori (es. nomi di test in CamelCase) e checksum (go.sum, integrity
+// di npm) vengono ignorati: sono lunghi e vari ma non sono segreti.
+type EntropyDetector struct {
+	Threshold float64
+	MinLength int
+}
+
+var entropyCandidate = regexp.MustCompile(`[A-Za-z0-9+/_\-=]{20,}`)
+
+// Prefissi dei checksum: "h1:" precede l'hash in go.sum, gli altri fanno parte
+// dell'integrity dei lockfile
+var checksumPrefixes = []string{"h1:", "sha1-", "sha256-", "sha384-", "sha512-"}
+
+func (d *EntropyDetector) Find(text string) []Match {
+	var matches []Match
+	for _, loc := range entropyCandidate.FindAllStringIndex(text, -1) {
+		candidate := text[loc[0]:loc[1]]
+		if len(candidate) < d.MinLength || isChecksum(text[:loc[0]], candidate) {
+			continue
+		}
+		if !looksRandom(candidate) || identifierShaped(candidate) {
+			continue
+		}
+		if shannonEntropy(candidate) >= d.Threshold {
+			matches = append(matches, Match{Start: loc[0], End: loc[1], Kind: "high-entropy-string"})
+		}
+	}
+	return matches
+}
+
+func isChecksum(before, candidate string) bool {
+	for _, prefix := range checksumPrefixes {
+		if strings.HasSuffix(before, prefix) || strings.HasPrefix(candidate, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// looksRandom scarta percorsi e nomi: un segreto mescola cifre e lettere
+// maiuscole e minuscole e non è fatto di parole separate
+func looksRandom(candidate string) bool {
+	var upper, lower, digit bool
+	for _, r := range candidate {
+		switch {
+		case 'A' <= r && r <= 'Z':
+			upper = true
+		case 'a' <= r && r <= 'z':
+			lower = true
+		case '0' <= r && r <= '9':
+			digit = true
+		}
+	}
+	if !digit || !upper || !lower {
+		return false
+	}
+	// snake_case e kebab-case lunghi sono quasi sempre nomi
+	return strings.Count(candidate, "_")+strings.Count(candidate, "-") < 3
+}
+
+// identifierShaped riconosce i nomi composti da parole, come
+// TestParseRFC3339Timestamp2024WithZone: divisi in parole (maiuscola seguita da
+// minuscole, sigle, numeri) hanno in media almeno 4 caratteri per parola, mentre
+// in una stringa casuale maiuscole, minuscole e cifre si alternano di continuo.
+func identifierShaped(candidate string) bool {
+	words := 0
+	runes := []rune(candidate)
+	for i, r := range runes {
+		if i == 0 || wordBoundary(runes[i-1], r, runes[i+1:]) {
+			words++
+		}
+	}
+	return len(runes) >= 4*words
+}
+
+// wordBoundary indica se r inizia una nuova parola dopo previous
+func wordBoundary(previous, r rune, next []rune) bool {
+	switch {
+	case !isAlphanumeric(r):
+		return false
+	case !isAlphanumeric(previous):
+		return true
+	case isDigit(previous) != isDigit(r):
+		return true
+	case isLower(previous) && isUpper(r):
+		return true
+	case isUpper(previous) && isUpper(r):
+		// Fine di una sigla: la maiuscola inizia una parola se seguita da una minuscola (RFCParser)
+		return len(next) > 0 && isLower(next[0])
+	}
+	return false
+}
+
+func isUpper(r rune) bool { return 'A' <= r && r <= 'Z' }
+func isLower(r rune) bool { return 'a' <= r && r <= 'z' }
+func isDigit(r rune) bool { return '0' <= r && r <= '9' }
+
+func isAlphanumeric(r rune) bool { return isUpper(r) || isLower(r) || isDigit(r) }
+
+func shannonEntropy(text string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range text {
+		counts[r]++
+	}
+	var entropy float64
+	length := float64(len(text))
+	for _, count := range counts {
+		p := float64(count) / length
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// DefaultDetectors restituisce i rilevatori per le credenziali più comuni
+func DefaultDetectors() []Detector {
+	patterns := []struct {
+		kind    string
+		pattern string
+	}{
+		{"private-key", `-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`},
+		{"aws-access-key", `\b((?:AKIA|ASIA)[0-9A-Z]{16})\b`},
+		{"aws-secret-key", `(?i)aws.{0,20}?(?:secret|private).{0,20}?['"=:\s]([0-9a-zA-Z/+]{40})\b`},
+		{"github-token", `\b((?:ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36,})\b`},
+		{"github-token", `\b(github_pat_[A-Za-z0-9_]{40,})\b`},
+		{"gitlab-token", `\b(glpat-[A-Za-z0-9_\-]{20,})\b`},
+		{"openai-api-key", `\b(sk-(?:proj-|svcacct-|ant-)?[A-Za-z0-9_\-]{20,})`},
+		{"stripe-key", `\b((?:sk|rk)_(?:live|test)_[A-Za-z0-9]{16,})\b`},
+		{"slack-token", `\b(xox[abposr]-[A-Za-z0-9\-]{10,})\b`},
+		{"google-api-key", `\b(AIza[0-9A-Za-z_\-]{35})\b`},
+		{"jwt", `\b(eyJ[A-Za-z0-9_\-]{10,}\.eyJ[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,})\b`},
+		{"url-credentials", `[a-zA-Z][a-zA-Z0-9+.\-]*://[^\s:/@]+:([^\s/@]+)@`},
+		{"secret-assignment", `(?i)(?:password|passwd|secret|token|api[_\-]?key|access[_\-]?key|client[_\-]?secret)["']?\s*[:=]\s*["']([^"'\s]{8,})["']`},
+		{"env-secret", `(?m)^\s*(?:export\s+)?[A-Z0-9_]*(?:PASSWORD|PASSWD|SECRET|TOKEN|API_KEY|ACCESS_KEY|PRIVATE_KEY)[A-Z0-9_]*\s*=\s*([^\s"'#]{8,})`},
+	}
+
+	detectors := make([]Detector, 0, len(patterns))
+	for _, p := range patterns {
+		detectors = append(detectors, &RegexDetector{Kind: p.kind, Regex: regexp.MustCompile(p.pattern)})
+	}
+	return detectors
+}
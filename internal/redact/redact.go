@@ -0,0 +1,262 @@
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"isy-cli/internal/config"
+	"isy-cli/internal/project"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	auditLogFile            = "redaction.log"
+	defaultEntropyThreshold = 4.0
+	defaultEntropyMinLength = 24
+)
+
+// Finding è un segreto sostituito, senza il suo valore
+type Finding struct {
+	Kind        string
+	Placeholder string
+}
+
+// Redactor sostituisce i segreti con segnaposto stabili: lo stesso segreto produce
+// sempre lo stesso segnaposto, così il modello può ragionare sui riferimenti
+// senza mai vedere il valore.
+type Redactor struct {
+	Detectors []Detector
+	Allow     []*regexp.Regexp // Valori che non vanno mai redatti
+
+	Findings []Finding
+
+	originals map[string]string // Segnaposto -> segreto, solo in memoria, per Restore
+}
+
+// New costruisce il Redactor previsto dalla configurazione. Restituisce nil se la
+// redazione è disattivata.
+func New(cfg *config.Config) (*Redactor, error) {
+	redactionCfg := cfg.Redaction
+	if redactionCfg.Disabled {
+		return nil, nil
+	}
+
+	redactor := &Redactor{Detectors: DefaultDetectors()}
+
+	// Le chiavi note della configurazione vengono sempre rimosse. Una chiave che
+	// non si riesce a leggere dallo store non può nemmeno essere inviata.
+	var keys []string
+	for _, value := range []string{cfg.APIKey, cfg.Embeddings.APIKey} {
+		if key, err := cfg.ResolveSecret(value); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	redactor.Detectors = append(redactor.Detectors, &LiteralDetector{
+		Kind:   "configured-api-key",
+		Values: keys,
+	})
+
+	if !redactionCfg.DisableEntropy {
+		threshold := redactionCfg.EntropyThreshold
+		if threshold <= 0 {
+			threshold = defaultEntropyThreshold
+		}
+		redactor.Detectors = append(redactor.Detectors, &EntropyDetector{
+			Threshold: threshold,
+			MinLength: defaultEntropyMinLength,
+		})
+	}
+
+	for _, pattern := range redactionCfg.Patterns {
+		regex, err := regexp.Compile(pattern.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("pattern di redazione %q non valido: %v", pattern.Name, err)
+		}
+		kind := pattern.Name
+		if kind == "" {
+			kind = "custom"
+		}
+		redactor.Detectors = append(redactor.Detectors, &RegexDetector{Kind: kind, Regex: regex})
+	}
+
+	for _, allowed := range redactionCfg.Allow {
+		regex, err := regexp.Compile(allowed)
+		if err != nil {
+			return nil, fmt.Errorf("pattern di eccezione %q non valido: %v", allowed, err)
+		}
+		redactor.Allow = append(redactor.Allow, regex)
+	}
+
+	return redactor, nil
+}
+
+// Redact sostituisce i segreti trovati nel testo e li registra tra i Findings
+func (r *Redactor) Redact(text string) string {
+	if r == nil {
+		return text
+	}
+
+	var matches []Match
+	for _, detector := range r.Detectors {
+		matches = append(matches, detector.Find(text)...)
+	}
+	if len(matches) == 0 {
+		return text
+	}
+
+	// Ordina per posizione; a parità di inizio tiene il match più lungo
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Start != matches[j].Start {
+			return matches[i].Start < matches[j].Start
+		}
+		return matches[i].End > matches[j].End
+	})
+
+	var builder strings.Builder
+	last := 0
+	for _, match := range matches {
+		if match.Start < last {
+			continue // Sovrapposto a un segreto già sostituito
+		}
+		secret := text[match.Start:match.End]
+		if r.allowed(secret) || isPlaceholder(secret) {
+			continue
+		}
+
+		placeholder := Placeholder(match.Kind, secret)
+		builder.WriteString(text[last:match.Start])
+		builder.WriteString(placeholder)
+		last = match.End
+
+		r.Findings = append(r.Findings, Finding{Kind: match.Kind, Placeholder: placeholder})
+		if r.originals == nil {
+			r.originals = make(map[string]string)
+		}
+		r.originals[placeholder] = secret
+	}
+	builder.WriteString(text[last:])
+
+	return builder.String()
+}
+
+// Restore rimette al loro posto i segreti sostituiti da questo Redactor, così il
+// codice che il modello riscrive citando un segnaposto resta quello originale
+func (r *Redactor) Restore(text string) string {
+	return r.restore(text, func(secret string) string { return secret })
+}
+
+// RestoreJSON è come Restore per un documento JSON: i segreti vengono inseriti
+// con l'escape delle stringhe JSON (es. gli a capo di una chiave privata)
+func (r *Redactor) RestoreJSON(text string) string {
+	return r.restore(text, func(secret string) string {
+		encoded, _ := json.Marshal(secret)
+		return string(encoded[1 : len(encoded)-1])
+	})
+}
+
+func (r *Redactor) restore(text string, encode func(string) string) string {
+	if r == nil || len(r.originals) == 0 || !strings.Contains(text, "[REDACTED:") {
+		return text
+	}
+	pairs := make([]string, 0, 2*len(r.originals))
+	for placeholder, secret := range r.originals {
+		pairs = append(pairs, placeholder, encode(secret))
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+func (r *Redactor) allowed(secret string) bool {
+	for _, regex := range r.Allow {
+		if regex.MatchString(secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// Placeholder restituisce il segnaposto stabile di un segreto
+func Placeholder(kind, secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return fmt.Sprintf("[REDACTED:%s:%s]", kind, hex.EncodeToString(sum[:4]))
+}
+
+var placeholderPattern = regexp.MustCompile(`^\[?REDACTED:[a-z0-9\-]+:[0-9a-f]{8}\]?$`)
+
+func isPlaceholder(text string) bool {
+	return placeholderPattern.MatchString(text)
+}
+
+// Summary riassume i segreti sostituiti, raggruppati per tipo
+func (r *Redactor) Summary() string {
+	if r == nil || len(r.Findings) == 0 {
+		return ""
+	}
+
+	counts := make(map[string]int)
+	unique := make(map[string]bool)
+	for _, finding := range r.Findings {
+		counts[finding.Kind]++
+		unique[finding.Placeholder] = true
+	}
+
+	kinds := make([]string, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	parts := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		parts = append(parts, fmt.Sprintf("%s: %d", kind, counts[kind]))
+	}
+
+	return fmt.Sprintf("Redazione: %d occorrenze di %d segreti sostituite prima dell'invio (%s)",
+		len(r.Findings), len(unique), strings.Join(parts, ", "))
+}
+
+// WriteAudit aggiunge i segreti sostituiti al registro in .isy, senza i valori
+func (r *Redactor) WriteAudit(destination string) error {
+	if r == nil || len(r.Findings) == 0 {
+		return nil
+	}
+
+	file, err := os.OpenFile(project.StatePath(auditLogFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("errore durante l'apertura del registro di redazione: %v", err)
+	}
+	defer file.Close()
+
+	timestamp := time.Now().Format(time.RFC3339)
+	for _, finding := range r.Findings {
+		if _, err := fmt.Fprintf(file, "%s\t%s\t%s\t%s\n", timestamp, destination, finding.Kind, finding.Placeholder); err != nil {
+			return fmt.Errorf("errore durante la scrittura del registro di redazione: %v", err)
+		}
+	}
+	return nil
+}
+
+// Report segnala su stderr i segreti rimossi dall'ultimo invio verso destination,
+// li registra nel registro di audit e azzera i Findings. Va su stderr così
+// l'output di ask e code resta pulito anche con --output json.
+func (r *Redactor) Report(destination string) {
+	if summary := r.Summary(); summary != "" {
+		fmt.Fprintln(os.Stderr, summary)
+		if err := r.WriteAudit(destination); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	r.Reset()
+}
+
+// Reset dimentica i segreti registrati, per riusare il Redactor su una nuova
+// richiesta. I segnaposto restano noti a Restore.
+func (r *Redactor) Reset() {
+	if r != nil {
+		r.Findings = nil
+	}
+}
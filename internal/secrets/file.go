@@ -0,0 +1,265 @@
+package secrets
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// PassphraseEnv permette di fornire la passphrase senza prompt (es. in CI)
+	PassphraseEnv = "ISY_SECRETS_PASSPHRASE"
+
+	fileStoreVersion = 1
+	kdfIterations    = 600_000
+	keyLength        = 32 // AES-256
+	saltLength       = 16
+)
+
+// FileStore conserva i segreti in un file cifrato con AES-256-GCM, con la chiave
+// derivata da una passphrase tramite PBKDF2-HMAC-SHA256
+type FileStore struct {
+	Path string
+}
+
+// encryptedFile è il formato su disco del FileStore
+type encryptedFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// La passphrase viene chiesta una sola volta per processo
+var cachedPassphrase string
+
+func NewFileStore() (*FileStore, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("impossibile determinare la directory di configurazione utente: %v", err)
+	}
+	return &FileStore{Path: filepath.Join(dir, "isy", "secrets.enc")}, nil
+}
+
+func (f *FileStore) Name() string {
+	return "file cifrato " + f.Path
+}
+
+func (f *FileStore) Get(name string) (string, error) {
+	values, err := f.load()
+	if err != nil {
+		return "", err
+	}
+	value, ok := values[name]
+	if !ok {
+		return "", ErrNotFound{Name: name}
+	}
+	return value, nil
+}
+
+func (f *FileStore) Set(name, value string) error {
+	values, err := f.load()
+	if err != nil {
+		return err
+	}
+	values[name] = value
+	return f.save(values)
+}
+
+func (f *FileStore) Delete(name string) error {
+	values, err := f.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := values[name]; !ok {
+		return ErrNotFound{Name: name}
+	}
+	delete(values, name)
+	return f.save(values)
+}
+
+// Names restituisce i nomi dei segreti salvati, in ordine alfabetico
+func (f *FileStore) Names() ([]string, error) {
+	values, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// load decifra il file; un file mancante corrisponde a uno store vuoto
+func (f *FileStore) load() (map[string]string, error) {
+	values := make(map[string]string)
+
+	data, err := os.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore durante la lettura di %s: %v", f.Path, err)
+	}
+
+	var file encryptedFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("errore durante la decodifica di %s: %v", f.Path, err)
+	}
+	if file.Version != fileStoreVersion {
+		return nil, fmt.Errorf("versione di %s non supportata: %d", f.Path, file.Version)
+	}
+
+	passphrase, err := readPassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(passphrase, file.Salt, file.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		cachedPassphrase = ""
+		return nil, fmt.Errorf("impossibile decifrare %s: passphrase errata o file danneggiato", f.Path)
+	}
+
+	if err := json.Unmarshal(plaintext, &values); err != nil {
+		return nil, fmt.Errorf("errore durante la decodifica dei segreti: %v", err)
+	}
+	return values, nil
+}
+
+// save cifra i segreti con un nuovo salt e un nuovo nonce
+func (f *FileStore) save(values map[string]string) error {
+	_, statErr := os.Stat(f.Path)
+	passphrase, err := readPassphrase(os.IsNotExist(statErr))
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("errore durante la serializzazione dei segreti: %v", err)
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("errore durante la generazione del salt: %v", err)
+	}
+	gcm, err := newGCM(passphrase, salt, kdfIterations)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("errore durante la generazione del nonce: %v", err)
+	}
+
+	data, err := json.MarshalIndent(encryptedFile{
+		Version:    fileStoreVersion,
+		KDF:        "pbkdf2-sha256",
+		Iterations: kdfIterations,
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, plaintext, nil),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("errore durante la serializzazione di %s: %v", f.Path, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0700); err != nil {
+		return fmt.Errorf("errore durante la creazione della directory dei segreti: %v", err)
+	}
+	if err := os.WriteFile(f.Path, data, 0600); err != nil {
+		return fmt.Errorf("errore durante la scrittura di %s: %v", f.Path, err)
+	}
+	return nil
+}
+
+func newGCM(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	if iterations <= 0 {
+		return nil, fmt.Errorf("numero di iterazioni non valido: %d", iterations)
+	}
+	key := pbkdf2.Key([]byte(passphrase), salt, iterations, keyLength, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("errore durante l'inizializzazione della cifratura: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// readPassphrase legge la passphrase dall'ambiente o dal terminale, senza eco.
+// Alla creazione del file la chiede due volte per conferma.
+func readPassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	if cachedPassphrase != "" {
+		return cachedPassphrase, nil
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("nessun terminale per chiedere la passphrase: imposta %s", PassphraseEnv)
+	}
+	defer tty.Close()
+
+	passphrase, err := promptHidden(tty, "Passphrase dei segreti di isy: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("la passphrase non può essere vuota")
+	}
+	if confirm {
+		again, err := promptHidden(tty, "Conferma la passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", fmt.Errorf("le passphrase non coincidono")
+		}
+	}
+
+	cachedPassphrase = passphrase
+	return passphrase, nil
+}
+
+// promptHidden disattiva l'eco del terminale con stty mentre l'utente scrive
+func promptHidden(tty *os.File, prompt string) (string, error) {
+	fmt.Fprint(tty, prompt)
+
+	echoOff := exec.Command("stty", "-echo")
+	echoOff.Stdin = tty
+	if err := echoOff.Run(); err == nil {
+		defer func() {
+			echoOn := exec.Command("stty", "echo")
+			echoOn.Stdin = tty
+			_ = echoOn.Run()
+			fmt.Fprintln(tty)
+		}()
+	}
+
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("errore durante la lettura della passphrase: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
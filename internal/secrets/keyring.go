@@ -0,0 +1,102 @@
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Servizio con cui i segreti vengono registrati nel portachiavi
+const keyringService = "isy-cli"
+
+// KeyringStore usa il portachiavi del sistema tramite i suoi strumenti da riga
+// di comando: secret-tool (Secret Service) su Linux e security (Keychain) su macOS
+type KeyringStore struct {
+	tool string
+}
+
+// NewKeyringStore restituisce un errore se il portachiavi non è disponibile
+func NewKeyringStore() (*KeyringStore, error) {
+	var tool string
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd":
+		tool = "secret-tool"
+	case "darwin":
+		tool = "security"
+	default:
+		return nil, fmt.Errorf("portachiavi non supportato su %s", runtime.GOOS)
+	}
+
+	path, err := exec.LookPath(tool)
+	if err != nil {
+		return nil, fmt.Errorf("portachiavi non disponibile: %s non trovato", tool)
+	}
+	return &KeyringStore{tool: path}, nil
+}
+
+func (k *KeyringStore) Name() string {
+	return "portachiavi di sistema"
+}
+
+func (k *KeyringStore) Get(name string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command(k.tool, "find-generic-password", "-s", keyringService, "-a", name, "-w")
+	} else {
+		cmd = exec.Command(k.tool, "lookup", "service", keyringService, "account", name)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		// security termina con codice 44 se la voce non esiste, secret-tool con
+		// un errore senza messaggio
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if runtime.GOOS == "darwin" && exitErr.ExitCode() == 44 ||
+				runtime.GOOS != "darwin" && strings.TrimSpace(stderr.String()) == "" {
+				return "", ErrNotFound{Name: name}
+			}
+		}
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	secret := strings.TrimRight(string(output), "\n")
+	if secret == "" {
+		return "", ErrNotFound{Name: name}
+	}
+	return secret, nil
+}
+
+func (k *KeyringStore) Set(name, value string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		// security accetta il valore solo come argomento; -U aggiorna una voce esistente
+		cmd = exec.Command(k.tool, "add-generic-password", "-U", "-s", keyringService, "-a", name, "-w", value)
+	} else {
+		// secret-tool legge il valore da stdin, così non compare tra gli argomenti del processo
+		cmd = exec.Command(k.tool, "store", "--label", keyringService+": "+name, "service", keyringService, "account", name)
+		cmd.Stdin = strings.NewReader(value)
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("errore durante il salvataggio nel portachiavi: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (k *KeyringStore) Delete(name string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command(k.tool, "delete-generic-password", "-s", keyringService, "-a", name)
+	} else {
+		cmd = exec.Command(k.tool, "clear", "service", keyringService, "account", name)
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("errore durante la rimozione dal portachiavi: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package secrets
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Backend supportati per la conservazione delle credenziali
+const (
+	BackendAuto    = "auto"
+	BackendKeyring = "keyring"
+	BackendFile    = "file"
+)
+
+// RefPrefix introduce un riferimento a un segreto nei valori della configurazione,
+// es. "api_key": "secret:openai-api-key"
+const RefPrefix = "secret:"
+
+// Store conserva le credenziali fuori dai file di configurazione
+type Store interface {
+	Get(name string) (string, error)
+	Set(name, value string) error
+	Delete(name string) error
+	// Name descrive il backend, per i messaggi all'utente
+	Name() string
+}
+
+// ErrNotFound indica che il segreto richiesto non esiste nello store
+type ErrNotFound struct {
+	Name string
+}
+
+func (e ErrNotFound) Error() string {
+	return fmt.Sprintf("segreto %q non trovato", e.Name)
+}
+
+// Open restituisce lo store del backend indicato. Con "auto" (o vuoto) usa il
+// portachiavi del sistema se disponibile, altrimenti il file cifrato.
+func Open(backend string) (Store, error) {
+	switch backend {
+	case "", BackendAuto:
+		if keyring, err := NewKeyringStore(); err == nil {
+			return keyring, nil
+		}
+		return NewFileStore()
+	case BackendKeyring:
+		return NewKeyringStore()
+	case BackendFile:
+		return NewFileStore()
+	default:
+		return nil, fmt.Errorf("backend dei segreti sconosciuto: %s", backend)
+	}
+}
+
+// Ref restituisce il riferimento da scrivere nella configurazione per un segreto
+func Ref(name string) string {
+	return RefPrefix + name
+}
+
+// RefName restituisce il nome del segreto a cui punta un valore, se è un riferimento
+func RefName(value string) (string, bool) {
+	if !strings.HasPrefix(value, RefPrefix) {
+		return "", false
+	}
+	name := strings.TrimPrefix(value, RefPrefix)
+	return name, name != ""
+}
+
+var (
+	resolvedMu sync.Mutex
+	resolved   = make(map[string]string)
+)
+
+// Resolve restituisce il valore effettivo di un campo della configurazione: i
+// riferimenti "secret:<nome>" vengono letti dallo store, gli altri valori
+// restituiti così come sono. I segreti letti restano in memoria per il resto
+// del processo, così il portachiavi o la passphrase vengono chiesti una sola volta.
+func Resolve(backend, value string) (string, error) {
+	name, ok := RefName(value)
+	if !ok {
+		return value, nil
+	}
+
+	resolvedMu.Lock()
+	defer resolvedMu.Unlock()
+	if secret, ok := resolved[name]; ok {
+		return secret, nil
+	}
+
+	store, err := Open(backend)
+	if err != nil {
+		return "", err
+	}
+	secret, err := store.Get(name)
+	if err != nil {
+		return "", fmt.Errorf("impossibile leggere il segreto %q da %s: %v", name, store.Name(), err)
+	}
+	resolved[name] = secret
+	return secret, nil
+}
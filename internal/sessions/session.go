@@ -0,0 +1,263 @@
+package sessions
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"isy-cli/internal/project"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	dirName        = "sessions"
+	titleMaxLength = 60
+)
+
+// Message è un turno della conversazione. Il contesto del progetto non viene
+// salvato: alla ripresa viene rigenerato, così riflette il codice attuale.
+type Message struct {
+	Role    string    `json:"role"` // "user" oppure "assistant"
+	Content string    `json:"content"`
+	Time    time.Time `json:"time"`
+}
+
+// Session è una conversazione di ask salvata in .isy/sessions/<id>.json
+type Session struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	Created      time.Time `json:"created"`
+	Updated      time.Time `json:"updated"`
+	Model        string    `json:"model"`
+	Profile      string    `json:"profile,omitempty"`
+	ContextHash  string    `json:"context_hash"` // Hash del contesto inviato all'ultimo avvio
+	Messages     []Message `json:"messages"`
+	Summary      string    `json:"summary,omitempty"`   // Riassunto dei messaggi compattati
+	Compacted    int       `json:"compacted,omitempty"` // Messaggi iniziali sostituiti dal riassunto
+	InputTokens  int64     `json:"input_tokens"`
+	OutputTokens int64     `json:"output_tokens"`
+	Cost         float64   `json:"cost"`
+	CostUnknown  bool      `json:"cost_unknown,omitempty"` // Alcune richieste hanno usato modelli senza prezzo
+}
+
+// Dir restituisce la directory delle sessioni del progetto
+func Dir() string {
+	return project.StatePath(dirName)
+}
+
+// New crea una sessione vuota con un identificativo basato sulla data
+func New(model, profile string) (*Session, error) {
+	suffix := make([]byte, 2)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("errore durante la generazione dell'id di sessione: %v", err)
+	}
+	now := time.Now()
+	return &Session{
+		ID:      now.Format("20060102-150405") + "-" + hex.EncodeToString(suffix),
+		Created: now,
+		Updated: now,
+		Model:   model,
+		Profile: profile,
+	}, nil
+}
+
+// ContextHash calcola l'hash del contesto, per capire se il codice è cambiato
+func ContextHash(context string) string {
+	sum := sha256.Sum256([]byte(context))
+	return hex.EncodeToString(sum[:])
+}
+
+// Append aggiunge un turno; il primo messaggio dell'utente diventa il titolo
+func (s *Session) Append(role, content string) {
+	now := time.Now()
+	s.Messages = append(s.Messages, Message{Role: role, Content: content, Time: now})
+	s.Updated = now
+
+	if s.Title == "" && role == "user" {
+		title := strings.Join(strings.Fields(content), " ")
+		if len([]rune(title)) > titleMaxLength {
+			title = string([]rune(title)[:titleMaxLength-1]) + "…"
+		}
+		s.Title = title
+	}
+}
+
+// AddUsage somma i token e il costo di una richiesta; cost nil indica un costo sconosciuto
+func (s *Session) AddUsage(inputTokens, outputTokens int64, cost *float64) {
+	s.InputTokens += inputTokens
+	s.OutputTokens += outputTokens
+	if cost == nil {
+		s.CostUnknown = true
+		return
+	}
+	s.Cost += *cost
+}
+
+// Turns restituisce il numero di domande dell'utente
+func (s *Session) Turns() int {
+	turns := 0
+	for _, message := range s.Messages {
+		if message.Role == "user" {
+			turns++
+		}
+	}
+	return turns
+}
+
+// Save scrive la sessione su disco
+func (s *Session) Save() error {
+	if err := os.MkdirAll(Dir(), 0755); err != nil {
+		return fmt.Errorf("errore durante la creazione della directory delle sessioni: %v", err)
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("errore durante la serializzazione della sessione: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(Dir(), s.ID+".json"), data, 0644); err != nil {
+		return fmt.Errorf("errore durante il salvataggio della sessione: %v", err)
+	}
+	return nil
+}
+
+// Load carica una sessione dal suo id o da un prefisso univoco dell'id
+func Load(id string) (*Session, error) {
+	all, err := List()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*Session
+	for _, session := range all {
+		if session.ID == id {
+			return session, nil
+		}
+		if strings.HasPrefix(session.ID, id) {
+			matches = append(matches, session)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("sessione %s non trovata", id)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("il prefisso %s corrisponde a %d sessioni: indica un id più lungo", id, len(matches))
+	}
+}
+
+// Latest restituisce la sessione aggiornata più di recente
+func Latest() (*Session, error) {
+	all, err := List()
+	if err != nil {
+		return nil, err
+	}
+	if len(all) == 0 {
+		return nil, fmt.Errorf("nessuna sessione salvata")
+	}
+	return all[0], nil
+}
+
+// List restituisce le sessioni salvate, dalla più recente
+func List() ([]*Session, error) {
+	entries, err := os.ReadDir(Dir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore durante la lettura delle sessioni: %v", err)
+	}
+
+	var all []*Session
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(Dir(), entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("errore durante la lettura della sessione %s: %v", entry.Name(), err)
+		}
+		var session Session
+		if err := json.Unmarshal(data, &session); err != nil {
+			return nil, fmt.Errorf("errore durante la decodifica della sessione %s: %v", entry.Name(), err)
+		}
+		all = append(all, &session)
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Updated.After(all[j].Updated)
+	})
+	return all, nil
+}
+
+// Match è un messaggio che contiene il testo cercato
+type Match struct {
+	Session *Session
+	Message Message
+	Snippet string
+}
+
+// Search cerca un testo (senza distinguere maiuscole) nei titoli e nei messaggi
+func Search(query string) ([]Match, error) {
+	all, err := List()
+	if err != nil {
+		return nil, err
+	}
+
+	// Gli indici devono riferirsi al testo originale: la versione in minuscolo
+	// può avere una lunghezza diversa (es. İ)
+	needle, err := regexp.Compile("(?i)" + regexp.QuoteMeta(query))
+	if err != nil {
+		return nil, fmt.Errorf("ricerca non valida: %v", err)
+	}
+	var matches []Match
+	for _, session := range all {
+		for _, message := range session.Messages {
+			loc := needle.FindStringIndex(message.Content)
+			if loc == nil {
+				continue
+			}
+			matches = append(matches, Match{Session: session, Message: message, Snippet: snippet(message.Content, loc[0], loc[1]-loc[0])})
+		}
+		if len(matches) == 0 || matches[len(matches)-1].Session != session {
+			if needle.MatchString(session.Title) {
+				matches = append(matches, Match{Session: session, Snippet: session.Title})
+			}
+		}
+	}
+	return matches, nil
+}
+
+// snippet restituisce il testo intorno a una corrispondenza, su una sola riga
+func snippet(text string, index, length int) string {
+	const around = 40
+	start := max(index-around, 0)
+	end := min(index+length+around, len(text))
+
+	// Evita di tagliare un carattere multibyte a metà
+	for start > 0 && !isRuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !isRuneStart(text[end]) {
+		end++
+	}
+
+	result := strings.Join(strings.Fields(text[start:end]), " ")
+	if start > 0 {
+		result = "…" + result
+	}
+	if end < len(text) {
+		result += "…"
+	}
+	return result
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,118 @@
+package symbols
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// indexGoFile aggiunge all'indice le definizioni e gli import di un file Go
+// e restituisce tutti gli identificatori usati nel file
+func indexGoFile(index *Index, path string, src []byte, modulePath string) ([]Reference, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg := filepath.ToSlash(filepath.Dir(path))
+	pkgName := file.Name.Name
+
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		// Gli import interni al modulo vengono ricondotti alla directory del package
+		if modulePath != "" && strings.HasPrefix(importPath, modulePath+"/") {
+			importPath = strings.TrimPrefix(importPath, modulePath+"/")
+		}
+		index.Imports[pkg] = append(index.Imports[pkg], importPath)
+	}
+
+	add := func(name *ast.Ident, kind, receiver string, node ast.Node, doc *ast.CommentGroup) {
+		if name.Name == "_" {
+			return
+		}
+		start := node.Pos()
+		if doc != nil {
+			start = doc.Pos()
+		}
+		index.Symbols = append(index.Symbols, Symbol{
+			Name:      name.Name,
+			Kind:      kind,
+			Path:      path,
+			Line:      fset.Position(name.Pos()).Line,
+			StartLine: fset.Position(start).Line,
+			EndLine:   fset.Position(node.End()).Line,
+			Package:   pkgName,
+			Receiver:  receiver,
+		})
+	}
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				add(d.Name, "method", receiverName(d.Recv.List[0].Type), d, d.Doc)
+			} else {
+				add(d.Name, "func", "", d, d.Doc)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				doc := d.Doc
+				var node ast.Node = spec
+				if len(d.Specs) == 1 {
+					node = d
+				} else {
+					doc = nil
+				}
+
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					add(s.Name, "type", "", node, doc)
+				case *ast.ValueSpec:
+					kind := "var"
+					if d.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, name := range s.Names {
+						add(name, kind, "", node, doc)
+					}
+				}
+			}
+		}
+	}
+
+	var usages []Reference
+	ast.Inspect(file, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Ident); ok {
+			usages = append(usages, Reference{
+				Name: ident.Name,
+				Path: path,
+				Line: fset.Position(ident.Pos()).Line,
+			})
+		}
+		return true
+	})
+
+	return usages, nil
+}
+
+// receiverName estrae il nome del tipo dal receiver di un metodo
+func receiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
@@ -0,0 +1,171 @@
+package symbols
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// definitionPattern riconosce una definizione: il primo gruppo è il nome
+type definitionPattern struct {
+	Kind  string
+	Regex *regexp.Regexp
+}
+
+var languageByExtension = map[string]string{
+	".go":   "go",
+	".py":   "python",
+	".js":   "javascript",
+	".jsx":  "javascript",
+	".mjs":  "javascript",
+	".ts":   "javascript",
+	".tsx":  "javascript",
+	".rs":   "rust",
+	".java": "java",
+	".kt":   "java",
+	".cs":   "java",
+	".rb":   "ruby",
+	".php":  "php",
+	".c":    "c",
+	".h":    "c",
+	".cpp":  "c",
+	".hpp":  "c",
+	".cc":   "c",
+}
+
+// Euristiche in stile ctags per i linguaggi diversi dal Go
+var definitionPatterns = map[string][]definitionPattern{
+	"python": {
+		{"class", regexp.MustCompile(`^\s*class\s+([A-Za-z_]\w*)`)},
+		{"func", regexp.MustCompile(`^\s*(?:async\s+)?def\s+([A-Za-z_]\w*)`)},
+		{"var", regexp.MustCompile(`^([A-Z_][A-Z0-9_]*)\s*=`)},
+	},
+	"javascript": {
+		{"class", regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:abstract\s+)?class\s+([A-Za-z_$][\w$]*)`)},
+		{"func", regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:async\s+)?function\s*\*?\s*([A-Za-z_$][\w$]*)`)},
+		{"func", regexp.MustCompile(`^\s*(?:export\s+)?(?:const|let|var)\s+([A-Za-z_$][\w$]*)\s*=\s*(?:async\s+)?(?:function|\([^)]*\)\s*=>|[A-Za-z_$][\w$]*\s*=>)`)},
+		{"type", regexp.MustCompile(`^\s*(?:export\s+)?(?:interface|type|enum)\s+([A-Za-z_$][\w$]*)`)},
+	},
+	"rust": {
+		{"func", regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:async\s+)?(?:unsafe\s+)?fn\s+([A-Za-z_]\w*)`)},
+		{"type", regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:struct|enum|trait|type|union)\s+([A-Za-z_]\w*)`)},
+		{"const", regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:const|static)\s+([A-Za-z_]\w*)`)},
+	},
+	"java": {
+		{"class", regexp.MustCompile(`^\s*(?:(?:public|private|protected|internal|abstract|final|static|sealed|data|open)\s+)*(?:class|interface|enum|record|object)\s+([A-Za-z_]\w*)`)},
+		{"method", regexp.MustCompile(`^\s*(?:(?:public|private|protected|internal|abstract|final|static|override|synchronized|async)\s+)+[\w<>\[\],.? ]+\s+([A-Za-z_]\w*)\s*\(`)},
+		{"func", regexp.MustCompile(`^\s*(?:(?:public|private|protected|internal|override|suspend)\s+)*fun\s+(?:<[^>]*>\s*)?(?:[\w.]+\.)?([A-Za-z_]\w*)\s*\(`)},
+	},
+	"ruby": {
+		{"class", regexp.MustCompile(`^\s*(?:class|module)\s+([A-Z]\w*)`)},
+		{"method", regexp.MustCompile(`^\s*def\s+(?:self\.)?([A-Za-z_]\w*[?!]?)`)},
+	},
+	"php": {
+		{"class", regexp.MustCompile(`^\s*(?:(?:abstract|final)\s+)?(?:class|interface|trait)\s+([A-Za-z_]\w*)`)},
+		{"func", regexp.MustCompile(`^\s*(?:(?:public|private|protected|static|abstract|final)\s+)*function\s+&?\s*([A-Za-z_]\w*)`)},
+	},
+	"c": {
+		{"type", regexp.MustCompile(`^\s*(?:typedef\s+)?(?:struct|class|union|enum)\s+([A-Za-z_]\w*)\s*[{:]?\s*$`)},
+		{"func", regexp.MustCompile(`^[A-Za-z_][\w\s\*&:<>,]*?\b([A-Za-z_]\w*)\s*\([^;]*$`)},
+		{"const", regexp.MustCompile(`^\s*#define\s+([A-Za-z_]\w*)`)},
+	},
+}
+
+var importPatterns = map[string][]*regexp.Regexp{
+	"python": {
+		regexp.MustCompile(`^\s*import\s+([\w.]+)`),
+		regexp.MustCompile(`^\s*from\s+([\w.]+)\s+import`),
+	},
+	"javascript": {
+		regexp.MustCompile(`^\s*import\s+(?:[^'"]*\s+from\s+)?['"]([^'"]+)['"]`),
+		regexp.MustCompile(`require\(\s*['"]([^'"]+)['"]\s*\)`),
+	},
+	"rust": {
+		regexp.MustCompile(`^\s*(?:pub\s+)?use\s+([\w:]+)`),
+	},
+	"java": {
+		regexp.MustCompile(`^\s*(?:import|using)\s+(?:static\s+)?([\w.]+)`),
+	},
+	"ruby": {
+		regexp.MustCompile(`^\s*require(?:_relative)?\s+['"]([^'"]+)['"]`),
+	},
+	"php": {
+		regexp.MustCompile(`^\s*use\s+([\w\\]+)`),
+	},
+	"c": {
+		regexp.MustCompile(`^\s*#include\s+[<"]([^>"]+)[>"]`),
+	},
+}
+
+// Parole chiave che le euristiche per C e Java scambierebbero per funzioni
+var keywords = map[string]bool{
+	"if": true, "for": true, "while": true, "switch": true, "return": true,
+	"catch": true, "sizeof": true, "else": true, "new": true, "do": true,
+}
+
+func languageOf(path string) string {
+	return languageByExtension[strings.ToLower(filepath.Ext(path))]
+}
+
+// indexHeuristicFile aggiunge all'indice le definizioni trovate riga per riga
+// e restituisce gli identificatori usati nel file
+func indexHeuristicFile(index *Index, path string, src []byte) []Reference {
+	language := languageOf(path)
+	pkg := filepath.ToSlash(filepath.Dir(path))
+	lines := strings.Split(string(src), "\n")
+
+	var usages []Reference
+	var fileSymbols []int
+	for i, line := range lines {
+		for _, pattern := range definitionPatterns[language] {
+			match := pattern.Regex.FindStringSubmatch(line)
+			if match == nil || keywords[match[1]] {
+				continue
+			}
+			fileSymbols = append(fileSymbols, len(index.Symbols))
+			index.Symbols = append(index.Symbols, Symbol{
+				Name:      match[1],
+				Kind:      pattern.Kind,
+				Path:      path,
+				Line:      i + 1,
+				StartLine: i + 1,
+				EndLine:   i + 1,
+			})
+			break
+		}
+
+		for _, pattern := range importPatterns[language] {
+			if match := pattern.FindStringSubmatch(line); match != nil {
+				index.Imports[pkg] = append(index.Imports[pkg], match[1])
+			}
+		}
+
+		for _, word := range identifiers(line) {
+			usages = append(usages, Reference{Name: word, Path: path, Line: i + 1})
+		}
+	}
+
+	// Senza un parser la fine di una definizione è stimata: arriva fino alla
+	// definizione successiva allo stesso livello di indentazione o meno
+	for n, symbolIndex := range fileSymbols {
+		symbol := &index.Symbols[symbolIndex]
+		indent := indentation(lines[symbol.Line-1])
+		end := len(lines)
+		for _, next := range fileSymbols[n+1:] {
+			if indentation(lines[index.Symbols[next].Line-1]) <= indent {
+				end = index.Symbols[next].Line - 1
+				break
+			}
+		}
+		for end > symbol.Line && strings.TrimSpace(lines[end-1]) == "" {
+			end--
+		}
+		symbol.EndLine = end
+	}
+
+	return usages
+}
+
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
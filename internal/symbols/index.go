@@ -0,0 +1,216 @@
+package symbols
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Symbol è una definizione trovata nel progetto
+type Symbol struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"` // func, method, type, const, var, class, ...
+	Path      string `json:"path"`
+	Line      int    `json:"line"`       // Riga del nome
+	StartLine int    `json:"start_line"` // Inizio della definizione, doc comment incluso
+	EndLine   int    `json:"end_line"`
+	Package   string `json:"package,omitempty"`
+	Receiver  string `json:"receiver,omitempty"`
+}
+
+// Reference è un uso di un nome definito nel progetto
+type Reference struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Line int    `json:"line"`
+}
+
+// Index raccoglie definizioni, riferimenti e grafo degli import del progetto
+type Index struct {
+	Symbols    []Symbol            `json:"symbols"`
+	References []Reference         `json:"references"`
+	Imports    map[string][]string `json:"imports"` // package (directory) -> import
+}
+
+// Directory che non contengono codice del progetto
+var skippedDirs = map[string]bool{
+	".isy":         true,
+	".git":         true,
+	"node_modules": true,
+	"vendor":       true,
+}
+
+// Build indicizza tutti i file sorgente sotto baseDir
+func Build(baseDir string) (*Index, error) {
+	var files []string
+	err := filepath.Walk(baseDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != baseDir && skippedDirs[info.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if languageOf(path) != "" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("errore durante la scansione del progetto: %v", err)
+	}
+
+	return BuildFromFiles(baseDir, files)
+}
+
+// BuildFromFiles indicizza i file indicati. Il Go viene analizzato con go/parser,
+// gli altri linguaggi con euristiche in stile ctags.
+func BuildFromFiles(baseDir string, files []string) (*Index, error) {
+	index := &Index{Imports: make(map[string][]string)}
+	modulePath := readModulePath(baseDir)
+
+	var usages []Reference
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("errore durante la lettura del file %s: %v", path, err)
+		}
+
+		switch languageOf(path) {
+		case "go":
+			fileUsages, err := indexGoFile(index, path, src, modulePath)
+			if err != nil {
+				continue // I file che non compilano vengono ignorati
+			}
+			usages = append(usages, fileUsages...)
+		case "":
+			continue
+		default:
+			usages = append(usages, indexHeuristicFile(index, path, src)...)
+		}
+	}
+
+	// Tiene solo gli usi di nomi definiti nel progetto, escluse le definizioni stesse
+	defined := make(map[string]bool)
+	definitionSites := make(map[Reference]bool)
+	for _, symbol := range index.Symbols {
+		defined[symbol.Name] = true
+		definitionSites[Reference{Name: symbol.Name, Path: symbol.Path, Line: symbol.Line}] = true
+	}
+	seen := make(map[Reference]bool)
+	for _, usage := range usages {
+		if !defined[usage.Name] || definitionSites[usage] || seen[usage] {
+			continue
+		}
+		seen[usage] = true
+		index.References = append(index.References, usage)
+	}
+
+	for pkg, imports := range index.Imports {
+		index.Imports[pkg] = uniqueSorted(imports)
+	}
+
+	return index, nil
+}
+
+// Definitions restituisce le definizioni con il nome indicato
+func (idx *Index) Definitions(name string) []Symbol {
+	var result []Symbol
+	for _, symbol := range idx.Symbols {
+		if symbol.Name == name {
+			result = append(result, symbol)
+		}
+	}
+	return result
+}
+
+// ReferencesTo restituisce gli usi del nome indicato
+func (idx *Index) ReferencesTo(name string) []Reference {
+	var result []Reference
+	for _, reference := range idx.References {
+		if reference.Name == name {
+			result = append(result, reference)
+		}
+	}
+	return result
+}
+
+// Dependencies restituisce le definizioni usate all'interno del simbolo indicato,
+// escluso il simbolo stesso
+func (idx *Index) Dependencies(symbol Symbol) []Symbol {
+	names := make(map[string]bool)
+	for _, reference := range idx.References {
+		if reference.Path == symbol.Path && reference.Line >= symbol.StartLine && reference.Line <= symbol.EndLine {
+			names[reference.Name] = true
+		}
+	}
+	delete(names, symbol.Name)
+
+	var result []Symbol
+	for _, candidate := range idx.Symbols {
+		if !names[candidate.Name] || candidate == symbol {
+			continue
+		}
+		// I metodi omonimi di altri tipi generano troppo rumore
+		if candidate.Kind == "method" {
+			continue
+		}
+		result = append(result, candidate)
+	}
+	return result
+}
+
+// Mentioned restituisce le definizioni i cui nomi compaiono nel testo
+func (idx *Index) Mentioned(text string) []Symbol {
+	words := make(map[string]bool)
+	for _, word := range identifiers(text) {
+		words[word] = true
+	}
+
+	var result []Symbol
+	for _, symbol := range idx.Symbols {
+		if len(symbol.Name) >= 3 && words[symbol.Name] {
+			result = append(result, symbol)
+		}
+	}
+	return result
+}
+
+// readModulePath legge il module path da go.mod, per riconoscere gli import interni
+func readModulePath(baseDir string) string {
+	data, err := os.ReadFile(filepath.Join(baseDir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "module ") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "module "))
+		}
+	}
+	return ""
+}
+
+// identifiers divide un testo negli identificatori che contiene
+func identifiers(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !(r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9'))
+	})
+}
+
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,54 @@
+package tools
+
+import (
+	gocontext "context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+var runCommandTool = tool{
+	name:        "run_command",
+	description: "Run a shell command in the project directory, e.g. to run the tests or a build, and return its output and exit code. The user must approve every command: prefer read-only commands and never modify files with it.",
+	parameters: schema(map[string]interface{}{
+		"command": map[string]interface{}{"type": "string", "description": "Command line, run with sh -c"},
+	}, "command"),
+	run: (*Toolbox).runCommand,
+}
+
+func (t *Toolbox) runCommand(arguments json.RawMessage) (string, error) {
+	var args struct {
+		Command string `json:"command"`
+	}
+	if err := decode(arguments, &args); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(args.Command) == "" {
+		return "", fmt.Errorf("missing command")
+	}
+	if !t.options.Approve(args.Command) {
+		return "", fmt.Errorf("the user did not approve the command")
+	}
+
+	timeout := time.Duration(t.options.CommandTimeout) * time.Second
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), timeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "sh", "-c", args.Command).CombinedOutput()
+	status := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		switch {
+		case ctx.Err() != nil:
+			return string(output) + fmt.Sprintf("\n[command killed after %s]\n", timeout), nil
+		case errors.As(err, &exitErr):
+			status = exitErr.ExitCode()
+		default:
+			return "", fmt.Errorf("cannot run the command: %v", err)
+		}
+	}
+	return fmt.Sprintf("exit code %d\n%s", status, output), nil
+}
@@ -0,0 +1,202 @@
+package tools
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"isy-cli/internal/context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	maxReadLines  = 400 // Righe restituite da una singola read_file
+	maxGrepHits   = 100 // Righe restituite da una singola grep
+	maxListedDirs = 500 // Voci restituite da una singola list_dir
+)
+
+var readFileTool = tool{
+	name:        "read_file",
+	description: fmt.Sprintf("Read a file of the project with line numbers. Without a range, returns the first %d lines.", maxReadLines),
+	parameters: schema(map[string]interface{}{
+		"path":       map[string]interface{}{"type": "string", "description": "Path relative to the project root"},
+		"start_line": map[string]interface{}{"type": "integer", "description": "First line to read (1-based, default 1)"},
+		"end_line":   map[string]interface{}{"type": "integer", "description": "Last line to read (inclusive)"},
+	}, "path"),
+	run: (*Toolbox).readFile,
+}
+
+func (t *Toolbox) readFile(arguments json.RawMessage) (string, error) {
+	var args struct {
+		Path      string `json:"path"`
+		StartLine int    `json:"start_line"`
+		EndLine   int    `json:"end_line"`
+	}
+	if err := decode(arguments, &args); err != nil {
+		return "", err
+	}
+	path, err := t.resolve(args.Path, false)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("%s does not exist", args.Path)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory, use list_dir", args.Path)
+	}
+
+	start := max(args.StartLine, 1)
+	end := args.EndLine
+	if end <= 0 || end-start+1 > maxReadLines {
+		end = start + maxReadLines - 1
+	}
+	return context.RenderFileRange(path, start, end)
+}
+
+var listDirTool = tool{
+	name:        "list_dir",
+	description: "List the files and directories in a directory of the project. Directories end with /.",
+	parameters: schema(map[string]interface{}{
+		"path": map[string]interface{}{"type": "string", "description": "Directory relative to the project root (default: the root)"},
+	}),
+	run: (*Toolbox).listDir,
+}
+
+func (t *Toolbox) listDir(arguments json.RawMessage) (string, error) {
+	var args struct {
+		Path string `json:"path"`
+	}
+	if err := decode(arguments, &args); err != nil {
+		return "", err
+	}
+	dir, err := t.resolve(args.Path, true)
+	if err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("cannot list %s: %v", args.Path, err)
+	}
+
+	var builder strings.Builder
+	listed := 0
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if excluded, _ := t.rules.Excluded(path, entry.IsDir()); excluded {
+			continue
+		}
+		if listed == maxListedDirs {
+			builder.WriteString(fmt.Sprintf("[listing truncated at %d entries]\n", maxListedDirs))
+			break
+		}
+		listed++
+		if entry.IsDir() {
+			builder.WriteString(path + "/\n")
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		builder.WriteString(fmt.Sprintf("%s (%s)\n", path, context.FormatSize(info.Size())))
+	}
+	if listed == 0 {
+		return fmt.Sprintf("%s is empty", dir), nil
+	}
+	return builder.String(), nil
+}
+
+var grepTool = tool{
+	name:        "grep",
+	description: fmt.Sprintf("Search the text files of the project with a regular expression (RE2 syntax). Returns up to %d matching lines as path:line: text.", maxGrepHits),
+	parameters: schema(map[string]interface{}{
+		"pattern": map[string]interface{}{"type": "string", "description": "Regular expression to search for"},
+		"path":    map[string]interface{}{"type": "string", "description": "File or directory to search in (default: the whole project)"},
+	}, "pattern"),
+	run: (*Toolbox).grep,
+}
+
+func (t *Toolbox) grep(arguments json.RawMessage) (string, error) {
+	var args struct {
+		Pattern string `json:"pattern"`
+		Path    string `json:"path"`
+	}
+	if err := decode(arguments, &args); err != nil {
+		return "", err
+	}
+	regex, err := regexp.Compile(args.Pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern: %v", err)
+	}
+
+	root, err := t.resolve(args.Path, false)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return "", fmt.Errorf("%s does not exist", args.Path)
+	}
+	if excluded, reason := t.rules.Excluded(root, info.IsDir()); excluded && root != "." {
+		return "", fmt.Errorf("%s is not accessible: %s", args.Path, reason)
+	}
+
+	var hits []string
+	truncated := false
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if truncated {
+			return filepath.SkipAll
+		}
+		if excluded, _ := t.rules.Excluded(path, info.IsDir()); excluded && path != root {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if binary, err := context.IsBinaryFile(path); err != nil || binary {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return nil
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for lineNumber := 1; scanner.Scan(); lineNumber++ {
+			if !regex.MatchString(scanner.Text()) {
+				continue
+			}
+			if len(hits) == maxGrepHits {
+				truncated = true
+				break
+			}
+			hits = append(hits, fmt.Sprintf("%s:%d: %s", path, lineNumber, strings.TrimSpace(scanner.Text())))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("search failed: %v", err)
+	}
+
+	if len(hits) == 0 {
+		return "no matches", nil
+	}
+	result := strings.Join(hits, "\n") + "\n"
+	if truncated {
+		result += fmt.Sprintf("[more than %d matches, narrow the pattern or the path]\n", maxGrepHits)
+	}
+	return result, nil
+}
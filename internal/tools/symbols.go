@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"isy-cli/internal/context"
+	"isy-cli/internal/symbols"
+	"strings"
+)
+
+// Definizioni restituite per intero da una singola find_symbol
+const maxSymbolDefinitions = 5
+
+var findSymbolTool = tool{
+	name:        "find_symbol",
+	description: "Find where a function, method, type, constant or variable is defined and return its code. Use Type.Method for a method of a specific type.",
+	parameters: schema(map[string]interface{}{
+		"name": map[string]interface{}{"type": "string", "description": "Name of the symbol, e.g. LoadConfig or Toolbox.Call"},
+	}, "name"),
+	run: (*Toolbox).findSymbol,
+}
+
+func (t *Toolbox) findSymbol(arguments json.RawMessage) (string, error) {
+	var args struct {
+		Name string `json:"name"`
+	}
+	if err := decode(arguments, &args); err != nil {
+		return "", err
+	}
+	name, receiver := strings.TrimSpace(args.Name), ""
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		receiver, name = strings.TrimPrefix(name[:dot], "*"), name[dot+1:]
+	}
+	if name == "" {
+		return "", fmt.Errorf("missing symbol name")
+	}
+
+	// L'indice si costruisce una volta per richiesta: tra una richiesta e
+	// l'altra i file possono cambiare
+	if t.index == nil {
+		index, err := symbols.Build(".")
+		if err != nil {
+			return "", fmt.Errorf("cannot index the project: %v", err)
+		}
+		t.index = index
+	}
+
+	var found []symbols.Symbol
+	for _, symbol := range t.index.Definitions(name) {
+		if receiver != "" && symbol.Receiver != receiver {
+			continue
+		}
+		if excluded, _ := t.rules.Excluded(symbol.Path, false); excluded {
+			continue
+		}
+		found = append(found, symbol)
+	}
+	if len(found) == 0 {
+		return fmt.Sprintf("no definition of %s found, try grep", args.Name), nil
+	}
+
+	var builder strings.Builder
+	for i, symbol := range found {
+		if i == maxSymbolDefinitions {
+			builder.WriteString(fmt.Sprintf("[%d more definitions not shown]\n", len(found)-maxSymbolDefinitions))
+			break
+		}
+		builder.WriteString(fmt.Sprintf("%s %s at %s:%d (%d references)\n", symbol.Kind, args.Name, symbol.Path, symbol.Line, len(t.index.ReferencesTo(symbol.Name))))
+		end := min(symbol.EndLine, symbol.StartLine+maxReadLines-1)
+		code, err := context.RenderFileRange(symbol.Path, symbol.StartLine, end)
+		if err != nil {
+			return "", err
+		}
+		builder.WriteString(code)
+	}
+	return builder.String(), nil
+}
@@ -0,0 +1,223 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"isy-cli/internal/context"
+	"isy-cli/internal/symbols"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+)
+
+const (
+	DefaultBudget         = 10    // Chiamate per richiesta
+	DefaultCommandTimeout = 60    // Secondi per ogni comando
+	maxResultChars        = 20000 // Oltre questa lunghezza un risultato viene troncato
+)
+
+// Prompt spiega al modello quando usare le funzioni; va aggiunto al prompt di sistema
+const Prompt = `
+
+The context may not contain every file of the project. When you need code that is not in the context, call the available tools (read_file, list_dir, grep, find_symbol) instead of guessing, and prefer small line ranges. Tool calls are limited per request: once the limit is reached, answer with what you have.`
+
+// Options controlla gli strumenti offerti al modello
+type Options struct {
+	Budget         int                       // Chiamate per richiesta (0 = DefaultBudget)
+	Commands       bool                      // Offre run_command
+	CommandTimeout int                       // Secondi per ogni comando (0 = DefaultCommandTimeout)
+	Approve        func(command string) bool // Chiede conferma prima di ogni comando
+	Out            io.Writer                 // Dove segnalare le chiamate (nil = nessun avviso)
+}
+
+// tool è una funzione che il modello può chiamare
+type tool struct {
+	name        string
+	description string
+	parameters  map[string]interface{}
+	run         func(t *Toolbox, arguments json.RawMessage) (string, error)
+}
+
+// Toolbox esegue le chiamate del modello sui file della directory corrente (la
+// radice del progetto o il branch di code), rispettando le esclusioni del profilo
+type Toolbox struct {
+	rules   *context.RuleSet
+	options Options
+	tools   []tool
+	index   *symbols.Index // Costruito alla prima chiamata di find_symbol
+
+	used int
+	log  []call // Chiamate della richiesta corrente
+}
+
+// call è una chiamata eseguita, da conservare nella conversazione
+type call struct {
+	summary string
+	result  string
+}
+
+// New crea gli strumenti per le impostazioni di contesto indicate
+func New(settings *context.Settings, options Options) *Toolbox {
+	if options.Budget <= 0 {
+		options.Budget = DefaultBudget
+	}
+	if options.CommandTimeout <= 0 {
+		options.CommandTimeout = DefaultCommandTimeout
+	}
+
+	toolbox := &Toolbox{rules: settings.Profile.Rules, options: options}
+	toolbox.tools = []tool{readFileTool, listDirTool, grepTool, findSymbolTool}
+	if options.Commands && options.Approve != nil {
+		toolbox.tools = append(toolbox.tools, runCommandTool)
+	}
+	return toolbox
+}
+
+// Reset azzera il budget e le chiamate registrate, all'inizio di ogni richiesta
+func (t *Toolbox) Reset() {
+	t.used = 0
+	t.log = nil
+	t.index = nil
+}
+
+// Exhausted indica che il budget della richiesta è esaurito
+func (t *Toolbox) Exhausted() bool {
+	return t.used >= t.options.Budget
+}
+
+// Tools restituisce le definizioni delle funzioni per la richiesta
+func (t *Toolbox) Tools() []openai.ChatCompletionToolParam {
+	definitions := make([]openai.ChatCompletionToolParam, 0, len(t.tools))
+	for _, tool := range t.tools {
+		definitions = append(definitions, openai.ChatCompletionToolParam{
+			Type: openai.F(openai.ChatCompletionToolTypeFunction),
+			Function: openai.F(shared.FunctionDefinitionParam{
+				Name:        openai.F(tool.name),
+				Description: openai.F(tool.description),
+				Parameters:  openai.F(shared.FunctionParameters(tool.parameters)),
+			}),
+		})
+	}
+	return definitions
+}
+
+// Call esegue una chiamata del modello. Gli errori vengono restituiti come testo,
+// così il modello può correggere la chiamata.
+func (t *Toolbox) Call(name, arguments string) string {
+	if t.Exhausted() {
+		return fmt.Sprintf("error: the budget of %d tool calls for this request is exhausted, answer with the information you have", t.options.Budget)
+	}
+	t.used++
+
+	var selected *tool
+	for i := range t.tools {
+		if t.tools[i].name == name {
+			selected = &t.tools[i]
+		}
+	}
+	if selected == nil {
+		return fmt.Sprintf("error: unknown tool %q", name)
+	}
+
+	summary := describeCall(name, arguments)
+	if t.options.Out != nil {
+		fmt.Fprintf(t.options.Out, "[%d/%d] %s\n", t.used, t.options.Budget, summary)
+	}
+
+	result, err := selected.run(t, json.RawMessage(arguments))
+	if err != nil {
+		result = "error: " + err.Error()
+	}
+	if len(result) > maxResultChars {
+		result = result[:maxResultChars] + fmt.Sprintf("\n[output truncated at %d characters]\n", maxResultChars)
+	}
+
+	t.log = append(t.log, call{summary: summary, result: result})
+	return result
+}
+
+// Transcript restituisce i risultati delle chiamate della richiesta corrente, da
+// conservare nella conversazione come codice recuperato per la richiesta
+func (t *Toolbox) Transcript() string {
+	if len(t.log) == 0 {
+		return ""
+	}
+	var builder strings.Builder
+	builder.WriteString("----- TOOL RESULTS -----\n\n")
+	for _, call := range t.log {
+		builder.WriteString("> " + call.summary + "\n")
+		builder.WriteString(call.result)
+		if !strings.HasSuffix(call.result, "\n") {
+			builder.WriteString("\n")
+		}
+		builder.WriteString("\n")
+	}
+	builder.WriteString("----- END TOOL RESULTS -----\n\n")
+	return builder.String()
+}
+
+// describeCall rende una chiamata in forma leggibile, es. read_file path=main.go
+func describeCall(name, arguments string) string {
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(arguments), &values); err != nil || len(values) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := []string{name}
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", key, values[key]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// decode legge gli argomenti di una chiamata
+func decode(arguments json.RawMessage, target interface{}) error {
+	if err := json.Unmarshal(arguments, target); err != nil {
+		return fmt.Errorf("invalid arguments: %v", err)
+	}
+	return nil
+}
+
+// resolve verifica che un percorso indicato dal modello resti nella directory
+// corrente e non sia escluso dal profilo, e lo restituisce in forma relativa
+func (t *Toolbox) resolve(path string, isDir bool) (string, error) {
+	if path == "" {
+		path = "."
+	}
+	if filepath.IsAbs(path) {
+		return "", fmt.Errorf("%s: use a path relative to the project root", path)
+	}
+	clean := filepath.Clean(path)
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the project", path)
+	}
+	if clean == "." {
+		return clean, nil
+	}
+	if excluded, reason := t.rules.Excluded(clean, isDir); excluded {
+		return "", fmt.Errorf("%s is not accessible: %s", path, reason)
+	}
+	return clean, nil
+}
+
+// schema costruisce lo schema JSON dei parametri di una funzione
+func schema(properties map[string]interface{}, required ...string) map[string]interface{} {
+	if required == nil {
+		required = []string{}
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
@@ -0,0 +1,206 @@
+package verify
+
+import (
+	gocontext "context"
+	"errors"
+	"fmt"
+	"io"
+	"isy-cli/internal/config"
+	"isy-cli/internal/context"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTimeout     = 300  // Secondi per ogni controllo
+	DefaultMaxFeedback = 2    // Correzioni automatiche di seguito senza REPL
+	maxOutputChars     = 4000 // Dell'output si conserva la parte finale
+)
+
+// Estensioni e file che attivano i controlli di un linguaggio
+var languageFiles = map[string][]string{
+	"go":         {"*.go", "go.mod", "go.sum"},
+	"python":     {"*.py", "pyproject.toml", "requirements*.txt"},
+	"javascript": {"*.js", "*.jsx", "*.mjs", "*.cjs", "package.json"},
+	"typescript": {"*.ts", "*.tsx", "package.json", "tsconfig*.json"},
+	"rust":       {"*.rs", "Cargo.toml"},
+	"java":       {"*.java", "pom.xml", "*.gradle", "*.gradle.kts"},
+	"ruby":       {"*.rb", "Gemfile"},
+	"php":        {"*.php", "composer.json"},
+	"c":          {"*.c", "*.h", "*.cpp", "*.hpp", "*.cc", "Makefile", "CMakeLists.txt"},
+}
+
+// Result è l'esito di un controllo
+type Result struct {
+	Name     string  `json:"name"`
+	Command  string  `json:"command"`
+	ExitCode int     `json:"exit_code"`
+	Passed   bool    `json:"passed"`
+	TimedOut bool    `json:"timed_out,omitempty"`
+	Seconds  float64 `json:"seconds"`
+	Output   string  `json:"output,omitempty"` // Parte finale dell'output, solo per i controlli falliti
+}
+
+// Run esegue nella directory del branch i controlli che riguardano i file
+// modificati (percorsi relativi al branch), nell'ordine configurato. Si ferma
+// al primo controllo fallito: quelli successivi di solito ne ripetono l'errore.
+func Run(dir string, cfg config.VerifyConfig, files []string, out io.Writer) []Result {
+	if cfg.Disabled {
+		return nil
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	var results []Result
+	for _, hook := range cfg.Hooks {
+		run, err := triggered(hook, files)
+		if err != nil {
+			results = append(results, Result{Name: hookName(hook), Command: hook.Command, ExitCode: -1, Output: err.Error()})
+			break
+		}
+		if !run {
+			continue
+		}
+		if out != nil {
+			fmt.Fprintf(out, "Controllo %s...\n", hookName(hook))
+		}
+		result := runHook(dir, hook, time.Duration(timeout)*time.Second)
+		results = append(results, result)
+		if !result.Passed {
+			break
+		}
+	}
+	return results
+}
+
+// triggered indica se un controllo riguarda i file modificati
+func triggered(hook config.VerifyHook, files []string) (bool, error) {
+	if strings.TrimSpace(hook.Command) == "" {
+		return false, fmt.Errorf("il controllo non ha un comando")
+	}
+	// I pattern del linguaggio vengono prima, così files può escluderne una parte con !
+	var patterns []string
+	if hook.Language != "" {
+		languagePatterns, ok := languageFiles[strings.ToLower(hook.Language)]
+		if !ok {
+			return false, fmt.Errorf("linguaggio sconosciuto %q (usa uno tra %s)", hook.Language, strings.Join(Languages(), ", "))
+		}
+		patterns = append(patterns, languagePatterns...)
+	}
+	patterns = append(patterns, hook.Files...)
+	if len(patterns) == 0 {
+		return true, nil
+	}
+
+	rules, err := context.NewRuleSet(patterns, "verify."+hookName(hook))
+	if err != nil {
+		return false, err
+	}
+	for _, file := range files {
+		if rule := rules.Match(file, false); rule != nil && !rule.Negate {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func runHook(dir string, hook config.VerifyHook, timeout time.Duration) Result {
+	result := Result{Name: hookName(hook), Command: hook.Command}
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), timeout)
+	defer cancel()
+
+	started := time.Now()
+	command := exec.CommandContext(ctx, "sh", "-c", hook.Command)
+	command.Dir = dir
+	// I processi figli (es. go test) possono tenere aperto l'output dopo il timeout
+	command.WaitDelay = 5 * time.Second
+	output, err := command.CombinedOutput()
+	result.Seconds = time.Since(started).Seconds()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		result.Passed = true
+		return result
+	case ctx.Err() != nil:
+		result.TimedOut = true
+		result.ExitCode = -1
+		output = append(output, []byte(fmt.Sprintf("\n[interrotto dopo %s]\n", timeout))...)
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	default:
+		result.ExitCode = -1
+		output = append(output, []byte(err.Error())...)
+	}
+	result.Output = tail(string(output))
+	return result
+}
+
+// Failed indica se almeno un controllo è fallito
+func Failed(results []Result) bool {
+	for _, result := range results {
+		if !result.Passed {
+			return true
+		}
+	}
+	return false
+}
+
+// Summary descrive gli esiti in una riga per controllo
+func Summary(results []Result) string {
+	var builder strings.Builder
+	for _, result := range results {
+		status := "ok"
+		switch {
+		case result.TimedOut:
+			status = "TIMEOUT"
+		case !result.Passed:
+			status = fmt.Sprintf("FALLITO (exit %d)", result.ExitCode)
+		}
+		builder.WriteString(fmt.Sprintf("  %-20s %-18s %.1fs\n", result.Name, status, result.Seconds))
+	}
+	return builder.String()
+}
+
+// Report descrive al modello i controlli falliti, perché possa correggere il codice
+func Report(results []Result) string {
+	var builder strings.Builder
+	builder.WriteString("Your modifications were applied, but the project checks failed:\n")
+	for _, result := range results {
+		if result.Passed {
+			continue
+		}
+		builder.WriteString(fmt.Sprintf("\n$ %s (exit code %d)\n```\n%s\n```\n", result.Command, result.ExitCode, strings.TrimRight(result.Output, "\n")))
+	}
+	builder.WriteString("\nFix the errors with new modifications, based on the files as they are now (including your previous modifications).")
+	return builder.String()
+}
+
+// Languages restituisce i linguaggi che si possono indicare nei controlli
+func Languages() []string {
+	languages := make([]string, 0, len(languageFiles))
+	for language := range languageFiles {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+func hookName(hook config.VerifyHook) string {
+	if hook.Name != "" {
+		return hook.Name
+	}
+	return strings.Fields(hook.Command + " ?")[0]
+}
+
+// tail conserva la parte finale dell'output, dove di solito si trovano gli errori
+func tail(output string) string {
+	if len(output) <= maxOutputChars {
+		return output
+	}
+	return "[...]\n" + output[len(output)-maxOutputChars:]
+}